@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"net/http"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"go.uber.org/zap"
 
 	"welloresto-api/internal/config"
+	"welloresto-api/internal/events"
 
 	"welloresto-api/internal/handlers"
 	"welloresto-api/internal/middleware"
@@ -22,6 +24,7 @@ func SetupRoutes(log *zap.Logger, mysqlDB *sql.DB, cfg config.Config) *chi.Mux {
 	// r.Use(middleware.RequestLogger(log))
 	// r.Use(middleware.Recoverer)
 	r.Use(middleware.ExtractToken)
+	r.Use(middleware.Language) // ?lang= or Accept-Language, labels fall back to French
 
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -36,7 +39,7 @@ func SetupRoutes(log *zap.Logger, mysqlDB *sql.DB, cfg config.Config) *chi.Mux {
 	})
 
 	// --- Repositories ---
-	userRepo := repositories.NewUserRepository(mysqlDB)
+	userRepo := repositories.NewUserRepository(mysqlDB, cfg.SessionTTL, cfg.LegacyTokens)
 	posRepo := repositories.NewPOSRepository(mysqlDB)
 	deviceRepo := repositories.NewDeviceRepository(mysqlDB)
 	appVersionRepo := repositories.NewAppVersionRepository(mysqlDB)
@@ -48,17 +51,36 @@ func SetupRoutes(log *zap.Logger, mysqlDB *sql.DB, cfg config.Config) *chi.Mux {
 	deliverySessionsRepo := repositories.NewDeliverySessionsRepository(mysqlDB, log)
 	cashDrawerRepo := repositories.NewCashDrawerRepository(mysqlDB, log)
 	locationsRepo := repositories.NewLocationsRepository(mysqlDB, log)
+	kitchenRepo := repositories.NewKitchenRepository(mysqlDB, log)
+	reportsRepo := repositories.NewReportsRepository(mysqlDB, log)
+	customersRepo := repositories.NewCustomersRepository(mysqlDB, log)
+	bookingsRepo := repositories.NewBookingsRepository(mysqlDB, log)
+	stockRepo := repositories.NewStockRepository(mysqlDB, log)
+	availabilityOutboxRepo := repositories.NewAvailabilityOutboxRepository(mysqlDB, log)
+
+	// --- Events (in-process, fed by every mutation) ---
+	bus := events.NewBus(log)
 
 	// --- Services ---
-	authService := services.NewAuthService(userRepo)
+	authService := services.NewAuthService(userRepo, cfg.PinSessionTTL, cfg.LegacyPasswords)
 	posService := services.NewPOSService(userRepo, posRepo)
 	deviceService := services.NewDeviceService(userRepo, deviceRepo)
 	appVersionService := services.NewAppVersionService(appVersionRepo, userRepo)
-	menuService := services.NewMenuService(userRepo, menuRepoLegacy, menuRepoOpti, false)
-	ordersService := services.NewOrdersService(ordersRepo, deliverySessionsRepo, userRepo)
-	deliverySessionsService := services.NewDeliverySessionsService(deliverySessionsRepo, userRepo)
+	menuService := services.NewMenuService(userRepo, menuRepoLegacy, menuRepoOpti, false, bus)
+	ordersService := services.NewOrdersService(ordersRepo, deliverySessionsRepo, stockRepo, userRepo, bus, log)
+	deliverySessionsService := services.NewDeliverySessionsService(deliverySessionsRepo, stockRepo, userRepo, bus, log)
 	cashDrawerService := services.NewCashDrawerService(cashDrawerRepo, userRepo)
 	locationsService := services.NewLocationsService(locationsRepo, userRepo)
+	kitchenService := services.NewKitchenService(kitchenRepo, ordersRepo, stockRepo, userRepo, bus, log)
+	reportsService := services.NewReportsService(reportsRepo, userRepo)
+	customersService := services.NewCustomersService(customersRepo, ordersRepo, userRepo)
+	bookingsService := services.NewBookingsService(bookingsRepo, userRepo)
+	stockService := services.NewStockService(stockRepo, userRepo, bus)
+
+	// --- Workers ---
+	// 86 changes queued in integration_availability_outbox -> Uber Eats
+	availabilitySync := services.NewAvailabilitySync(availabilityOutboxRepo, cfg.UberEatsAPIURL, log)
+	go availabilitySync.Run(context.Background())
 
 	// --- Handlers ---
 	authHandler := handlers.NewAuthHandler(authService)
@@ -70,51 +92,209 @@ func SetupRoutes(log *zap.Logger, mysqlDB *sql.DB, cfg config.Config) *chi.Mux {
 	deliverySessionsHandler := handlers.NewDeliverySessionsHandler(deliverySessionsService)
 	cashDrawerHandler := handlers.NewCashDrawerHandler(cashDrawerService)
 	locationsHandler := handlers.NewLocationsHandler(locationsService)
+	kitchenHandler := handlers.NewKitchenHandler(kitchenService)
+	reportsHandler := handlers.NewReportsHandler(reportsService)
+	customersHandler := handlers.NewCustomersHandler(customersService)
+	bookingsHandler := handlers.NewBookingsHandler(bookingsService)
+	stockHandler := handlers.NewStockHandler(stockService)
 
 	// --- Routes ---
 	// r.Get("/health", handlers.HealthCheck)
 
+	// Permissions: authenticate resolves the token once per request (401),
+	// require / requireAny check the users_rights flags (403)
+	authenticate := middleware.Authenticate(userRepo)
+	require := middleware.Require
+	anyApp := middleware.RequireAny(middleware.PermReception, middleware.PermWaiter, middleware.PermDelivery)
+
 	r.Route("/auth", func(r chi.Router) {
 		r.Get("/login", authHandler.Login)
+
+		r.Group(func(r chi.Router) {
+			r.Use(authenticate)
+			r.Post("/logout", authHandler.Logout)
+			r.Post("/merchant", authHandler.SwitchMerchant)
+			r.Post("/pin", authHandler.PinLogin)
+			r.Post("/refresh", authHandler.Refresh)
+			r.Delete("/users/{user_id}/sessions", authHandler.RevokeUserSessions)
+		})
 	})
 
 	r.Route("/pos", func(r chi.Router) {
+		r.Use(authenticate)
 		r.Get("/status", posHandler.GetPOSStatus)
-		r.Patch("/status", posHandler.UpdatePOSStatus)
+		r.With(require(middleware.PermReception)).Patch("/status", posHandler.UpdatePOSStatus)
 	})
 
 	r.Route("/device", func(r chi.Router) {
+		r.Use(authenticate)
 		r.Post("/token", deviceHandler.SaveDeviceToken)
 	})
 
 	r.Route("/app", func(r chi.Router) {
+		r.Use(authenticate)
 		r.Post("/version/check", appVersionHandler.CheckAppVersion)
 	})
 
 	r.Route("/menu", func(r chi.Router) {
+		r.Use(authenticate, anyApp)
 		r.Get("/", menuHandler.GetMenu)
+		r.Get("/categories", menuHandler.ListCategories)
+		r.Get("/products/{product_id}", menuHandler.GetProduct)
+		r.Get("/units", menuHandler.ListUnits)
+
+		// 86 from the floor: pushed on /orders/stream, and to Uber Eats through the availability outbox
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireAny(middleware.PermReception, middleware.PermEditMenu))
+			r.Patch("/products/{product_id}/availability", menuHandler.SetProductAvailability)
+			r.Patch("/components/{component_id}/availability", menuHandler.SetComponentAvailability)
+		})
+
+		// every write bumps last_menu_update, the other tablets reload
+		r.Group(func(r chi.Router) {
+			r.Use(require(middleware.PermEditMenu))
+			r.Post("/categories", menuHandler.CreateCategory)
+			r.Patch("/categories/{category_id}", menuHandler.UpdateCategory)
+			r.Delete("/categories/{category_id}", menuHandler.DeleteCategory)
+
+			r.Post("/products", menuHandler.CreateProduct)
+			r.Patch("/products/{product_id}", menuHandler.UpdateProduct)
+			r.Delete("/products/{product_id}", menuHandler.DeleteProduct)
+		})
+
+		// recipe costing: purchase costs and margins, not part of the menu the tablets load
+		r.Group(func(r chi.Router) {
+			r.Use(require(middleware.PermEditMenu))
+			r.Get("/margins", menuHandler.GetMarginReport)
+			r.Get("/products/{product_id}/cost", menuHandler.GetProductCost)
+			r.Patch("/components/{component_id}/cost", menuHandler.SetComponentCost)
+			r.Patch("/options/{option_id}/cost", menuHandler.SetOptionCost)
+		})
 	})
 
 	r.Route("/locations", func(r chi.Router) {
+		r.Use(authenticate, anyApp)
 		r.Get("/", locationsHandler.GetLocations)
 	})
 
+	r.Route("/floors", func(r chi.Router) {
+		r.Use(authenticate, anyApp)
+		r.Get("/", locationsHandler.GetFloors)
+		r.Get("/{floor_id}", locationsHandler.GetFloor)
+
+		// floor plan editor, from the reception tablet
+		r.Group(func(r chi.Router) {
+			r.Use(require(middleware.PermReception, middleware.PermEditFloorPlan))
+			r.Post("/", locationsHandler.CreateFloor)
+			r.Patch("/{floor_id}", locationsHandler.RenameFloor)
+			r.Delete("/{floor_id}", locationsHandler.DeleteFloor)
+			r.Put("/{floor_id}/layout", locationsHandler.SaveFloorLayout)
+
+			r.Post("/{floor_id}/areas", locationsHandler.SaveArea)
+			r.Put("/{floor_id}/areas/{area_id}", locationsHandler.SaveArea)
+			r.Delete("/{floor_id}/areas/{area_id}", locationsHandler.DeleteArea)
+
+			r.Post("/{floor_id}/tables", locationsHandler.SaveTable)
+			r.Put("/{floor_id}/tables/{location_id}", locationsHandler.SaveTable)
+			r.Delete("/{floor_id}/tables/{location_id}", locationsHandler.DeleteTable)
+		})
+	})
+
 	r.Route("/orders", func(r chi.Router) {
+		r.Use(authenticate, anyApp)
+		r.Post("/", ordersHandler.CreateOrder)
 		r.Get("/pending", ordersHandler.GetPendingOrders)
-		r.Post("/orders/history", ordersHandler.GetHistory)
+		r.Get("/stream", ordersHandler.StreamOrders)
+		r.Get("/history", ordersHandler.GetHistoryPage)
+		r.Post("/orders/history", ordersHandler.GetHistory) // legacy, unpaginated
 
 		r.Get("/{order_id}", ordersHandler.GetOrder)
+		r.Patch("/{order_id}/state", ordersHandler.UpdateOrderState) // reopen_order checked by the state machine
 
 		r.Get("/{order_id}/payments", ordersHandler.GetPayments)
-		r.Delete("/{order_id}/payments/{payment_id}", ordersHandler.DeletePayment)
+		r.Post("/{order_id}/payments", ordersHandler.AddPayment)
+		r.With(require(middleware.PermRefundPayment)).Delete("/{order_id}/payments/{payment_id}", ordersHandler.DeletePayment)
+	})
+
+	r.Route("/customers", func(r chi.Router) {
+		r.Use(authenticate, middleware.RequireAny(middleware.PermReception, middleware.PermWaiter))
+		r.Get("/", customersHandler.SearchCustomers)
+		r.Post("/", customersHandler.CreateCustomer)
+
+		r.Get("/{customer_id}", customersHandler.GetCustomer)
+		r.Patch("/{customer_id}", customersHandler.UpdateCustomer)
+		r.Post("/{customer_id}/addresses", customersHandler.AddAddress)
+		r.Patch("/{customer_id}/addresses/{address_id}", customersHandler.UpdateAddress)
+		r.Delete("/{customer_id}/addresses/{address_id}", customersHandler.DeleteAddress)
+	})
+
+	r.Route("/bookings", func(r chi.Router) {
+		r.Use(authenticate, middleware.RequireAny(middleware.PermReception, middleware.PermWaiter))
+		r.Get("/", bookingsHandler.ListBookings)
+		r.Post("/", bookingsHandler.CreateBooking)
+		r.Get("/availability", bookingsHandler.GetAvailability)
+
+		r.Get("/{booking_id}", bookingsHandler.GetBooking)
+		r.Patch("/{booking_id}/status", bookingsHandler.UpdateStatus)
+		r.Put("/{booking_id}/locations", bookingsHandler.SetLocations)
+	})
+
+	r.Route("/kitchen", func(r chi.Router) {
+		r.Use(authenticate, middleware.RequireAny(middleware.PermReception, middleware.PermWaiter))
+		r.Get("/items", kitchenHandler.GetItems)
+		r.Patch("/items/{order_item_id}", kitchenHandler.UpdateItemStatus)
+	})
+
+	// stock: only when the merchant's package has stock_management (403 otherwise),
+	// consumption itself happens on kitchen READY and when an order is DONE / CLOSED
+	r.Route("/stock", func(r chi.Router) {
+		r.Use(authenticate, middleware.RequireAny(middleware.PermReception, middleware.PermWaiter))
+		r.Get("/components", stockHandler.ListComponents)
+		r.Get("/movements", stockHandler.ListMovements)
+
+		r.Group(func(r chi.Router) {
+			r.Use(require(middleware.PermReception))
+			r.Patch("/components/{component_id}", stockHandler.UpdateComponent)
+			r.Post("/receptions", stockHandler.Receive)
+			r.Post("/inventories", stockHandler.Inventory)
+
+			// consumptions that failed after an order was produced / closed
+			r.Get("/pending_consumptions", stockHandler.ListPendingConsumptions)
+			r.Post("/pending_consumptions/{order_id}", stockHandler.ReplayConsumption)
+		})
 	})
 
 	r.Route("/delivery_sessions", func(r chi.Router) {
+		r.Use(authenticate, middleware.RequireAny(middleware.PermReception, middleware.PermDelivery))
+		r.Post("/", deliverySessionsHandler.CreateDeliverySession)
 		r.Get("/pending", deliverySessionsHandler.GetPendingDeliverySessions)
+
+		r.Get("/{delivery_session_id}", deliverySessionsHandler.GetDeliverySession)
+		r.Patch("/{delivery_session_id}/status", deliverySessionsHandler.UpdateStatus)
+		r.Put("/{delivery_session_id}/priority", deliverySessionsHandler.ReorderOrders)
+		r.Post("/{delivery_session_id}/position", deliverySessionsHandler.RecordPosition)
+		r.Post("/{delivery_session_id}/orders", deliverySessionsHandler.AttachOrder)
+		r.Delete("/{delivery_session_id}/orders/{order_id}", deliverySessionsHandler.DetachOrder)
 	})
 
 	r.Route("/cash_drawer", func(r chi.Router) {
-		r.Get("/open", cashDrawerHandler.OpenCashDrawer)
+		r.Use(authenticate)
+		r.With(require(middleware.PermCashReport)).Get("/z_report", cashDrawerHandler.GetZReport)
+
+		r.Group(func(r chi.Router) {
+			r.Use(require(middleware.PermOpenCashDrawer))
+			r.Get("/open", cashDrawerHandler.OpenCashDrawer)
+
+			r.Get("/session", cashDrawerHandler.GetCurrentSession)
+			r.Post("/session", cashDrawerHandler.OpenSession)
+			r.Post("/session/movements", cashDrawerHandler.AddMovement)
+			r.Post("/session/close", cashDrawerHandler.CloseSession)
+		})
+	})
+
+	r.Route("/reports", func(r chi.Router) {
+		r.Use(authenticate, require(middleware.PermCashReport))
+		r.Get("/cash", reportsHandler.GetCashReport)
 	})
 
 	return r
@@ -1,16 +1,37 @@
 package config
 
-import "os"
+import (
+	"os"
+	"time"
+)
 
 type Config struct {
 	Port     string
 	MySQLURL string
+
+	// SessionTTL : lifetime of a session token, extended on every use (sliding expiry)
+	SessionTTL time.Duration
+	// LegacyTokens : still accept users_rights.token / users.token while the apps migrate
+	LegacyTokens bool
+	// LegacyPasswords : the PHP backend still writes and reads users.password (AES / plain), so a
+	// legacy match is accepted even when the argon2id hash differs, and the column is kept on rehash.
+	// To be turned off, then removed, once the PHP login is retired: the hash becomes the only reference.
+	LegacyPasswords bool
+	// PinSessionTTL : lifetime of the token given by a PIN quick switch (not extended)
+	PinSessionTTL time.Duration
+	// UberEatsAPIURL : base URL of the Uber Eats API, availability changes are pushed there
+	UberEatsAPIURL string
 }
 
 func Load() Config {
 	return Config{
-		Port:     getEnv("PORT", "8080"),
-		MySQLURL: os.Getenv("MYSQL_URL"),
+		Port:            getEnv("PORT", "8080"),
+		MySQLURL:        os.Getenv("MYSQL_URL"),
+		SessionTTL:      getDuration("SESSION_TTL", 30*24*time.Hour),
+		LegacyTokens:    getEnv("LEGACY_TOKENS", "true") == "true",
+		LegacyPasswords: getEnv("LEGACY_PASSWORDS", "true") == "true",
+		PinSessionTTL:   getDuration("PIN_SESSION_TTL", 15*time.Minute),
+		UberEatsAPIURL:  getEnv("UBER_EATS_API_URL", "https://api.uber.com"),
 	}
 }
 
@@ -20,3 +41,12 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	if v, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Event types pushed to the apps
+const (
+	OrderCreated           = "order.created"
+	OrderUpdated           = "order.updated"
+	PaymentAdded           = "payment.added"
+	PaymentDisabled        = "payment.disabled"
+	DeliverySessionUpdated = "delivery_session.updated"
+	MenuAvailability       = "menu.availability"
+)
+
+// subscriberBuffer : a client that is this far behind starts losing events (it will resync with /orders/pending)
+const subscriberBuffer = 64
+
+type Event struct {
+	Type              string      `json:"type"`
+	MerchantID        string      `json:"merchant_id"`
+	OrderID           string      `json:"order_id,omitempty"`
+	DeliverySessionID string      `json:"delivery_session_id,omitempty"`
+	Data              interface{} `json:"data,omitempty"`
+	At                time.Time   `json:"at"`
+
+	// used for app filtering only, empty OrderType means "every app"
+	OrderType         string `json:"-"`
+	FulfillmentType   string `json:"-"`
+	InDeliverySession bool   `json:"-"` // the order is in an active delivery session
+}
+
+// Bus is an in-process pub/sub, events are fanned out to the subscribers of the same merchant
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+	log  *zap.Logger
+}
+
+func NewBus(log *zap.Logger) *Bus {
+	return &Bus{subs: map[*Subscription]struct{}{}, log: log}
+}
+
+type Subscription struct {
+	C          <-chan Event
+	ch         chan Event
+	merchantID string
+	app        string
+	bus        *Bus
+	once       sync.Once
+}
+
+// Subscribe registers a listener for one merchant, filtered like GetPendingOrders for the given app
+func (b *Bus) Subscribe(merchantID, app string) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	s := &Subscription{C: ch, ch: ch, merchantID: merchantID, app: app, bus: b}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	b.log.Info("events subscribe", zap.String("merchant_id", merchantID), zap.String("app", app))
+	return s
+}
+
+// Close unregisters the subscription, safe to call several times
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// Publish never blocks the caller (a mutation request): slow subscribers drop the event
+func (b *Bus) Publish(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for s := range b.subs {
+		if s.merchantID != e.MerchantID || !MatchesApp(s.app, e.OrderType, e.FulfillmentType, e.InDeliverySession) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			b.log.Warn("events subscriber too slow, event dropped",
+				zap.String("merchant_id", s.merchantID), zap.String("app", s.app), zap.String("type", e.Type))
+		}
+	}
+}
+
+// MatchesApp is the same predicate as the app criteria of OrdersRepository.GetPendingOrders
+// (repositories.appCondition): the driver app gets the deliveries made by the restaurant, and
+// any delivery attached to an active delivery session
+func MatchesApp(app, orderType, fulfillmentType string, inDeliverySession bool) bool {
+	if orderType == "" {
+		return true
+	}
+	switch app {
+	case "1", "WR_DELIVERY":
+		return orderType == "DELIVERY" && (fulfillmentType == "DELIVERY_BY_RESTAURANT" || inDeliverySession)
+	case "2", "WR_WAITER":
+		return orderType != "DELIVERY" && orderType != "TAKE_AWAY"
+	}
+	return true
+}
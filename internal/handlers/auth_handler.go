@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"welloresto-api/internal/middleware"
 	"welloresto-api/internal/services"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type AuthHandler struct {
@@ -42,3 +45,144 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		"data": resp,
 	})
 }
+
+// POST /auth/logout
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	token := middleware.GetToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.svc.Logout(r.Context(), token); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "1",
+	})
+}
+
+// POST /auth/refresh
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	token := middleware.GetToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	newToken, expiresAt, err := h.svc.Refresh(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, services.ErrNotRefreshable) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":            newToken,
+		"token_expires_at": expiresAt,
+	})
+}
+
+// DELETE /auth/users/{user_id}/sessions
+func (h *AuthHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	token := middleware.GetToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	revoked, err := h.svc.RevokeUserSessions(r.Context(), token, chi.URLParam(r, "user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrNotAllowed) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"revoked": revoked,
+	})
+}
+
+type pinLoginRequest struct {
+	DeviceID string `json:"device_id"`
+	PinCode  string `json:"pin_code"`
+}
+
+// POST /auth/pin
+func (h *AuthHandler) PinLogin(w http.ResponseWriter, r *http.Request) {
+	token := middleware.GetToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req pinLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.svc.PinLogin(r.Context(), token, req.DeviceID, req.PinCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPinLocked):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		case errors.Is(err, services.ErrPinAmbiguous):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, services.ErrNotAllowed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type switchMerchantRequest struct {
+	MerchantID string `json:"merchant_id"`
+}
+
+// POST /auth/merchant
+func (h *AuthHandler) SwitchMerchant(w http.ResponseWriter, r *http.Request) {
+	token := middleware.GetToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req switchMerchantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.svc.SwitchMerchant(r.Context(), token, req.MerchantID)
+	if err != nil {
+		if errors.Is(err, services.ErrNotAllowed) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":   99,
+		"data": resp,
+	})
+}
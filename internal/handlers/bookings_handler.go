@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// BookingsHandler handles the table bookings endpoints
+type BookingsHandler struct {
+	bookingsService *services.BookingsService
+}
+
+func NewBookingsHandler(bookingsService *services.BookingsService) *BookingsHandler {
+	return &BookingsHandler{
+		bookingsService: bookingsService,
+	}
+}
+
+// GET /bookings?day=YYYY-MM-DD&status=PENDING,ACCEPTED
+func (h *BookingsHandler) ListBookings(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	bookings, err := h.bookingsService.ListBookings(r.Context(), token, r.URL.Query().Get("day"), splitList(r.URL.Query().Get("status")))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bookings": bookings,
+	})
+}
+
+// GET /bookings/availability?from=&to=&party_size=
+func (h *BookingsHandler) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	from, err := parseTimestamp(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimestamp(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+	partySize, err := strconv.Atoi(r.URL.Query().Get("party_size"))
+	if err != nil {
+		http.Error(w, "invalid party_size", http.StatusBadRequest)
+		return
+	}
+
+	availability, err := h.bookingsService.GetAvailability(r.Context(), token, from, to, partySize)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(availability)
+}
+
+// GET /bookings/{booking_id}
+func (h *BookingsHandler) GetBooking(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	booking, err := h.bookingsService.GetBooking(r.Context(), token, chi.URLParam(r, "booking_id"))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(booking)
+}
+
+// POST /bookings
+func (h *BookingsHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateBookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	booking, err := h.bookingsService.CreateBooking(r.Context(), token, req)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(booking)
+}
+
+// PATCH /bookings/{booking_id}/status
+func (h *BookingsHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.BookingStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	booking, err := h.bookingsService.ChangeStatus(r.Context(), token, chi.URLParam(r, "booking_id"), req.Status)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(booking)
+}
+
+// PUT /bookings/{booking_id}/locations
+func (h *BookingsHandler) SetLocations(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.BookingLocationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	booking, err := h.bookingsService.SetLocations(r.Context(), token, chi.URLParam(r, "booking_id"), req.LocationIDs)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(booking)
+}
+
+func writeBookingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "booking not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidBooking), errors.Is(err, services.ErrInvalidBookingStatus):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrBookingConflict), errors.Is(err, services.ErrIllegalBookingTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"welloresto-api/internal/models"
 	"welloresto-api/internal/services"
 )
 
@@ -17,8 +19,143 @@ func NewCashDrawerHandler(cashDrawerService *services.CashDrawerService) *CashDr
 	}
 }
 
+// GET /cash_drawer/open?device_id=
 func (h *CashDrawerHandler) OpenCashDrawer(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.cashDrawerService.OpenDrawer(r.Context(), token, r.URL.Query().Get("device_id")); err != nil {
+		writeCashDrawerError(w, err)
+		return
+	}
+
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status": "1",
 	})
 }
+
+// GET /cash_drawer/session
+func (h *CashDrawerHandler) GetCurrentSession(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := h.cashDrawerService.GetCurrentSession(r.Context(), token)
+	if err != nil {
+		writeCashDrawerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// POST /cash_drawer/session
+func (h *CashDrawerHandler) OpenSession(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.OpenCashDrawerSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.cashDrawerService.OpenSession(r.Context(), token, req)
+	if err != nil {
+		writeCashDrawerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// POST /cash_drawer/session/movements
+func (h *CashDrawerHandler) AddMovement(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CashDrawerMovementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.cashDrawerService.AddMovement(r.Context(), token, req)
+	if err != nil {
+		writeCashDrawerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// POST /cash_drawer/session/close
+func (h *CashDrawerHandler) CloseSession(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CloseCashDrawerSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.cashDrawerService.CloseSession(r.Context(), token, req)
+	if err != nil {
+		writeCashDrawerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// GET /cash_drawer/z_report?date=YYYY-MM-DD
+func (h *CashDrawerHandler) GetZReport(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	report, err := h.cashDrawerService.GetZReport(r.Context(), token, r.URL.Query().Get("date"))
+	if err != nil {
+		writeCashDrawerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func writeCashDrawerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrCashDrawerNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrInvalidCashDrawer):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrCashDrawerConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
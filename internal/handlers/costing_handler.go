@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"welloresto-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GET /menu/products/{product_id}/cost?target_margin=70
+func (h *MenuHandler) GetProductCost(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	target, err := optionalFloat(r.URL.Query().Get("target_margin"))
+	if err != nil {
+		http.Error(w, "invalid target_margin", http.StatusBadRequest)
+		return
+	}
+
+	cost, err := h.service.GetProductCost(r.Context(), token, chi.URLParam(r, "product_id"), target, requestLang(r))
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cost)
+}
+
+// GET /menu/margins?target_margin=70&under_target=1[&format=csv]
+func (h *MenuHandler) GetMarginReport(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	target, err := optionalFloat(q.Get("target_margin"))
+	if err != nil {
+		http.Error(w, "invalid target_margin", http.StatusBadRequest)
+		return
+	}
+	underTarget := q.Get("under_target") == "1" || q.Get("under_target") == "true"
+
+	report, err := h.service.GetMarginReport(r.Context(), token, target, underTarget, requestLang(r))
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	if q.Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		writeMarginReportCSV(w, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// writeMarginReportCSV : one line per product and channel, ';' separated and ',' decimals like the cash report
+func writeMarginReportCSV(w http.ResponseWriter, report *models.MarginReport) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="margins.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+
+	rate := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strings.Replace(fmt.Sprintf("%.1f", *v), ".", ",", 1)
+	}
+
+	cw.Write([]string{"product_id", "name", "channel", "price", "tva_rate", "price_ht", "cost", "margin", "margin_rate", "worst_margin_rate", "under_target", "complete"})
+	for _, p := range report.Products {
+		for _, ch := range p.Channels {
+			cw.Write([]string{
+				p.ProductID, p.Name, ch.Channel,
+				formatCents(ch.Price), formatRate(ch.TVARate), formatCents(ch.PriceHT), formatCents(p.Cost),
+				formatCents(ch.Margin), rate(ch.MarginRate), rate(ch.WorstMarginRate),
+				strconv.FormatBool(ch.UnderTarget), strconv.FormatBool(p.Complete),
+			})
+		}
+	}
+	cw.Flush()
+}
+
+// PATCH /menu/components/{component_id}/cost
+func (h *MenuHandler) SetComponentCost(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.SetComponentCost(r.Context(), token, chi.URLParam(r, "component_id"), req); err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "1",
+	})
+}
+
+// PATCH /menu/options/{option_id}/cost
+func (h *MenuHandler) SetOptionCost(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.SetOptionCost(r.Context(), token, chi.URLParam(r, "option_id"), req); err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "1",
+	})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CustomersHandler handles the customer directory endpoints
+type CustomersHandler struct {
+	customersService *services.CustomersService
+}
+
+func NewCustomersHandler(customersService *services.CustomersService) *CustomersHandler {
+	return &CustomersHandler{
+		customersService: customersService,
+	}
+}
+
+// GET /customers?phone=&name=
+func (h *CustomersHandler) SearchCustomers(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	customers, err := h.customersService.Search(r.Context(), token, r.URL.Query().Get("phone"), r.URL.Query().Get("name"))
+	if err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"customers": customers,
+	})
+}
+
+// GET /customers/{customer_id}
+func (h *CustomersHandler) GetCustomer(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	customer, err := h.customersService.GetCustomer(r.Context(), token, chi.URLParam(r, "customer_id"))
+	if err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(customer)
+}
+
+// POST /customers
+func (h *CustomersHandler) CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CustomerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	customer, err := h.customersService.CreateCustomer(r.Context(), token, req)
+	if err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(customer)
+}
+
+// PATCH /customers/{customer_id}
+func (h *CustomersHandler) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CustomerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	customer, err := h.customersService.UpdateCustomer(r.Context(), token, chi.URLParam(r, "customer_id"), req)
+	if err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(customer)
+}
+
+// POST /customers/{customer_id}/addresses
+func (h *CustomersHandler) AddAddress(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CustomerAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	customer, err := h.customersService.AddAddress(r.Context(), token, chi.URLParam(r, "customer_id"), req)
+	if err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(customer)
+}
+
+// PATCH /customers/{customer_id}/addresses/{address_id}
+func (h *CustomersHandler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CustomerAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	customer, err := h.customersService.UpdateAddress(r.Context(), token, chi.URLParam(r, "customer_id"), chi.URLParam(r, "address_id"), req)
+	if err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(customer)
+}
+
+// DELETE /customers/{customer_id}/addresses/{address_id}
+func (h *CustomersHandler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.customersService.DeleteAddress(r.Context(), token, chi.URLParam(r, "customer_id"), chi.URLParam(r, "address_id")); err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "1",
+	})
+}
+
+func writeCustomerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "customer not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidCustomer):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"welloresto-api/internal/models"
 	"welloresto-api/internal/services"
+
+	"github.com/go-chi/chi/v5"
 )
 
 // OrdersHandler handles orders endpoints
@@ -26,7 +31,7 @@ func (h *DeliverySessionsHandler) GetPendingDeliverySessions(w http.ResponseWrit
 		return
 	}
 
-	sessions, err := h.deliverySessionsService.GetPendingDeliverySessions(ctx, token)
+	sessions, err := h.deliverySessionsService.GetPendingDeliverySessions(ctx, token, requestLang(r))
 	if err != nil {
 		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -38,3 +43,139 @@ func (h *DeliverySessionsHandler) GetPendingDeliverySessions(w http.ResponseWrit
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// GET /delivery_sessions/{delivery_session_id}
+func (h *DeliverySessionsHandler) GetDeliverySession(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := h.deliverySessionsService.GetDeliverySession(r.Context(), token, chi.URLParam(r, "delivery_session_id"), requestLang(r))
+	writeDeliverySession(w, session, err, http.StatusOK)
+}
+
+// POST /delivery_sessions
+func (h *DeliverySessionsHandler) CreateDeliverySession(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateDeliverySessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.deliverySessionsService.CreateDeliverySession(r.Context(), token, req)
+	writeDeliverySession(w, session, err, http.StatusCreated)
+}
+
+// POST /delivery_sessions/{delivery_session_id}/orders
+func (h *DeliverySessionsHandler) AttachOrder(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DeliverySessionOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.deliverySessionsService.AttachOrder(r.Context(), token, chi.URLParam(r, "delivery_session_id"), req.OrderID)
+	writeDeliverySession(w, session, err, http.StatusOK)
+}
+
+// DELETE /delivery_sessions/{delivery_session_id}/orders/{order_id}
+func (h *DeliverySessionsHandler) DetachOrder(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := h.deliverySessionsService.DetachOrder(r.Context(), token, chi.URLParam(r, "delivery_session_id"), chi.URLParam(r, "order_id"))
+	writeDeliverySession(w, session, err, http.StatusOK)
+}
+
+// PUT /delivery_sessions/{delivery_session_id}/priority
+func (h *DeliverySessionsHandler) ReorderOrders(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DeliverySessionPriorityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.deliverySessionsService.ReorderOrders(r.Context(), token, chi.URLParam(r, "delivery_session_id"), req.OrderIDs)
+	writeDeliverySession(w, session, err, http.StatusOK)
+}
+
+// PATCH /delivery_sessions/{delivery_session_id}/status
+func (h *DeliverySessionsHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DeliverySessionStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.deliverySessionsService.UpdateStatus(r.Context(), token, chi.URLParam(r, "delivery_session_id"), req.Status)
+	writeDeliverySession(w, session, err, http.StatusOK)
+}
+
+// POST /delivery_sessions/{delivery_session_id}/position
+func (h *DeliverySessionsHandler) RecordPosition(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DriverPositionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.deliverySessionsService.RecordPosition(r.Context(), token, chi.URLParam(r, "delivery_session_id"), req)
+	writeDeliverySession(w, session, err, http.StatusOK)
+}
+
+func writeDeliverySession(w http.ResponseWriter, session *models.DeliverySession, err error, status int) {
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "delivery session or order not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrNotSessionDriver):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, services.ErrInvalidDeliverySession):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, services.ErrDeliverySessionConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(session)
+}
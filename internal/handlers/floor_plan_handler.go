@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GET /floors
+func (h *LocationsHandler) GetFloors(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	floors, err := h.locationsService.GetFloors(r.Context(), token)
+	if err != nil {
+		writeFloorPlanError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"floors": floors,
+	})
+}
+
+// GET /floors/{floor_id}
+func (h *LocationsHandler) GetFloor(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	floor, err := h.locationsService.GetFloor(r.Context(), token, chi.URLParam(r, "floor_id"))
+	if err != nil {
+		writeFloorPlanError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(floor)
+}
+
+// POST /floors
+func (h *LocationsHandler) CreateFloor(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.FloorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	floor, err := h.locationsService.CreateFloor(r.Context(), token, req)
+	if err != nil {
+		writeFloorPlanError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(floor)
+}
+
+// PATCH /floors/{floor_id}
+func (h *LocationsHandler) RenameFloor(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.FloorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	floor, err := h.locationsService.RenameFloor(r.Context(), token, chi.URLParam(r, "floor_id"), req)
+	if err != nil {
+		writeFloorPlanError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(floor)
+}
+
+// DELETE /floors/{floor_id}
+func (h *LocationsHandler) DeleteFloor(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.locationsService.DeleteFloor(r.Context(), token, chi.URLParam(r, "floor_id")); err != nil {
+		writeFloorPlanError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "1",
+	})
+}
+
+// PUT /floors/{floor_id}/layout
+func (h *LocationsHandler) SaveFloorLayout(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.FloorLayoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	floor, err := h.locationsService.SaveFloorLayout(r.Context(), token, chi.URLParam(r, "floor_id"), req)
+	if err != nil {
+		writeFloorPlanError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(floor)
+}
+
+// POST /floors/{floor_id}/areas and PUT /floors/{floor_id}/areas/{area_id}
+func (h *LocationsHandler) SaveArea(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.Area
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	areaID := chi.URLParam(r, "area_id")
+	floor, err := h.locationsService.SaveArea(r.Context(), token, chi.URLParam(r, "floor_id"), areaID, req)
+	if err != nil {
+		writeFloorPlanError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if areaID == "" {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(floor)
+}
+
+// DELETE /floors/{floor_id}/areas/{area_id}
+func (h *LocationsHandler) DeleteArea(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.locationsService.DeleteArea(r.Context(), token, chi.URLParam(r, "floor_id"), chi.URLParam(r, "area_id")); err != nil {
+		writeFloorPlanError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "1",
+	})
+}
+
+// POST /floors/{floor_id}/tables and PUT /floors/{floor_id}/tables/{location_id}
+func (h *LocationsHandler) SaveTable(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.FloorTable
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	locationID := chi.URLParam(r, "location_id")
+	floor, err := h.locationsService.SaveTable(r.Context(), token, chi.URLParam(r, "floor_id"), locationID, req)
+	if err != nil {
+		writeFloorPlanError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if locationID == "" {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(floor)
+}
+
+// DELETE /floors/{floor_id}/tables/{location_id}
+func (h *LocationsHandler) DeleteTable(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.locationsService.DeleteTable(r.Context(), token, chi.URLParam(r, "floor_id"), chi.URLParam(r, "location_id")); err != nil {
+		writeFloorPlanError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "1",
+	})
+}
+
+func writeFloorPlanError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidFloorPlan):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrFloorPlanConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
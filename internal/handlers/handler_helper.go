@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"welloresto-api/internal/middleware"
 )
 
 // helper to extract token either from Authorization header (Bearer ...) or token query param
@@ -22,3 +25,82 @@ func extractToken(r *http.Request) string {
 	}
 	return ""
 }
+
+// requestLang : language of the labels (?lang= or Accept-Language, see middleware.Language)
+func requestLang(r *http.Request) string {
+	return middleware.LangFromContext(r.Context())
+}
+
+// parseTimestamp accepts the legacy "2006-01-02 15:04:05" (UTC) format or RFC3339
+func parseTimestamp(v string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", v, time.UTC); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// legacyDate : date alone, as the legacy endpoints accepted it ("2006-01-02", UTC)
+const legacyDate = "2006-01-02"
+
+// parseRangeStart : see parseTimestamp, a date alone is the start of that day
+func parseRangeStart(v string) (time.Time, error) {
+	if t, err := time.ParseInLocation(legacyDate, v, time.UTC); err == nil {
+		return t, nil
+	}
+	return parseTimestamp(v)
+}
+
+// parseRangeEnd : see parseTimestamp, a date alone takes the whole day (up to its last second)
+func parseRangeEnd(v string) (time.Time, error) {
+	if t, err := time.ParseInLocation(legacyDate, v, time.UTC); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return parseTimestamp(v)
+}
+
+// splitList : "a,b, c" -> [a b c], empty values dropped, nil for ""
+func splitList(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// optionalTimestamp : nil for "", see parseTimestamp
+func optionalTimestamp(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := parseTimestamp(v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// optionalInt64 : nil for ""
+func optionalInt64(v string) (*int64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// optionalFloat : nil for ""
+func optionalFloat(v string) (*float64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
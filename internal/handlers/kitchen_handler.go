@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// KitchenHandler handles kitchen display (KDS) endpoints
+type KitchenHandler struct {
+	kitchenService *services.KitchenService
+}
+
+func NewKitchenHandler(kitchenService *services.KitchenService) *KitchenHandler {
+	return &KitchenHandler{
+		kitchenService: kitchenService,
+	}
+}
+
+// GET /kitchen/items?group_by=station|category
+func (h *KitchenHandler) GetItems(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	resp, err := h.kitchenService.GetItems(ctx, token, r.URL.Query().Get("group_by"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidKitchenUpdate) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// PATCH /kitchen/items/{order_item_id}
+func (h *KitchenHandler) UpdateItemStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	orderItemID := chi.URLParam(r, "order_item_id")
+
+	var req models.KitchenItemStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.kitchenService.UpdateItemStatus(ctx, token, orderItemID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "order item not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrInvalidKitchenUpdate):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, services.ErrKitchenConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
@@ -46,7 +46,7 @@ func (h *MenuHandler) GetMenu(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	resp, err := h.service.GetMenu(ctx, token, lastMenu)
+	resp, err := h.service.GetMenu(ctx, token, lastMenu, requestLang(r))
 	if err != nil {
 		// LOG SERVER SIDE
 		log.Printf("[ERROR] GetMenu token=%s last_menu=%v err=%+v", token, lastMenu, err)
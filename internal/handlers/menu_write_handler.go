@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GET /menu/categories
+func (h *MenuHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	categories, err := h.service.ListCategories(r.Context(), token)
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"categories": categories,
+	})
+}
+
+// POST /menu/categories
+func (h *MenuHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.service.CreateCategory(r.Context(), token, req)
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// PATCH /menu/categories/{category_id}
+func (h *MenuHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.service.UpdateCategory(r.Context(), token, chi.URLParam(r, "category_id"), req)
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+// DELETE /menu/categories/{category_id}
+func (h *MenuHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.DeleteCategory(r.Context(), token, chi.URLParam(r, "category_id")); err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "1",
+	})
+}
+
+// GET /menu/products/{product_id}
+func (h *MenuHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	product, err := h.service.GetProduct(r.Context(), token, chi.URLParam(r, "product_id"))
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// GET /menu/units?lang=EN (or Accept-Language)
+func (h *MenuHandler) ListUnits(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	list, err := h.service.ListUnits(r.Context(), token, requestLang(r))
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"units": list,
+	})
+}
+
+// POST /menu/products
+func (h *MenuHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.service.CreateProduct(r.Context(), token, req)
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(product)
+}
+
+// PATCH /menu/products/{product_id}
+func (h *MenuHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.service.UpdateProduct(r.Context(), token, chi.URLParam(r, "product_id"), req)
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// DELETE /menu/products/{product_id}
+func (h *MenuHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.DeleteProduct(r.Context(), token, chi.URLParam(r, "product_id")); err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "1",
+	})
+}
+
+// PATCH /menu/products/{product_id}/availability
+func (h *MenuHandler) SetProductAvailability(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.AvailabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	change, err := h.service.SetProductAvailability(r.Context(), token, chi.URLParam(r, "product_id"), req)
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+// PATCH /menu/components/{component_id}/availability
+func (h *MenuHandler) SetComponentAvailability(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.AvailabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	change, err := h.service.SetComponentAvailability(r.Context(), token, chi.URLParam(r, "component_id"), req)
+	if err != nil {
+		writeMenuError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+func writeMenuError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidMenu):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrMenuConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
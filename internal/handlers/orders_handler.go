@@ -3,7 +3,12 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
+	"welloresto-api/internal/events"
 	"welloresto-api/internal/models"
 	"welloresto-api/internal/services"
 
@@ -39,7 +44,18 @@ func (h *OrdersHandler) GetPendingOrders(w http.ResponseWriter, r *http.Request)
 		app = "WR_RECEPTION"
 	}
 
-	resp, err := h.ordersService.GetPendingOrders(ctx, token, app)
+	// delta sync: ?since=<sync_timestamp of the previous response>
+	var since *time.Time
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		t, err := parseTimestamp(sinceParam)
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		since = &t
+	}
+
+	resp, err := h.ordersService.GetPendingOrders(ctx, token, app, since, requestLang(r))
 	if err != nil {
 		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -60,7 +76,7 @@ func (h *OrdersHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := h.ordersService.GetOrder(ctx, token, orderID)
+	order, err := h.ordersService.GetOrder(ctx, token, orderID, requestLang(r))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "order not found", http.StatusNotFound)
@@ -73,6 +89,69 @@ func (h *OrdersHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(order)
 }
 
+// GET /orders/history?state=&order_type=&brand=&mop=&customer_id=&location_id=&min_ttc=&max_ttc=&from=&to=&limit=&cursor=&expand=1
+// List filters take comma separated values; next_cursor of a page is sent back as ?cursor=
+func (h *OrdersHandler) GetHistoryPage(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	qp := r.URL.Query()
+	q := models.OrderHistoryQuery{
+		States:     splitList(qp.Get("state")),
+		OrderTypes: splitList(qp.Get("order_type")),
+		Brands:     splitList(qp.Get("brand")),
+		MOPs:       splitList(qp.Get("mop")),
+		CustomerID: qp.Get("customer_id"),
+		LocationID: qp.Get("location_id"),
+		App:        qp.Get("app"),
+		Cursor:     qp.Get("cursor"),
+		Expand:     qp.Get("expand") == "1" || qp.Get("expand") == "true",
+	}
+
+	var err error
+	if q.From, err = optionalTimestamp(qp.Get("from")); err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	if q.To, err = optionalTimestamp(qp.Get("to")); err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+	if q.MinTTC, err = optionalInt64(qp.Get("min_ttc")); err != nil {
+		http.Error(w, "invalid min_ttc", http.StatusBadRequest)
+		return
+	}
+	if q.MaxTTC, err = optionalInt64(qp.Get("max_ttc")); err != nil {
+		http.Error(w, "invalid max_ttc", http.StatusBadRequest)
+		return
+	}
+	if v := qp.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+
+	page, err := h.ordersService.GetHistoryPage(r.Context(), token, q, requestLang(r))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidHistoryQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// POST /orders/orders/history (legacy) : every CLOSED order of the range in one response, prefer GET /orders/history
 func (h *OrdersHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	token := extractToken(r)
@@ -93,7 +172,17 @@ func (h *OrdersHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
-	resp, err := h.ordersService.GetHistory(ctx, token, req)
+	from, err := parseRangeStart(req.DateFrom)
+	if err != nil {
+		http.Error(w, "invalid date_from", http.StatusBadRequest)
+		return
+	}
+	to, err := parseRangeEnd(req.DateTo)
+	if err != nil {
+		http.Error(w, "invalid date_to", http.StatusBadRequest)
+		return
+	}
+	resp, err := h.ordersService.GetHistory(ctx, token, from, to, requestLang(r))
 
 	if err != nil {
 		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
@@ -124,13 +213,231 @@ func (h *OrdersHandler) DeletePayment(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	token := extractToken(r)
 
+	orderID := chi.URLParam(r, "order_id")
 	paymentID := chi.URLParam(r, "payment_id")
 
-	err := h.ordersService.DisablePayment(ctx, token, paymentID)
+	err := h.ordersService.DisablePayment(ctx, token, orderID, paymentID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "payment not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	json.NewEncoder(w).Encode(map[string]string{"status": "1"})
 }
+
+// POST /orders
+func (h *OrdersHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.Order
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.ordersService.CreateOrder(ctx, token, req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidOrder) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// PATCH /orders/{order_id}/state
+func (h *OrdersHandler) UpdateOrderState(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	orderID := chi.URLParam(r, "order_id")
+
+	var req models.OrderStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.ordersService.ChangeOrderState(ctx, token, orderID, req.State)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "order not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrInvalidOrderState):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, services.ErrReopenNotAllowed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, services.ErrIllegalTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// POST /orders/{order_id}/payments
+func (h *OrdersHandler) AddPayment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	orderID := chi.URLParam(r, "order_id")
+
+	var req models.AddPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.ordersService.AddPayment(ctx, token, orderID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "order not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrInvalidPayment):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, services.ErrOrderNotPayable):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// streamHeartbeat keeps proxies from closing idle streams
+const streamHeartbeat = 25 * time.Second
+
+// GET /orders/stream?app=WR_WAITER
+// Server-Sent Events by default, WebSocket when the client asks for an upgrade.
+func (h *OrdersHandler) StreamOrders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	app := r.URL.Query().Get("app")
+	if app == "" {
+		app = "WR_RECEPTION"
+	}
+
+	sub, err := h.ordersService.SubscribeOrders(ctx, token, app)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	defer sub.Close()
+
+	if isWebSocketRequest(r) {
+		h.streamWebSocket(w, r, sub)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			payload, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, payload)
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *OrdersHandler) streamWebSocket(w http.ResponseWriter, r *http.Request, sub *events.Subscription) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already answered with an HTTP error
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		wsReadLoop(conn)
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+			if err := wsPing(conn); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				wsClose(conn)
+				return
+			}
+			payload, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if err := wsWriteText(conn, payload); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/services"
+)
+
+// ReportsHandler handles reports endpoints
+type ReportsHandler struct {
+	reportsService *services.ReportsService
+}
+
+func NewReportsHandler(reportsService *services.ReportsService) *ReportsHandler {
+	return &ReportsHandler{
+		reportsService: reportsService,
+	}
+}
+
+// GET /reports/cash?from=YYYY-MM-DD&to=YYYY-MM-DD[&format=csv]
+func (h *ReportsHandler) GetCashReport(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	report, err := h.reportsService.GetCashReport(r.Context(), token, q.Get("from"), q.Get("to"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrReportNotAllowed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, services.ErrInvalidReportRange):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if q.Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		writeCashReportCSV(w, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// writeCashReportCSV : one section per block, ';' separated and ',' decimals so that it opens as is
+// in a French Excel
+func writeCashReportCSV(w http.ResponseWriter, report *models.CashReport) {
+	filename := fmt.Sprintf("cash_report_%s_%s.csv", report.From.Format("2006-01-02"), report.To.AddDate(0, 0, -1).Format("2006-01-02"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+
+	cw.Write([]string{"section", "key", "count", "TTC", "TVA", "HT"})
+	for _, p := range report.Payments {
+		cw.Write([]string{"payments", p.MOP, fmt.Sprint(p.Count), formatCents(p.Amount), "", ""})
+	}
+	cw.Write([]string{"payments", "TOTAL", "", formatCents(report.PaymentsTotal), "", ""})
+	for _, t := range report.OrderTypes {
+		cw.Write([]string{"order_type", t.OrderType, fmt.Sprint(t.Count), formatCents(t.TTC), formatCents(t.TVA), formatCents(t.HT)})
+	}
+	cw.Write([]string{"order_type", "TOTAL", fmt.Sprint(report.OrdersCount), formatCents(report.TTC), formatCents(report.TVA), formatCents(report.HT)})
+	for _, t := range report.TVARates {
+		cw.Write([]string{"tva_rate", formatRate(t.Rate), "", formatCents(t.TTC), formatCents(t.TVA), formatCents(t.HT)})
+	}
+	cw.Write([]string{"tva_rate", "delivery_fees", "", formatCents(report.DeliveryFees), formatCents(0), formatCents(report.DeliveryFees)})
+
+	cw.Flush()
+}
+
+// formatCents : 1234 -> "12,34" (CSV exports, French decimal separator)
+func formatCents(v int64) string {
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	return fmt.Sprintf("%s%d,%02d", sign, v/100, v%100)
+}
+
+// formatRate : 5.5 -> "5,5", same decimal separator as formatCents
+func formatRate(v float64) string {
+	return strings.Replace(strconv.FormatFloat(v, 'f', -1, 64), ".", ",", 1)
+}
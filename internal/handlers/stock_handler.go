@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// StockHandler handles the component stock endpoints
+type StockHandler struct {
+	stockService *services.StockService
+}
+
+func NewStockHandler(stockService *services.StockService) *StockHandler {
+	return &StockHandler{
+		stockService: stockService,
+	}
+}
+
+// GET /stock/components
+func (h *StockHandler) ListComponents(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	components, err := h.stockService.ListComponents(r.Context(), token)
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"components": components,
+	})
+}
+
+// PATCH /stock/components/{component_id}
+func (h *StockHandler) UpdateComponent(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.StockComponentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	update, err := h.stockService.UpdateComponent(r.Context(), token, chi.URLParam(r, "component_id"), req)
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(update)
+}
+
+// GET /stock/movements?component_id=&type=CONSUMPTION|RECEPTION|INVENTORY&from=&to=&limit=
+func (h *StockHandler) ListMovements(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	qp := r.URL.Query()
+	filter := models.StockMovementFilter{
+		ComponentID: qp.Get("component_id"),
+		Type:        qp.Get("type"),
+	}
+
+	var err error
+	if filter.From, err = optionalTimestamp(qp.Get("from")); err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = optionalTimestamp(qp.Get("to")); err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+	if v := qp.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	movements, err := h.stockService.ListMovements(r.Context(), token, filter)
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"movements": movements,
+	})
+}
+
+// POST /stock/receptions
+func (h *StockHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.StockCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	update, err := h.stockService.Receive(r.Context(), token, req)
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(update)
+}
+
+// POST /stock/inventories
+func (h *StockHandler) Inventory(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.StockCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	update, err := h.stockService.Inventory(r.Context(), token, req)
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(update)
+}
+
+// GET /stock/pending_consumptions
+func (h *StockHandler) ListPendingConsumptions(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	pending, err := h.stockService.ListPendingConsumptions(r.Context(), token)
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"orders": pending,
+	})
+}
+
+// POST /stock/pending_consumptions/{order_id}
+func (h *StockHandler) ReplayConsumption(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	update, err := h.stockService.ReplayConsumption(r.Context(), token, chi.URLParam(r, "order_id"))
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(update)
+}
+
+func writeStockError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "component or order not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidStock):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrStockDisabled):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
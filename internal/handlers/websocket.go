@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket side of the event streams: events go out as text frames, the apps never send
+// data, only control frames (pong / close).
+
+const (
+	// wsWriteWait : time allowed to write one frame
+	wsWriteWait = 10 * time.Second
+	// wsPongWait : a client that doesn't answer two heartbeat pings is gone
+	wsPongWait = 2*streamHeartbeat + wsWriteWait
+	// wsReadLimit : clients only send control frames
+	wsReadLimit = 4096
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// the apps are native clients and the token is checked before the upgrade (never a cookie)
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func isWebSocketRequest(r *http.Request) bool {
+	return websocket.IsWebSocketUpgrade(r)
+}
+
+// wsReadLoop handles the control frames (ping / pong / close) and returns
+// when the client closes or stops answering the pings
+func wsReadLoop(conn *websocket.Conn) {
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+func wsWriteText(conn *websocket.Conn, payload []byte) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteMessage(websocket.TextMessage, payload)
+}
+
+func wsPing(conn *websocket.Conn) error {
+	return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+}
+
+// wsClose sends a normal close frame, the connection itself is closed by the caller
+func wsClose(conn *websocket.Conn) {
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteWait))
+}
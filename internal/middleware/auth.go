@@ -1 +1,141 @@
-package middleware
\ No newline at end of file
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/reqctx"
+)
+
+// MerchantHeader : optional, works on another merchant of the user for this request only
+const MerchantHeader = "X-Merchant-Id"
+
+// UserResolver : token -> user (UserRepository)
+type UserResolver interface {
+	GetUserByToken(ctx context.Context, token string) (*models.UserLoginRow, error)
+	GetUserForMerchant(ctx context.Context, userID, merchantID string) (*models.UserLoginRow, error)
+}
+
+// Permission : one users_rights flag
+type Permission string
+
+const (
+	PermReception      Permission = "access_wrreception"
+	PermDelivery       Permission = "access_wrdelivery"
+	PermWaiter         Permission = "access_wrwaiter"
+	PermCashReport     Permission = "print_merchant_cash_report"
+	PermOpenCashDrawer Permission = "open_cash_drawer"
+	PermReopenOrder    Permission = "reopen_order"
+	PermRefundPayment  Permission = "refund_payment"
+	PermManageUsers    Permission = "manage_users"
+	PermEditFloorPlan  Permission = "edit_floor_plan"
+	PermEditMenu       Permission = "edit_menu"
+)
+
+func (p Permission) grantedTo(u *models.UserLoginRow) bool {
+	switch p {
+	case PermReception:
+		return u.AccessReception
+	case PermDelivery:
+		return u.AccessDelivery
+	case PermWaiter:
+		return u.AccessWaiter
+	case PermCashReport:
+		return u.PrintMerchantCashReport
+	case PermOpenCashDrawer:
+		return u.OpenCashDrawer
+	case PermReopenOrder:
+		return u.ReopenOrder
+	case PermRefundPayment:
+		return u.RefundPayment
+	case PermManageUsers:
+		return u.ManageUsers
+	case PermEditFloorPlan:
+		return u.EditFloorPlan
+	case PermEditMenu:
+		return u.EditMenu
+	}
+	return false
+}
+
+// Authenticate resolves the token (see ExtractToken) once per request and stores the user
+// in the request context (reqctx). 401 when the token does not resolve to an enabled user.
+// With X-Merchant-Id the user is loaded with their rights on that merchant instead,
+// 403 when they have none there (same users_rights rows as GetMerchants).
+func Authenticate(users UserResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := GetToken(r)
+			if token == "" {
+				http.Error(w, "missing token", http.StatusUnauthorized)
+				return
+			}
+
+			user, err := users.GetUserByToken(r.Context(), token)
+			if err != nil || user == nil || !user.Enabled {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			if merchantID := r.Header.Get(MerchantHeader); merchantID != "" && merchantID != user.MerchantID {
+				selected, err := users.GetUserForMerchant(r.Context(), user.UserID, merchantID)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if selected == nil || !selected.Enabled {
+					http.Error(w, "not_allowed: merchant", http.StatusForbidden)
+					return
+				}
+				user = selected
+			}
+
+			next.ServeHTTP(w, r.WithContext(reqctx.WithUser(r.Context(), user)))
+		})
+	}
+}
+
+// Require : every permission is needed. Must run after Authenticate.
+func Require(perms ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := GetUser(r)
+			if user == nil {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			for _, p := range perms {
+				if !p.grantedTo(user) {
+					http.Error(w, "not_allowed: "+string(p), http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAny : one of the permissions is enough (e.g. any app access)
+func RequireAny(perms ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := GetUser(r)
+			if user == nil {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			for _, p := range perms {
+				if p.grantedTo(user) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "not_allowed", http.StatusForbidden)
+		})
+	}
+}
+
+// Helper: user resolved by Authenticate, nil outside of it
+func GetUser(r *http.Request) *models.UserLoginRow {
+	return reqctx.User(r.Context(), GetToken(r))
+}
@@ -1,15 +1,13 @@
 package middleware
 
 import (
-	"context"
 	"net/http"
 	"strings"
+	"welloresto-api/internal/reqctx"
 )
 
 type ctxKey string
 
-const TokenKey ctxKey = "authToken"
-
 // ExtractToken middleware: reads Authorization OR ?token=
 func ExtractToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -23,7 +21,7 @@ func ExtractToken(next http.Handler) http.Handler {
 			}
 			auth = strings.TrimSpace(auth)
 
-			ctx := context.WithValue(r.Context(), TokenKey, auth)
+			ctx := reqctx.WithToken(r.Context(), auth)
 			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
@@ -31,22 +29,18 @@ func ExtractToken(next http.Handler) http.Handler {
 		// 2. token passed as URL param
 		tokenParam := r.URL.Query().Get("token")
 		if tokenParam != "" {
-			ctx := context.WithValue(r.Context(), TokenKey, tokenParam)
+			ctx := reqctx.WithToken(r.Context(), tokenParam)
 			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
 		// 3. No token -> empty
-		ctx := context.WithValue(r.Context(), TokenKey, "")
+		ctx := reqctx.WithToken(r.Context(), "")
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
 // Helper: retrieves token anywhere
 func GetToken(r *http.Request) string {
-	token := r.Context().Value(TokenKey)
-	if token == nil {
-		return ""
-	}
-	return token.(string)
+	return reqctx.Token(r.Context())
 }
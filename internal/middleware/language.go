@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const LangKey ctxKey = "lang"
+
+// DefaultLang : the legacy labels (unit_of_measure_desc...) always exist in French
+const DefaultLang = "FR"
+
+// Language middleware: ?lang= OR Accept-Language, stored as an upper case code ("EN", "FR")
+func Language(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := parseLang(r.URL.Query().Get("lang"))
+		if lang == "" {
+			lang = parseAcceptLanguage(r.Header.Get("Accept-Language"))
+		}
+		if lang == "" {
+			lang = DefaultLang
+		}
+
+		ctx := context.WithValue(r.Context(), LangKey, lang)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LangFromContext : language of the request, DefaultLang outside of Language
+func LangFromContext(ctx context.Context) string {
+	if lang, ok := ctx.Value(LangKey).(string); ok && lang != "" {
+		return lang
+	}
+	return DefaultLang
+}
+
+// parseAcceptLanguage : "en-US,en;q=0.9,fr;q=0.8" -> "EN", highest q first, "" if none usable
+func parseAcceptLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, q := part, 1.0
+		if i := strings.Index(part, ";"); i >= 0 {
+			tag = part[:i]
+			if v := strings.TrimSpace(part[i+1:]); strings.HasPrefix(v, "q=") {
+				f, err := strconv.ParseFloat(v[2:], 64)
+				if err != nil {
+					continue
+				}
+				q = f
+			}
+		}
+		if lang := parseLang(tag); lang != "" && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// parseLang : primary subtag of a language tag ("pt-BR" -> "PT"), "" if not a language code
+func parseLang(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if len(tag) < 2 || len(tag) > 3 {
+		return ""
+	}
+	for _, c := range tag {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return ""
+		}
+	}
+	return strings.ToUpper(tag)
+}
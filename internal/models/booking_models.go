@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Table bookings (bookings + booked_location). Dates are UTC.
+
+type Booking struct {
+	BookingID     string            `json:"booking_id"`
+	BookingNumber *string           `json:"booking_number"`
+	Status        string            `json:"status"`
+	PartySize     int               `json:"party_size"`
+	Comment       *string           `json:"comment"`
+	DateFrom      time.Time         `json:"booking_date_from"`
+	DateTo        time.Time         `json:"booking_date_to"`
+	Duration      int               `json:"booking_duration"` // minutes
+	Customer      *Customer         `json:"customer"`
+	Locations     []BookingLocation `json:"locations"`
+}
+
+type BookingLocation struct {
+	LocationID   string `json:"location_id"`
+	LocationName string `json:"location_name"`
+	Seats        int    `json:"seats"`
+	FloorID      string `json:"floor_id"`
+}
+
+// BookingAvailability : free tables over [from, to) and a suggestion for the party
+type BookingAvailability struct {
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	PartySize  int               `json:"party_size"`
+	Available  bool              `json:"available"` // the free tables seat the party
+	FreeSeats  int               `json:"free_seats"`
+	Locations  []BookingLocation `json:"locations"`              // free tables
+	Suggestion []string          `json:"suggested_location_ids"` // fewest seats lost, empty when not available
+}
+
+type CreateBookingRequest struct {
+	CustomerID  int64      `json:"customer_id"`
+	PartySize   int        `json:"party_size"`
+	DateFrom    time.Time  `json:"booking_date_from"`
+	DateTo      *time.Time `json:"booking_date_to"`  // or booking_duration
+	Duration    int        `json:"booking_duration"` // minutes, default duration when both are missing
+	Comment     *string    `json:"comment"`
+	LocationIDs []string   `json:"location_ids"`
+	Status      string     `json:"status"` // PENDING (default) or ACCEPTED for a booking taken by the reception
+}
+
+type BookingStatusRequest struct {
+	Status string `json:"status"`
+}
+
+type BookingLocationsRequest struct {
+	LocationIDs []string `json:"location_ids"`
+}
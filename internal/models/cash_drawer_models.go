@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// Cash drawer — every amount is in cents, like orders.price
+
+type CashDrawerSession struct {
+	SessionID    string     `json:"session_id"`
+	DeviceID     *string    `json:"device_id"`
+	Status       string     `json:"status"`
+	OpenedBy     string     `json:"opened_by"`
+	OpenedAt     time.Time  `json:"opened_at"`
+	OpeningFloat int64      `json:"opening_float"`
+	ClosedBy     *string    `json:"closed_by"`
+	ClosedAt     *time.Time `json:"closed_at"`
+	CashPayments int64      `json:"cash_payments"`
+	CashIn       int64      `json:"cash_in"`
+	CashOut      int64      `json:"cash_out"`
+	ExpectedCash int64      `json:"expected_cash"` // opening_float + cash_payments + cash_in - cash_out
+	CountedCash  *int64     `json:"counted_cash"`
+	Difference   *int64     `json:"difference"` // counted - expected
+	DrawerOpens  int        `json:"drawer_opens"`
+	Notes        *string    `json:"notes"`
+
+	Movements []CashDrawerMovement `json:"movements"`
+}
+
+type CashDrawerMovement struct {
+	MovementID string    `json:"movement_id"`
+	Type       string    `json:"type"` // DRAWER_OPEN, CASH_IN, CASH_OUT
+	Amount     int64     `json:"amount"`
+	Reason     *string   `json:"reason"`
+	UserID     string    `json:"user_id"`
+	DeviceID   *string   `json:"device_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type OpenCashDrawerSessionRequest struct {
+	OpeningFloat int64  `json:"opening_float"`
+	DeviceID     string `json:"device_id"`
+}
+
+type CashDrawerMovementRequest struct {
+	Type     string `json:"type"` // CASH_IN | CASH_OUT
+	Amount   int64  `json:"amount"`
+	Reason   string `json:"reason"`
+	DeviceID string `json:"device_id"`
+}
+
+type CloseCashDrawerSessionRequest struct {
+	CountedCash int64  `json:"counted_cash"`
+	Notes       string `json:"notes"`
+}
+
+// ZReport : end of day report (merchant time zone)
+type ZReport struct {
+	Date          string              `json:"date"`
+	From          time.Time           `json:"from"`
+	To            time.Time           `json:"to"`
+	OrdersCount   int                 `json:"orders_count"`
+	CanceledCount int                 `json:"canceled_count"`
+	TTC           int64               `json:"TTC"`
+	TVA           int64               `json:"TVA"`
+	HT            int64               `json:"HT"`
+	Payments      []MOPTotal          `json:"payments"`
+	PaymentsTotal int64               `json:"payments_total"`
+	Sessions      []CashDrawerSession `json:"sessions"`
+	CashIn        int64               `json:"cash_in"`
+	CashOut       int64               `json:"cash_out"`
+	Difference    int64               `json:"difference"` // sum of the closed sessions differences
+}
+
+// MOPTotal : enabled payments of one means of payment
+type MOPTotal struct {
+	MOP    string `json:"mop"`
+	Count  int    `json:"count"`
+	Amount int64  `json:"amount"`
+}
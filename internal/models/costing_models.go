@@ -0,0 +1,73 @@
+package models
+
+// Recipe costing — amounts in cents, like products.price. Margins are computed on the
+// price excl. TVA, rates in percent.
+
+type ProductCost struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name"`
+	Category  *string `json:"category"`
+
+	Cost     int64 `json:"cost"`     // recipe, without options
+	Complete bool  `json:"complete"` // false: no recipe, a component has no cost, or its quantity can't be converted
+
+	Components  []ComponentCost `json:"components"`
+	Attributes  []AttributeCost `json:"attributes"`
+	Channels    []ChannelMargin `json:"channels"`     // the channels the product is sold on
+	UnderTarget bool            `json:"under_target"` // on a channel, with or without options
+}
+
+type ComponentCost struct {
+	ComponentID string   `json:"component_id"`
+	Name        string   `json:"name"`
+	Quantity    float64  `json:"quantity"`
+	Unit        string   `json:"unit"`      // label, in the language of the request
+	UnitCode    *string  `json:"unit_code"` // see internal/units
+	CostPrice   *int64   `json:"cost_price"`
+	CostUnit    *string  `json:"cost_unit"`
+	Cost        *float64 `json:"cost"` // nil when it can't be computed
+}
+
+type AttributeCost struct {
+	AttributeID string       `json:"attribute_id"`
+	Title       string       `json:"title"`
+	MinOptions  int          `json:"min_options"`
+	MaxOptions  int          `json:"max_options"`
+	Options     []OptionCost `json:"options"`
+}
+
+type OptionCost struct {
+	OptionID    string `json:"option_id"`
+	Title       string `json:"title"`
+	ExtraPrice  int64  `json:"extra_price"`
+	MaxQuantity int    `json:"max_quantity"`
+	Cost        *int64 `json:"cost"`
+}
+
+// ChannelMargin : ON_SITE, TAKE_AWAY, DELIVERY. Worst* : with the options that bring the
+// least margin (required ones at least), see services.worstOptions
+type ChannelMargin struct {
+	Channel         string   `json:"channel"`
+	Price           int64    `json:"price"`
+	TVARate         float64  `json:"tva_rate"`
+	PriceHT         int64    `json:"price_ht"`
+	Margin          int64    `json:"margin"`
+	MarginRate      *float64 `json:"margin_rate"` // nil for a free product
+	WorstMargin     int64    `json:"worst_margin"`
+	WorstMarginRate *float64 `json:"worst_margin_rate"`
+	UnderTarget     bool     `json:"under_target"`
+}
+
+type MarginReport struct {
+	TargetMargin     float64       `json:"target_margin"`
+	ProductsCount    int           `json:"products_count"`
+	UnderTargetCount int           `json:"under_target_count"`
+	IncompleteCount  int           `json:"incomplete_count"`
+	Products         []ProductCost `json:"products"`
+}
+
+// CostRequest : nil fields are left untouched
+type CostRequest struct {
+	CostPrice *int64  `json:"cost_price"`
+	CostUnit  *string `json:"cost_unit"` // components only
+}
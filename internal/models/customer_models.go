@@ -0,0 +1,67 @@
+package models
+
+// Customer directory (GET /customers/...). JSON names follow the customer block of an order.
+
+type CustomerProfile struct {
+	CustomerID         int64    `json:"customer_id"`
+	Name               *string  `json:"customer_name"`
+	Tel                *string  `json:"customer_tel"`
+	TemporaryPhone     *string  `json:"customer_temporary_phone"`
+	TemporaryPhoneCode *string  `json:"customer_temporary_phone_code"`
+	ZoneCode           *string  `json:"customer_zone_code"`
+	BusinessName       *string  `json:"customer_business_name"`
+	Birthdate          *string  `json:"customer_birthdate"`
+	AdditionalInfo     *string  `json:"customer_additional_info"`
+	NbOrders           int      `json:"customer_nb_orders"`
+	Address            *string  `json:"customer_address"` // default address
+	Lat                *float64 `json:"customer_lat"`
+	Lng                *float64 `json:"customer_lng"`
+	FloorNumber        *string  `json:"customer_floor_number"`
+	DoorNumber         *string  `json:"customer_door_number"`
+	AdditionalAddress  *string  `json:"customer_additional_address"`
+
+	// GET /customers/{customer_id} only
+	Addresses        []CustomerAddress   `json:"addresses,omitempty"`
+	Orders           []OrderHistoryEntry `json:"orders,omitempty"`             // latest first
+	OrdersNextCursor *string             `json:"orders_next_cursor,omitempty"` // GET /orders/history?customer_id=&state=...&cursor=
+}
+
+type CustomerAddress struct {
+	AddressID         string   `json:"address_id"`
+	Label             *string  `json:"label"`
+	Address           string   `json:"address"`
+	Lat               *float64 `json:"lat"`
+	Lng               *float64 `json:"lng"`
+	FloorNumber       *string  `json:"floor_number"`
+	DoorNumber        *string  `json:"door_number"`
+	AdditionalAddress *string  `json:"additional_address"`
+	ZoneCode          *string  `json:"zone_code"`
+	IsDefault         bool     `json:"is_default"`
+}
+
+// CustomerRequest : POST /customers, PATCH /customers/{customer_id} (only the fields sent are updated)
+type CustomerRequest struct {
+	Name               *string `json:"customer_name"`
+	Tel                *string `json:"customer_tel"`
+	TemporaryPhone     *string `json:"customer_temporary_phone"`
+	TemporaryPhoneCode *string `json:"customer_temporary_phone_code"`
+	ZoneCode           *string `json:"customer_zone_code"`
+	BusinessName       *string `json:"customer_business_name"`
+	Birthdate          *string `json:"customer_birthdate"`
+	AdditionalInfo     *string `json:"customer_additional_info"`
+
+	Address *CustomerAddressRequest `json:"address"` // POST only: first address, it becomes the default one
+}
+
+// CustomerAddressRequest : POST / PATCH /customers/{customer_id}/addresses (only the fields sent are updated)
+type CustomerAddressRequest struct {
+	Label             *string  `json:"label"`
+	Address           *string  `json:"address"`
+	Lat               *float64 `json:"lat"`
+	Lng               *float64 `json:"lng"`
+	FloorNumber       *string  `json:"floor_number"`
+	DoorNumber        *string  `json:"door_number"`
+	AdditionalAddress *string  `json:"additional_address"`
+	ZoneCode          *string  `json:"zone_code"`
+	IsDefault         *bool    `json:"is_default"`
+}
@@ -0,0 +1,52 @@
+package models
+
+// Floor plan (floors, floor_areas, locations geometry), as drawn by the reception tablet
+
+type Floor struct {
+	FloorID string       `json:"id"`
+	Name    string       `json:"name"`
+	Areas   []Area       `json:"areas"`
+	Tables  []FloorTable `json:"tables"`
+}
+
+// Area : a zone drawn on the floor (terrace, bar...)
+type Area struct {
+	AreaID      string    `json:"id"`
+	FloorID     string    `json:"floor_id"`
+	Name        string    `json:"name"`
+	Points      []float64 `json:"points"` // polygon, flat [x1, y1, x2, y2, ...] relative to x / y
+	X           float64   `json:"x"`
+	Y           float64   `json:"y"`
+	Angle       float64   `json:"angle"`
+	StrokeColor *string   `json:"stroke_color"`
+	Color       *string   `json:"color"`
+}
+
+// FloorTable : a row of locations with its geometry
+type FloorTable struct {
+	LocationID   string  `json:"location_id"`
+	LocationName string  `json:"location_name"`
+	LocationDesc *string `json:"location_desc"`
+	Seats        int     `json:"seats"`
+	Order        int     `json:"location_order"`
+	FloorID      string  `json:"floor_id"`
+	Shape        string  `json:"shape"`
+	X            float64 `json:"current_x"`
+	Y            float64 `json:"current_y"`
+	Width        float64 `json:"current_width"`
+	Height       float64 `json:"current_height"`
+	Angle        float64 `json:"angle"`
+}
+
+type FloorRequest struct {
+	Name string `json:"name"`
+}
+
+// FloorLayoutRequest : PUT /floors/{floor_id}/layout, the whole floor at once.
+// Areas / tables with an id are updated, without one they are created, the floor's
+// ones missing from the lists are removed.
+type FloorLayoutRequest struct {
+	Name   *string      `json:"name"`
+	Areas  []Area       `json:"areas"`
+	Tables []FloorTable `json:"tables"`
+}
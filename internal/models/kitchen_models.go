@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Kitchen display (KDS)
+
+type KitchenItem struct {
+	OrderID                      string     `json:"order_id"`
+	OrderNum                     *string    `json:"order_num"`
+	OrderType                    *string    `json:"order_type"`
+	OrderItemID                  string     `json:"order_item_id"`
+	ProductID                    string     `json:"product_id"`
+	Name                         string     `json:"name"`
+	Category                     *string    `json:"category"`
+	ProductionColor              *string    `json:"production_color"`
+	Quantity                     int        `json:"quantity"`
+	ProductionStatus             string     `json:"production_status"`
+	ProductionStatusDoneQuantity int        `json:"production_status_done_quantity"`
+	ReadyForDistributionQuantity int        `json:"ready_for_distribution_quantity"`
+	DistributedQuantity          int        `json:"distributed_quantity"`
+	OrderedOn                    *time.Time `json:"ordered_on"`
+	ElapsedSeconds               int64      `json:"elapsed_seconds"`
+	IsPaid                       bool       `json:"isPaid"`
+	Extra                        []string   `json:"extra"`
+	Without                      []string   `json:"without"`
+	Comment                      *string    `json:"comment"`
+}
+
+type KitchenGroup struct {
+	Key   string        `json:"key"`
+	Label string        `json:"label"`
+	Items []KitchenItem `json:"items"`
+}
+
+type KitchenResponse struct {
+	GroupBy    string         `json:"group_by"`
+	ServerTime time.Time      `json:"server_time"`
+	Groups     []KitchenGroup `json:"groups"`
+}
+
+type KitchenItemStatusRequest struct {
+	Status   string `json:"status"`
+	Quantity int    `json:"quantity"` // 0 = everything that can move
+}
@@ -95,7 +95,16 @@ type ComponentUsage struct {
 	Price         int64   `json:"price"`
 	Status        int     `json:"status"`
 	Quantity      float64 `json:"quantity"`
-	UnitOfMeasure string  `json:"unit_of_measure"`
+	UnitOfMeasure string  `json:"unit_of_measure"`     // label, in the language of the request
+	UnitCode      string  `json:"unit_code,omitempty"` // g, kg, ml, cl, l, piece: see internal/units
+}
+
+// UnitOfMeasure : requires.unit_of_measure, Code / Dimension nil when it can't be converted
+type UnitOfMeasure struct {
+	ID        string  `json:"id"`
+	Label     string  `json:"label"`
+	Code      *string `json:"code"`
+	Dimension *string `json:"dimension"` // MASS, VOLUME, COUNT
 }
 
 // component category
@@ -146,3 +155,71 @@ type DelayEntry struct {
 	ShortDescription string `json:"short_description"`
 	Duration         int    `json:"duration"`
 }
+
+// MenuCategory : a row of productcateg, as edited through /menu/categories
+type MenuCategory struct {
+	CategoryID string  `json:"category_id"`
+	Name       string  `json:"category"`
+	Order      int     `json:"order"`
+	BgColor    *string `json:"bg_color"`
+	Available  bool    `json:"available"`
+}
+
+// CategoryRequest : POST / PATCH /menu/categories (only the fields sent are updated)
+type CategoryRequest struct {
+	Name      *string `json:"category"`
+	Order     *int    `json:"order"`
+	BgColor   *string `json:"bg_color"`
+	Available *bool   `json:"available"`
+}
+
+// ProductRequest : POST / PATCH /menu/products (only the fields sent are updated).
+// Prices are per channel (on site, take away, delivery), like the TVA categories.
+type ProductRequest struct {
+	Name           *string `json:"name"`
+	CategoryID     *string `json:"category_id"`
+	ByProductOf    *string `json:"by_product_of"` // parent product group, "" = none
+	IsProductGroup *bool   `json:"is_product_group"`
+	Description    *string `json:"description"`
+	BgColor        *string `json:"bg_color"`
+	ImageURL       *string `json:"image_url"`
+
+	Price         *int64 `json:"price"`
+	PriceTakeAway *int64 `json:"price_take_away"`
+	PriceDelivery *int64 `json:"price_delivery"`
+
+	TVAInID       *int64 `json:"tva_in_id"`
+	TVATakeAwayID *int64 `json:"tva_take_away_id"`
+	TVADeliveryID *int64 `json:"tva_delivery_id"`
+
+	AvailableIn       *bool `json:"available_in"`
+	AvailableTakeAway *bool `json:"available_take_away"`
+	AvailableDelivery *bool `json:"available_delivery"`
+	IsAvailableOnSNO  *bool `json:"is_available_on_sno"`
+	IsPopular         *bool `json:"is_popular"`
+}
+
+// AvailabilityRequest : PATCH /menu/products/{product_id}/availability, /menu/components/{component_id}/availability
+type AvailabilityRequest struct {
+	Available *bool `json:"available"`
+}
+
+// AvailabilityChange : what a toggle changed, pushed to the apps as a menu.availability event
+type AvailabilityChange struct {
+	Available    bool     `json:"available"`
+	ProductIDs   []string `json:"product_ids"`
+	ComponentIDs []string `json:"component_ids"`
+}
+
+// AvailabilitySync : one product availability waiting to be pushed to a delivery platform
+// (integration_availability_outbox), with the store it goes to
+type AvailabilitySync struct {
+	ID             int64  `json:"id"`
+	MerchantID     string `json:"merchant_id"`
+	Integration    string `json:"integration"`
+	ItemID         string `json:"item_id"`          // products.product_id
+	ExternalItemID string `json:"external_item_id"` // item id on the platform (integration_item_mapping, else ItemID)
+	Available      bool   `json:"available"`
+	StoreID        string `json:"store_id"`
+	BearerToken    string `json:"-"`
+}
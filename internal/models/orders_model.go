@@ -29,12 +29,12 @@ type Location struct {
 	Seats        int            `json:"seats"`
 	Order        int            `json:"order"`
 	FloorID      string         `json:"floor_id"`
-	Shape        sql.NullString `json:"location_desc"`
-	X            sql.NullString `json:"location_desc"`
-	Y            sql.NullString `json:"location_desc"`
-	W            sql.NullString `json:"location_desc"`
-	H            sql.NullString `json:"location_desc"`
-	Angle        sql.NullString `json:"location_desc"`
+	Shape        sql.NullString `json:"-"` // geometry: see FloorTable
+	X            sql.NullString `json:"-"`
+	Y            sql.NullString `json:"-"`
+	W            sql.NullString `json:"-"`
+	H            sql.NullString `json:"-"`
+	Angle        sql.NullString `json:"-"`
 	OpenOrderID  sql.NullString `json:"open_order_id"`
 	Available    string         `json:"available"`
 }
@@ -46,15 +46,6 @@ type SeatingPlan struct {
 	Bookings  []Booking  `json:"bookings"`
 }
 
-type Booking struct {
-}
-
-type Area struct {
-}
-
-type Floor struct {
-}
-
 type Customer struct {
 	CustomerID                 *int64   `json:"customer_id"`
 	CustomerName               *string  `json:"customer_name"`
@@ -121,15 +112,52 @@ type OrderUser struct {
 }
 
 type DeliverySession struct {
-	DeliverySessionID string    `json:"delivery_session_id"`
-	Status            string    `json:"status"`
-	Orders            []Order   `json:"orders"`
-	DeliveryMan       OrderUser `json:"delivery_man"`
+	DeliverySessionID string         `json:"delivery_session_id"`
+	Status            string         `json:"status"`
+	Orders            []Order        `json:"orders"`
+	DeliveryMan       OrderUser      `json:"delivery_man"`
+	PositionAt        *time.Time     `json:"position_at"` // last GPS fix of the delivery man
+	Stops             []DeliveryStop `json:"stops"`
+}
+
+// DeliveryStop : remaining stop of a session, in priority order
+type DeliveryStop struct {
+	OrderID          string     `json:"order_id"`
+	Priority         int64      `json:"priority"`
+	DistanceMeters   *int64     `json:"distance_meters"` // from the previous stop (or the driver for the first one)
+	ETASeconds       *int64     `json:"eta_seconds"`
+	EstimatedArrival *time.Time `json:"estimated_arrival"`
+}
+
+// OrderHistoryEntry : light projection of an order for the history list
+type OrderHistoryEntry struct {
+	OrderID        string    `json:"order_id"`
+	OrderNum       *string   `json:"order_num"`
+	OrderType      *string   `json:"order_type"`
+	State          *string   `json:"state"`
+	Brand          *string   `json:"brand"`
+	BrandOrderNum  *string   `json:"brand_order_num"`
+	MeansOfPayment *string   `json:"means_of_payement"`
+	TTC            int64     `json:"TTC"`
+	IsPaid         bool      `json:"isPaid"`
+	CreationDate   time.Time `json:"creation_date"`
+	CustomerID     *int64    `json:"customer_id"`
+	CustomerName   *string   `json:"customer_name"`
+	LocationNames  *string   `json:"location_names"` // tables, comma separated
+}
+
+type OrderHistoryPage struct {
+	Orders     []OrderHistoryEntry `json:"orders"`
+	Details    []Order             `json:"details,omitempty"` // ?expand=1 : full order trees, same order as Orders
+	NextCursor *string             `json:"next_cursor"`       // nil on the last page
 }
 
 type PendingOrdersResponse struct {
+	Status           string            `json:"status,omitempty"`
+	SyncTimestamp    *time.Time        `json:"sync_timestamp,omitempty"` // send it back as ?since= for the next delta
 	Orders           []Order           `json:"orders"`
 	DeliverySessions []DeliverySession `json:"delivery_sessions"`
+	RemovedOrderIDs  []string          `json:"removed_order_ids,omitempty"`
 	Timings          interface{}       `json:"timings,omitempty"`
 }
 
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// CashReport : merchant cash report over [from, to), amounts in cents
+type CashReport struct {
+	From          time.Time        `json:"from"`
+	To            time.Time        `json:"to"`
+	TimeZone      string           `json:"timezone"`
+	Payments      []MOPTotal       `json:"payments"`
+	PaymentsTotal int64            `json:"payments_total"`
+	OrderTypes    []OrderTypeTotal `json:"order_types"`
+	TVARates      []TVARateTotal   `json:"tva_rates"`
+	DeliveryFees  int64            `json:"delivery_fees"` // included in TTC / HT, no TVA recorded on them
+	OrdersCount   int              `json:"orders_count"`
+	TTC           int64            `json:"TTC"`
+	TVA           int64            `json:"TVA"`
+	HT            int64            `json:"HT"`
+}
+
+type OrderTypeTotal struct {
+	OrderType string `json:"order_type"`
+	Count     int    `json:"count"`
+	TTC       int64  `json:"TTC"`
+	TVA       int64  `json:"TVA"`
+	HT        int64  `json:"HT"`
+}
+
+// TVARateTotal : order items sold at one TVA rate (delivery fees are not items, see CashReport.DeliveryFees)
+type TVARateTotal struct {
+	Rate float64 `json:"rate"`
+	TTC  int64   `json:"TTC"`
+	TVA  int64   `json:"TVA"`
+	HT   int64   `json:"HT"`
+}
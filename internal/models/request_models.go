@@ -1,6 +1,65 @@
 package models
 
+import "time"
+
 type OrderHistoryRequest struct {
 	DateFrom string `json:"date_from"`
 	DateTo   string `json:"date_to"`
 }
+
+// OrderHistoryQuery : GET /orders/history, empty fields are not filtered on
+type OrderHistoryQuery struct {
+	States     []string
+	OrderTypes []string
+	Brands     []string
+	MOPs       []string
+	CustomerID string
+	LocationID string
+	MinTTC     *int64
+	MaxTTC     *int64
+	From       *time.Time
+	To         *time.Time
+	App        string
+	Cursor     string // next_cursor of the previous page
+	Limit      int
+	Expand     bool // full order trees of the page as well
+}
+
+type OrderStateRequest struct {
+	State string `json:"state"`
+}
+
+type AddPaymentRequest struct {
+	MOP    string               `json:"mop"`
+	Amount int64                `json:"amount"` // cents, optional with items
+	Items  []PaymentItemRequest `json:"items"`
+}
+
+// PaymentItemRequest : split bill, pay only some quantities of some order items
+type PaymentItemRequest struct {
+	OrderItemID string `json:"order_item_id"`
+	Quantity    int    `json:"quantity"`
+}
+
+type CreateDeliverySessionRequest struct {
+	UserID   string   `json:"user_id"` // driver
+	OrderIDs []string `json:"order_ids"`
+}
+
+type DeliverySessionOrderRequest struct {
+	OrderID string `json:"order_id"`
+}
+
+type DeliverySessionPriorityRequest struct {
+	OrderIDs []string `json:"order_ids"` // first = first stop
+}
+
+type DeliverySessionStatusRequest struct {
+	Status string `json:"status"`
+}
+
+type DriverPositionRequest struct {
+	Lat        float64    `json:"lat"`
+	Lng        float64    `json:"lng"`
+	RecordedAt *time.Time `json:"recorded_at"` // device time, server time if missing
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Stock — quantities are per component, in its stock unit (or the unit of its recipes when not set)
+
+type StockComponent struct {
+	ComponentID      string   `json:"component_id"`
+	Name             string   `json:"name"`
+	CategoryID       *string  `json:"category_id"`
+	Status           int      `json:"status"` // 1 available, 0 out
+	StockQuantity    float64  `json:"stock_quantity"`
+	StockUnit        *string  `json:"stock_unit"` // nil: the unit of its recipes
+	SafetyStock      *float64 `json:"safety_stock"`
+	ExtraQuantity    *float64 `json:"extra_quantity"`
+	BelowSafetyStock bool     `json:"below_safety_stock"`
+}
+
+type StockMovement struct {
+	MovementID    string    `json:"movement_id"`
+	ComponentID   string    `json:"component_id"`
+	ComponentName string    `json:"component_name"`
+	Type          string    `json:"type"`     // CONSUMPTION, RECEPTION, INVENTORY
+	Quantity      float64   `json:"quantity"` // signed delta
+	StockAfter    float64   `json:"stock_after"`
+	OrderID       *string   `json:"order_id"`
+	OrderItemID   *string   `json:"order_item_id"`
+	UserID        *string   `json:"user_id"`
+	Comment       *string   `json:"comment"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type StockMovementFilter struct {
+	ComponentID string
+	Type        string
+	From        *time.Time
+	To          *time.Time
+	Limit       int
+}
+
+// StockComponentRequest : nil fields are left untouched. Changing the stock unit converts
+// the quantities already set, the new ones are in the new unit. Setting the first stock unit
+// of a component converts nothing: the current quantities are taken as in that unit.
+type StockComponentRequest struct {
+	StockUnit     *string  `json:"stock_unit"`
+	SafetyStock   *float64 `json:"safety_stock"`
+	ExtraQuantity *float64 `json:"extra_quantity"`
+}
+
+type StockItemRequest struct {
+	ComponentID string  `json:"component_id"`
+	Quantity    float64 `json:"quantity"` // received (reception) or counted (inventory)
+}
+
+// StockCountRequest : a delivery received, or an inventory count
+type StockCountRequest struct {
+	Items   []StockItemRequest `json:"items"`
+	Comment string             `json:"comment"`
+}
+
+// StockUpdate : the components a reception / inventory / consumption touched,
+// and what the safety stock took out / brought back (one change per direction)
+type StockUpdate struct {
+	Components   []StockComponent     `json:"components"`
+	Availability []AvailabilityChange `json:"availability"`
+}
+
+// PendingStockConsumption : an order whose units were not all taken out of the stock
+// (a failed consumption), replayed by POST /stock/pending_consumptions/{order_id}
+type PendingStockConsumption struct {
+	OrderID      string    `json:"order_id"`
+	State        string    `json:"state"`
+	CreationDate time.Time `json:"creation_date"`
+	Units        int64     `json:"units"` // order item units still to consume
+}
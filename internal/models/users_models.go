@@ -28,6 +28,11 @@ type UserLoginRow struct {
 	AccessWaiter            bool
 	PrintMerchantCashReport bool
 	OpenCashDrawer          bool
+	ReopenOrder             bool
+	ManageUsers             bool
+	RefundPayment           bool
+	EditFloorPlan           bool
+	EditMenu                bool
 	MerchantID              string
 
 	// merchant
@@ -88,3 +93,11 @@ type MerchantRow struct {
 	Country  string
 	ZipCode  string
 }
+
+// UserCredentials : what is needed to check a password, legacy column included
+type UserCredentials struct {
+	UserID         string
+	LegacyPassword sql.NullString // users.password : AES-ECB (PHP) or plain text
+	PasswordHash   sql.NullString
+	PasswordAlgo   sql.NullString
+}
@@ -0,0 +1,192 @@
+package repositories
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+	"welloresto-api/internal/models"
+)
+
+// slideEvery : expires_at is pushed back at most once per period, not on every request
+const slideEvery = 5 * time.Minute
+
+// CreateSession issues a new token for the user on this device; the previous tokens of
+// the same device are revoked (one live session per user and device).
+func (r *UserRepository) CreateSession(ctx context.Context, userID, deviceID, app string) (string, time.Time, error) {
+	return r.createSession(ctx, userID, deviceID, app, r.sessionTTL, true)
+}
+
+// CreatePinSession : short-lived token for a staff member switching in by PIN, it does not slide
+func (r *UserRepository) CreatePinSession(ctx context.Context, userID, deviceID string, ttl time.Duration) (string, time.Time, error) {
+	return r.createSession(ctx, userID, deviceID, "PIN", ttl, false)
+}
+
+func (r *UserRepository) createSession(ctx context.Context, userID, deviceID, app string, ttl time.Duration, sliding bool) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(raw)
+	expiresAt := time.Now().UTC().Add(ttl).Truncate(time.Second)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if deviceID != "" {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE auth_tokens SET revoked_at = UTC_TIMESTAMP()
+			WHERE user_id = ? AND device_id = ? AND revoked_at IS NULL
+		`, userID, deviceID); err != nil {
+			tx.Rollback()
+			return "", time.Time{}, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO auth_tokens (token_hash, user_id, device_id, app, created_at, last_used_at, expires_at, sliding)
+		VALUES (?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?, ?)
+	`, hashToken(token), userID, nullIfEmpty(deviceID), nullIfEmpty(app), expiresAt, sliding); err != nil {
+		tx.Rollback()
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, tx.Commit()
+}
+
+// GetUserBySessionToken returns nil, nil when the token is unknown, expired or revoked.
+// The user comes with their rights on the merchant selected for the session (home one by default).
+// A valid token gets its expiry pushed back (sliding expiry).
+func (r *UserRepository) GetUserBySessionToken(ctx context.Context, token string) (*models.UserLoginRow, error) {
+	hash := hashToken(token)
+
+	var userID string
+	var merchantID sql.NullString
+	err := r.db.QueryRowContext(ctx, `
+		SELECT user_id, merchant_id FROM auth_tokens
+		WHERE token_hash = ? AND revoked_at IS NULL AND expires_at > UTC_TIMESTAMP()
+	`, hash).Scan(&userID, &merchantID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data *models.UserLoginRow
+	if merchantID.Valid {
+		data, err = r.GetUserForMerchant(ctx, userID, merchantID.String)
+	} else {
+		data, err = r.GetUserByID(ctx, userID)
+	}
+	// rights retirés depuis le switch : la session ne vaut plus rien
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE auth_tokens
+		SET last_used_at = UTC_TIMESTAMP(), expires_at = UTC_TIMESTAMP() + INTERVAL ? SECOND
+		WHERE token_hash = ? AND sliding = 1 AND last_used_at < UTC_TIMESTAMP() - INTERVAL ? SECOND
+	`, int64(r.sessionTTL.Seconds()), hash, int64(slideEvery.Seconds()))
+	return data, err
+}
+
+// SetSessionMerchant selects the merchant the session works on, "" goes back to the home merchant
+func (r *UserRepository) SetSessionMerchant(ctx context.Context, token, merchantID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE auth_tokens SET merchant_id = ? WHERE token_hash = ? AND revoked_at IS NULL
+	`, nullIfEmpty(merchantID), hashToken(token))
+	return err
+}
+
+// GetSessionMerchant : merchant selected on the session, "" for the home merchant
+func (r *UserRepository) GetSessionMerchant(ctx context.Context, token string) (string, error) {
+	var merchantID sql.NullString
+	err := r.db.QueryRowContext(ctx, `
+		SELECT merchant_id FROM auth_tokens WHERE token_hash = ?
+	`, hashToken(token)).Scan(&merchantID)
+	return merchantID.String, err
+}
+
+// GetSessionDevice : device and app the token was issued for (refresh keeps them), and
+// whether it slides (false for PIN sessions)
+func (r *UserRepository) GetSessionDevice(ctx context.Context, token string) (string, string, bool, error) {
+	var deviceID, app sql.NullString
+	var sliding sql.NullBool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT device_id, app, sliding FROM auth_tokens WHERE token_hash = ?
+	`, hashToken(token)).Scan(&deviceID, &app, &sliding)
+	return deviceID.String, app.String, sliding.Bool, err
+}
+
+// RevokeSession : false when the token was not an active session
+func (r *UserRepository) RevokeSession(ctx context.Context, token string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE auth_tokens SET revoked_at = UTC_TIMESTAMP() WHERE token_hash = ? AND revoked_at IS NULL
+	`, hashToken(token))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// RevokeUserSessions revokes every active token of the user, returns how many
+func (r *UserRepository) RevokeUserSessions(ctx context.Context, userID string) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE auth_tokens SET revoked_at = UTC_TIMESTAMP() WHERE user_id = ? AND revoked_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// UserBelongsToMerchant : the user's rights row is on this merchant
+func (r *UserRepository) UserBelongsToMerchant(ctx context.Context, userID, merchantID string) (bool, error) {
+	var exists int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT 1 FROM users u
+		INNER JOIN users_rights ur ON ur.id = u.access_id
+		WHERE u.user_id = ? AND ur.merchant_id = ?
+	`, userID, merchantID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// hashToken : only the SHA-256 of a token is stored, a DB dump does not give live sessions
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindStaffByPin returns the enabled users of the merchant with this PIN (more than one = ambiguous PIN)
+func (r *UserRepository) FindStaffByPin(ctx context.Context, merchantID, pin string) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.user_id FROM users u
+		INNER JOIN users_rights ur ON ur.id = u.access_id
+		WHERE ur.merchant_id = ? AND u.pin_code = ? AND u.enabled = 1
+		LIMIT 2
+	`, merchantID, pin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// integration_availability_outbox.integration, Uber Eats only: Deliveroo is out of scope
+// (see queueAvailabilitySync)
+const IntegrationUberEats = "UBER_EATS"
+
+// maxAvailabilityAttempts : a change still refused after that many pushes is given up
+const maxAvailabilityAttempts = 10
+
+type AvailabilityOutboxRepository struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewAvailabilityOutboxRepository(db *sql.DB, log *zap.Logger) *AvailabilityOutboxRepository {
+	return &AvailabilityOutboxRepository{db: db, log: log}
+}
+
+// PendingAvailability : the latest pending change of each product, oldest first. The older
+// ones of the same product are outdated, MarkAvailabilitySent closes them with it.
+// The platform item id comes from integration_item_mapping, the product_id without a mapping.
+func (r *AvailabilityOutboxRepository) PendingAvailability(ctx context.Context, limit int) ([]models.AvailabilitySync, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT o.id, o.merchant_id, o.integration, o.item_id, COALESCE(im.external_id, o.item_id), o.available,
+		       iue.store_id, iue.bearer_token
+		FROM integration_availability_outbox o
+		INNER JOIN integration_uber_eats iue ON iue.merchant_id = o.merchant_id AND iue.enabled = 1
+		LEFT JOIN integration_item_mapping im
+		       ON im.merchant_id = o.merchant_id AND im.integration = o.integration AND im.product_id = o.item_id
+		WHERE o.integration = ? AND o.sent_at IS NULL AND o.attempts < ?
+		  AND iue.store_id IS NOT NULL AND iue.bearer_token IS NOT NULL
+		  AND o.id = (
+		      SELECT MAX(o2.id) FROM integration_availability_outbox o2
+		      WHERE o2.integration = o.integration AND o2.merchant_id = o.merchant_id
+		        AND o2.item_id = o.item_id AND o2.sent_at IS NULL
+		  )
+		ORDER BY o.id
+		LIMIT ?`, IntegrationUberEats, maxAvailabilityAttempts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.AvailabilitySync{}
+	for rows.Next() {
+		var s models.AvailabilitySync
+		if err := rows.Scan(&s.ID, &s.MerchantID, &s.Integration, &s.ItemID, &s.ExternalItemID, &s.Available, &s.StoreID, &s.BearerToken); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// MarkAvailabilitySent closes the change and the older pending ones of the same product
+func (r *AvailabilityOutboxRepository) MarkAvailabilitySent(ctx context.Context, s models.AvailabilitySync) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE integration_availability_outbox SET sent_at = UTC_TIMESTAMP()
+		WHERE integration = ? AND merchant_id = ? AND item_id = ? AND sent_at IS NULL AND id <= ?
+	`, s.Integration, s.MerchantID, s.ItemID, s.ID)
+	return err
+}
+
+// MarkAvailabilityFailed counts a refused / failed push, retried until maxAvailabilityAttempts
+func (r *AvailabilityOutboxRepository) MarkAvailabilityFailed(ctx context.Context, id int64, reason string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE integration_availability_outbox SET attempts = attempts + 1, last_error = LEFT(?, 255)
+		WHERE id = ?
+	`, reason, id)
+	return err
+}
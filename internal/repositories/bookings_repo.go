@@ -0,0 +1,363 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// activeBookingStatuses : bookings that hold their tables
+const activeBookingStatuses = "'PENDING','ACCEPTED'"
+
+var (
+	// ErrTableUnavailable : a table is already held by another booking over the same time range
+	ErrTableUnavailable = errors.New("table unavailable")
+	// ErrNotEnoughSeats : the tables don't seat the party
+	ErrNotEnoughSeats = errors.New("not enough seats")
+	// ErrBookingStatusConflict : the booking changed status concurrently, or no longer holds tables
+	ErrBookingStatusConflict = errors.New("booking status changed concurrently")
+)
+
+type BookingsRepository struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewBookingsRepository(db *sql.DB, log *zap.Logger) *BookingsRepository {
+	return &BookingsRepository{db: db, log: log}
+}
+
+// ListBookings : bookings overlapping [from, to), any status when statuses is empty
+func (r *BookingsRepository) ListBookings(ctx context.Context, merchantID string, from, to time.Time, statuses []string) ([]models.Booking, error) {
+	r.log.Info("ListBookings START", zap.String("merchant_id", merchantID), zap.Time("from", from), zap.Time("to", to))
+
+	criteria := ""
+	args := []interface{}{merchantID, to, from}
+	if len(statuses) > 0 {
+		criteria = " AND b.status IN (" + placeholders(len(statuses)) + ") "
+		for _, st := range statuses {
+			args = append(args, st)
+		}
+	}
+
+	return r.queryBookings(ctx, `
+		WHERE b.merchant_id = ? AND b.booking_date_from < ? AND b.booking_date_to > ? `+criteria+`
+		ORDER BY b.booking_date_from, b.booking_id`, args...)
+}
+
+// GetBooking : sql.ErrNoRows if not a booking of the merchant
+func (r *BookingsRepository) GetBooking(ctx context.Context, merchantID, bookingID string) (*models.Booking, error) {
+	list, err := r.queryBookings(ctx, `WHERE b.merchant_id = ? AND b.booking_id = ?`, merchantID, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &list[0], nil
+}
+
+func (r *BookingsRepository) queryBookings(ctx context.Context, where string, args ...interface{}) ([]models.Booking, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT b.booking_id, b.booking_number, b.status, b.party_size, b.comment, b.booking_date_from, b.booking_date_to,
+		       c.customer_id, c.customer_name, c.customer_tel
+		FROM bookings b
+		LEFT JOIN customer c ON c.customer_id = b.customer_id
+		`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("bookings query error: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.Booking{}
+	index := map[string]int{}
+	for rows.Next() {
+		var b models.Booking
+		var number, comment, customerName, customerTel sql.NullString
+		var partySize, customerID sql.NullInt64
+		if err := rows.Scan(&b.BookingID, &number, &b.Status, &partySize, &comment, &b.DateFrom, &b.DateTo,
+			&customerID, &customerName, &customerTel); err != nil {
+			return nil, err
+		}
+		b.BookingNumber = nullStringToPtr(number)
+		b.PartySize = int(partySize.Int64)
+		b.Comment = nullStringToPtr(comment)
+		b.Duration = int(b.DateTo.Sub(b.DateFrom).Minutes())
+		if customerID.Valid {
+			b.Customer = &models.Customer{
+				CustomerID:   nullInt64ToPtr(customerID),
+				CustomerName: nullStringToPtr(customerName),
+				CustomerTel:  nullStringToPtr(customerTel),
+			}
+		}
+		b.Locations = []models.BookingLocation{}
+		index[b.BookingID] = len(list)
+		list = append(list, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return list, nil
+	}
+
+	ids := make([]interface{}, 0, len(list))
+	for _, b := range list {
+		ids = append(ids, b.BookingID)
+	}
+	locRows, err := r.db.QueryContext(ctx, `
+		SELECT bl.booking_id, l.location_id, l.location_name, l.seats, l.floor_id
+		FROM booked_location bl
+		INNER JOIN locations l ON l.location_id = bl.location_id
+		WHERE bl.booking_id IN (`+placeholders(len(ids))+`)
+		ORDER BY l.location_order`, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("booked_location query error: %w", err)
+	}
+	defer locRows.Close()
+
+	for locRows.Next() {
+		var bookingID string
+		l, err := scanBookingLocation(locRows, &bookingID)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := index[bookingID]; ok {
+			list[i].Locations = append(list[i].Locations, l)
+		}
+	}
+	return list, locRows.Err()
+}
+
+// CreateBooking inserts the booking and holds its tables, in one transaction.
+// loc is the merchant time zone: booking_number is per local day of the booking.
+func (r *BookingsRepository) CreateBooking(ctx context.Context, merchantID string, req models.CreateBookingRequest, from, to time.Time, loc *time.Location) (string, error) {
+	r.log.Info("CreateBooking START", zap.String("merchant_id", merchantID), zap.Int("party_size", req.PartySize))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var customerID int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT customer_id FROM customer WHERE customer_id = ? AND merchant_id = ?
+	`, req.CustomerID, merchantID).Scan(&customerID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return "", fmt.Errorf("%w: customer %d", ErrInvalidReference, req.CustomerID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	// même principe que order_num : numéro du jour local (de la réservation) par merchant, compteur verrouillé
+	number, err := nextDailyNumber(ctx, tx, merchantID, "BOOKING", from.In(loc), `
+		SELECT COALESCE(MAX(CAST(booking_number AS UNSIGNED)), 0)
+		FROM bookings
+		WHERE merchant_id = ? AND booking_date_from >= ? AND booking_date_from < ?`)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO bookings (merchant_id, customer_id, booking_number, status, party_size, comment,
+		                      booking_date_from, booking_date_to, booking_duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, merchantID, customerID, strconv.FormatInt(number, 10), req.Status, req.PartySize, req.Comment,
+		from, to, int(to.Sub(from).Minutes()))
+	if err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("insert booking error: %w", err)
+	}
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	bookingID := strconv.FormatInt(lastID, 10)
+
+	if len(req.LocationIDs) > 0 {
+		if err := holdTables(ctx, tx, merchantID, bookingID, req.LocationIDs, req.PartySize, from, to); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	return bookingID, tx.Commit()
+}
+
+// UpdateBookingStatus moves the booking only if it is still in fromStatus
+func (r *BookingsRepository) UpdateBookingStatus(ctx context.Context, merchantID, bookingID, fromStatus, toStatus string) error {
+	r.log.Info("UpdateBookingStatus START", zap.String("booking_id", bookingID), zap.String("from", fromStatus), zap.String("to", toStatus))
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE bookings SET status = ?
+		WHERE booking_id = ? AND merchant_id = ? AND status = ?
+	`, toStatus, bookingID, merchantID, fromStatus)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBookingStatusConflict
+	}
+	return nil
+}
+
+// SetBookingLocations replaces the tables of an active booking
+func (r *BookingsRepository) SetBookingLocations(ctx context.Context, merchantID, bookingID string, locationIDs []string) error {
+	r.log.Info("SetBookingLocations START", zap.String("booking_id", bookingID), zap.Strings("location_ids", locationIDs))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var status string
+	var partySize sql.NullInt64
+	var from, to time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT status, party_size, booking_date_from, booking_date_to
+		FROM bookings WHERE booking_id = ? AND merchant_id = ?
+		FOR UPDATE`, bookingID, merchantID).Scan(&status, &partySize, &from, &to)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if status != "PENDING" && status != "ACCEPTED" {
+		tx.Rollback()
+		return fmt.Errorf("%w: booking is %s", ErrBookingStatusConflict, status)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM booked_location WHERE booking_id = ?`, bookingID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := holdTables(ctx, tx, merchantID, bookingID, locationIDs, int(partySize.Int64), from, to); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetFreeLocations : enabled tables not held by an active booking overlapping [from, to)
+func (r *BookingsRepository) GetFreeLocations(ctx context.Context, merchantID string, from, to time.Time) ([]models.BookingLocation, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT l.location_id, l.location_name, l.seats, l.floor_id
+		FROM locations l
+		WHERE l.merchant_id = ? AND l.enabled IS TRUE
+		AND NOT EXISTS (
+			SELECT 1 FROM booked_location bl
+			INNER JOIN bookings b ON b.booking_id = bl.booking_id
+			WHERE bl.location_id = l.location_id AND b.merchant_id = l.merchant_id
+			AND b.status IN (`+activeBookingStatuses+`)
+			AND b.booking_date_from < ? AND b.booking_date_to > ?
+		)
+		ORDER BY l.location_order`, merchantID, to, from)
+	if err != nil {
+		return nil, fmt.Errorf("free locations query error: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.BookingLocation{}
+	for rows.Next() {
+		l, err := scanBookingLocation(rows, nil)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, l)
+	}
+	return list, rows.Err()
+}
+
+// holdTables : the tables are locked, checked free over [from, to) and big enough, then attached
+func holdTables(ctx context.Context, tx *sql.Tx, merchantID, bookingID string, locationIDs []string, partySize int, from, to time.Time) error {
+	ids := make([]interface{}, 0, len(locationIDs)+1)
+	ids = append(ids, merchantID)
+	for _, id := range locationIDs {
+		ids = append(ids, id)
+	}
+
+	// FOR UPDATE sur les tables : deux réservations simultanées de la même table se sérialisent ici
+	rows, err := tx.QueryContext(ctx, `
+		SELECT location_id, seats FROM locations
+		WHERE merchant_id = ? AND enabled IS TRUE AND location_id IN (`+placeholders(len(locationIDs))+`)
+		ORDER BY location_id
+		FOR UPDATE`, ids...)
+	if err != nil {
+		return err
+	}
+	found := map[string]bool{}
+	seats := 0
+	for rows.Next() {
+		var id string
+		var n sql.NullInt64
+		if err := rows.Scan(&id, &n); err != nil {
+			rows.Close()
+			return err
+		}
+		found[id] = true
+		seats += int(n.Int64)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range locationIDs {
+		if !found[id] {
+			return fmt.Errorf("%w: location %s", ErrInvalidReference, id)
+		}
+	}
+	if seats < partySize {
+		return fmt.Errorf("%w: %d seats for %d guests", ErrNotEnoughSeats, seats, partySize)
+	}
+
+	args := append([]interface{}{merchantID, bookingID, to, from}, ids[1:]...)
+	var busy string
+	err = tx.QueryRowContext(ctx, `
+		SELECT bl.location_id FROM booked_location bl
+		INNER JOIN bookings b ON b.booking_id = bl.booking_id
+		WHERE b.merchant_id = ? AND b.booking_id <> ? AND b.status IN (`+activeBookingStatuses+`)
+		AND b.booking_date_from < ? AND b.booking_date_to > ?
+		AND bl.location_id IN (`+placeholders(len(locationIDs))+`)
+		LIMIT 1`, args...).Scan(&busy)
+	if err == nil {
+		return fmt.Errorf("%w: location %s", ErrTableUnavailable, busy)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	for _, id := range locationIDs {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO booked_location (booking_id, location_id) VALUES (?, ?)
+		`, bookingID, id); err != nil {
+			return fmt.Errorf("insert booked_location error: %w", err)
+		}
+	}
+	return nil
+}
+
+func scanBookingLocation(rows *sql.Rows, bookingID *string) (models.BookingLocation, error) {
+	var l models.BookingLocation
+	var name, floorID sql.NullString
+	var seats sql.NullInt64
+	var err error
+	if bookingID != nil {
+		err = rows.Scan(bookingID, &l.LocationID, &name, &seats, &floorID)
+	} else {
+		err = rows.Scan(&l.LocationID, &name, &seats, &floorID)
+	}
+	l.LocationName = name.String
+	l.Seats = int(seats.Int64)
+	l.FloorID = floorID.String
+	return l, err
+}
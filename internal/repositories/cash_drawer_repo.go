@@ -3,10 +3,32 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"welloresto-api/internal/models"
 
 	"go.uber.org/zap"
 )
 
+// Types de mouvements de caisse
+const (
+	MovementDrawerOpen = "DRAWER_OPEN"
+	MovementCashIn     = "CASH_IN"
+	MovementCashOut    = "CASH_OUT"
+)
+
+// cashMOPs : moyens de paiement qui finissent dans le tiroir
+const cashMOPs = "'CASH','ESPECES'"
+
+var (
+	// ErrNoOpenCashSession : no cash drawer session is open for the merchant
+	ErrNoOpenCashSession = errors.New("no open cash drawer session")
+	// ErrCashSessionAlreadyOpen : a session must be closed before opening the next one
+	ErrCashSessionAlreadyOpen = errors.New("a cash drawer session is already open")
+)
+
 type CashDrawerRepository struct {
 	db  *sql.DB
 	log *zap.Logger
@@ -16,9 +38,283 @@ func NewCashDrawerRepository(db *sql.DB, log *zap.Logger) *CashDrawerRepository
 	return &CashDrawerRepository{db: db, log: log}
 }
 
-func (r *CashDrawerRepository) OpenCashDrawer(ctx context.Context, userID string, deviceID string) error {
+// queryer : *sql.DB or *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// OpenCashDrawer logs a physical opening of the drawer, attached to the open session if any
+func (r *CashDrawerRepository) OpenCashDrawer(ctx context.Context, merchantID, userID, deviceID string) error {
 	r.log.Info("OpenCashDrawer", zap.String("user_id", userID), zap.String("device_id", deviceID))
 
-	// Pas d'opération DB encore, mais futur audit/logging
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO cash_drawer_movement (session_id, merchant_id, user_id, device_id, type, amount, created_at)
+		VALUES ((SELECT id FROM cash_drawer_session WHERE merchant_id = ? AND status = 'OPEN' LIMIT 1), ?, ?, ?, ?, 0, UTC_TIMESTAMP())
+	`, merchantID, merchantID, userID, nullIfEmpty(deviceID), MovementDrawerOpen)
+	return err
+}
+
+// OpenSession starts a session with the opening float, one open session per merchant
+func (r *CashDrawerRepository) OpenSession(ctx context.Context, merchantID, userID, deviceID string, openingFloat int64) (string, error) {
+	r.log.Info("OpenSession START", zap.String("merchant_id", merchantID), zap.Int64("opening_float", openingFloat))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var current string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM cash_drawer_session WHERE merchant_id = ? AND status = 'OPEN' LIMIT 1 FOR UPDATE
+	`, merchantID).Scan(&current)
+	if err == nil {
+		tx.Rollback()
+		return "", fmt.Errorf("%w: session %s", ErrCashSessionAlreadyOpen, current)
+	}
+	if err != sql.ErrNoRows {
+		tx.Rollback()
+		return "", err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO cash_drawer_session (merchant_id, device_id, status, opened_by, opened_at, opening_float)
+		VALUES (?, ?, 'OPEN', ?, UTC_TIMESTAMP(), ?)
+	`, merchantID, nullIfEmpty(deviceID), userID, openingFloat)
+	if err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("insert cash_drawer_session error: %w", err)
+	}
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	return strconv.FormatInt(lastID, 10), tx.Commit()
+}
+
+// AddMovement records a manual cash in / cash out on the open session
+func (r *CashDrawerRepository) AddMovement(ctx context.Context, merchantID, userID, deviceID, movementType string, amount int64, reason string) error {
+	r.log.Info("AddMovement START", zap.String("merchant_id", merchantID), zap.String("type", movementType), zap.Int64("amount", amount))
+
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO cash_drawer_movement (session_id, merchant_id, user_id, device_id, type, amount, reason, created_at)
+		SELECT s.id, s.merchant_id, ?, ?, ?, ?, ?, UTC_TIMESTAMP()
+		FROM cash_drawer_session s
+		WHERE s.merchant_id = ? AND s.status = 'OPEN'
+		LIMIT 1
+	`, userID, nullIfEmpty(deviceID), movementType, amount, nullIfEmpty(reason), merchantID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNoOpenCashSession
+	}
 	return nil
 }
+
+// CloseSession stores the counted cash next to the expected cash and closes the session
+func (r *CashDrawerRepository) CloseSession(ctx context.Context, merchantID, userID string, countedCash int64, notes string) (string, error) {
+	r.log.Info("CloseSession START", zap.String("merchant_id", merchantID), zap.Int64("counted_cash", countedCash))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var sessionID string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM cash_drawer_session WHERE merchant_id = ? AND status = 'OPEN' LIMIT 1 FOR UPDATE
+	`, merchantID).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return "", ErrNoOpenCashSession
+	}
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	session, err := loadCashSession(ctx, tx, merchantID, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE cash_drawer_session
+		SET status = 'CLOSED', closed_by = ?, closed_at = UTC_TIMESTAMP(), expected_cash = ?, counted_cash = ?, notes = ?
+		WHERE id = ?
+	`, userID, session.ExpectedCash, countedCash, nullIfEmpty(notes), sessionID); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	return sessionID, tx.Commit()
+}
+
+// GetCurrentSession returns the open session with its running totals
+func (r *CashDrawerRepository) GetCurrentSession(ctx context.Context, merchantID string) (*models.CashDrawerSession, error) {
+	var sessionID string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id FROM cash_drawer_session WHERE merchant_id = ? AND status = 'OPEN' LIMIT 1
+	`, merchantID).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoOpenCashSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loadCashSession(ctx, r.db, merchantID, sessionID)
+}
+
+func (r *CashDrawerRepository) GetSession(ctx context.Context, merchantID, sessionID string) (*models.CashDrawerSession, error) {
+	return loadCashSession(ctx, r.db, merchantID, sessionID)
+}
+
+// GetZReport aggregates the orders, payments and cash sessions of [from, to)
+func (r *CashDrawerRepository) GetZReport(ctx context.Context, merchantID string, from, to time.Time) (*models.ZReport, error) {
+	r.log.Info("GetZReport START", zap.String("merchant_id", merchantID), zap.Time("from", from), zap.Time("to", to))
+
+	report := &models.ZReport{From: from, To: to, Sessions: []models.CashDrawerSession{}}
+
+	var ttc, tva, ht sql.NullInt64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), SUM(price), SUM(TVA), SUM(HT),
+		       (SELECT COUNT(*) FROM orders WHERE merchant_id = ? AND creation_date >= ? AND creation_date < ? AND state = 'CANCELED')
+		FROM orders
+		WHERE merchant_id = ? AND creation_date >= ? AND creation_date < ? AND state NOT IN ('CANCELED', 'DELETED')
+	`, merchantID, from, to, merchantID, from, to).Scan(&report.OrdersCount, &ttc, &tva, &ht, &report.CanceledCount)
+	if err != nil {
+		return nil, fmt.Errorf("z report orders query error: %w", err)
+	}
+	report.TTC, report.TVA, report.HT = ttc.Int64, tva.Int64, ht.Int64
+
+	report.Payments, report.PaymentsTotal, err = paymentsByMOP(ctx, r.db, merchantID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("z report payments query error: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM cash_drawer_session
+		WHERE merchant_id = ? AND opened_at >= ? AND opened_at < ?
+		ORDER BY opened_at
+	`, merchantID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("z report sessions query error: %w", err)
+	}
+	var sessionIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sessionIDs = append(sessionIDs, id)
+	}
+	rows.Close()
+
+	for _, id := range sessionIDs {
+		s, err := loadCashSession(ctx, r.db, merchantID, id)
+		if err != nil {
+			return nil, err
+		}
+		report.CashIn += s.CashIn
+		report.CashOut += s.CashOut
+		if s.Difference != nil {
+			report.Difference += *s.Difference
+		}
+		report.Sessions = append(report.Sessions, *s)
+	}
+
+	return report, nil
+}
+
+// loadCashSession : header + movements + cash payments between opening and closing (or now)
+func loadCashSession(ctx context.Context, q queryer, merchantID, sessionID string) (*models.CashDrawerSession, error) {
+	var s models.CashDrawerSession
+	var deviceID, closedBy, notes sql.NullString
+	var closedAt sql.NullTime
+	var expected, counted sql.NullInt64
+
+	err := q.QueryRowContext(ctx, `
+		SELECT id, device_id, status, opened_by, opened_at, opening_float, closed_by, closed_at, expected_cash, counted_cash, notes
+		FROM cash_drawer_session
+		WHERE id = ? AND merchant_id = ?
+	`, sessionID, merchantID).Scan(&s.SessionID, &deviceID, &s.Status, &s.OpenedBy, &s.OpenedAt, &s.OpeningFloat,
+		&closedBy, &closedAt, &expected, &counted, &notes)
+	if err != nil {
+		return nil, err
+	}
+	s.DeviceID = nullStringToPtr(deviceID)
+	s.ClosedBy = nullStringToPtr(closedBy)
+	s.ClosedAt = nullTimePtr(closedAt)
+	s.CountedCash = nullInt64ToPtr(counted)
+	s.Notes = nullStringToPtr(notes)
+
+	var cashPayments float64
+	err = q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(p.amount), 0)
+		FROM payments p
+		INNER JOIN orders o ON o.order_id = p.order_id
+		WHERE o.merchant_id = ? AND p.enabled = 1 AND p.mop IN (`+cashMOPs+`)
+		AND p.payment_date >= ? AND p.payment_date < COALESCE(?, UTC_TIMESTAMP())
+	`, merchantID, s.OpenedAt, closedAt).Scan(&cashPayments)
+	if err != nil {
+		return nil, fmt.Errorf("cash payments query error: %w", err)
+	}
+	s.CashPayments = int64(cashPayments)
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, type, amount, reason, user_id, device_id, created_at
+		FROM cash_drawer_movement
+		WHERE session_id = ?
+		ORDER BY created_at, id
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("cash movements query error: %w", err)
+	}
+	defer rows.Close()
+
+	s.Movements = []models.CashDrawerMovement{}
+	for rows.Next() {
+		var m models.CashDrawerMovement
+		var reason, mDeviceID sql.NullString
+		if err := rows.Scan(&m.MovementID, &m.Type, &m.Amount, &reason, &m.UserID, &mDeviceID, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.Reason = nullStringToPtr(reason)
+		m.DeviceID = nullStringToPtr(mDeviceID)
+
+		switch m.Type {
+		case MovementCashIn:
+			s.CashIn += m.Amount
+		case MovementCashOut:
+			s.CashOut += m.Amount
+		case MovementDrawerOpen:
+			s.DrawerOpens++
+		}
+		s.Movements = append(s.Movements, m)
+	}
+
+	// une session fermée garde l'attendu figé à la clôture
+	if expected.Valid {
+		s.ExpectedCash = expected.Int64
+	} else {
+		s.ExpectedCash = s.OpeningFloat + s.CashPayments + s.CashIn - s.CashOut
+	}
+	if s.CountedCash != nil {
+		diff := *s.CountedCash - s.ExpectedCash
+		s.Difference = &diff
+	}
+
+	return &s, rows.Err()
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
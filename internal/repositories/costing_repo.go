@@ -0,0 +1,258 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// GetProductCosts loads what the costing needs: price / TVA rate of each channel the product is
+// sold on, recipe lines with their purchase cost, configurable options with theirs.
+// Costs and margins themselves are computed by the service.
+// productID "" : every product sold (not the product groups), sql.ErrNoRows for an unknown product.
+func (r *MenuRepository) GetProductCosts(ctx context.Context, merchantID, productID, lang string) ([]models.ProductCost, error) {
+	r.log.Info("GetProductCosts START", zap.String("merchant_id", merchantID), zap.String("product_id", productID))
+
+	criteria := " AND p.is_product_group = 0"
+	args := []interface{}{merchantID}
+	if productID != "" {
+		criteria = " AND p.product_id = ?"
+		args = append(args, productID)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+menuProductColumns+`
+		FROM products p `+menuProductJoins+`
+		WHERE p.merchant_id = ? AND p.enabled = 1`+criteria+`
+		ORDER BY p.category, p.name, p.product_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("costing products query error: %w", err)
+	}
+	list := []models.ProductCost{}
+	index := map[string]int{}
+	for rows.Next() {
+		p, err := scanMenuProduct(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[p.ProductID] = len(list)
+		pc := models.ProductCost{
+			ProductID: p.ProductID, Name: p.Name, Category: p.Category,
+			Components: []models.ComponentCost{}, Attributes: []models.AttributeCost{}, Channels: []models.ChannelMargin{},
+		}
+		// même choix de prix / taux que CreateOrder selon le type de commande
+		for _, ch := range []struct {
+			sold    bool
+			channel string
+			price   int64
+			rate    float64
+		}{
+			{p.AvailableIn, "ON_SITE", p.Price, p.TVAIn},
+			{p.AvailableTakeAway, "TAKE_AWAY", p.PriceTakeAway, p.TVATakeAway},
+			{p.AvailableDelivery, "DELIVERY", p.PriceDelivery, p.TVADelivery},
+		} {
+			if ch.sold {
+				pc.Channels = append(pc.Channels, models.ChannelMargin{Channel: ch.channel, Price: ch.price, TVARate: ch.rate})
+			}
+		}
+		list = append(list, pc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		if productID != "" {
+			return nil, sql.ErrNoRows
+		}
+		return list, nil
+	}
+
+	if err := r.loadCostingComponents(ctx, merchantID, productID, lang, list, index); err != nil {
+		return nil, err
+	}
+	if err := r.loadCostingOptions(ctx, merchantID, productID, list, index); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *MenuRepository) loadCostingComponents(ctx context.Context, merchantID, productID, lang string, list []models.ProductCost, index map[string]int) error {
+	criteria := ""
+	args := []interface{}{lang, merchantID}
+	if productID != "" {
+		criteria = " AND rc.product_id = ?"
+		args = append(args, productID)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT rc.product_id, c.component_id, c.name, rq.quantity,
+		       COALESCE(uoml.uom_desc, uomd.uom_desc), uc.code, c.cost_price, c.cost_unit
+		FROM recipes rc
+		INNER JOIN requires rq ON rq.recipe_id = rc.recipe_id AND rq.enabled = 1
+		INNER JOIN components c ON c.component_id = rq.component_id
+		LEFT JOIN unit_of_measure_desc uomd ON uomd.lang = 'FR' AND uomd.id = rq.unit_of_measure
+		LEFT JOIN unit_of_measure_desc uoml ON uoml.lang = ? AND uoml.id = rq.unit_of_measure
+		LEFT JOIN unit_of_measure_code uc ON uc.id = rq.unit_of_measure
+		WHERE c.merchant_id = ?`+criteria+`
+		ORDER BY rc.product_id, c.name`, args...)
+	if err != nil {
+		return fmt.Errorf("costing components query error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pid string
+		var c models.ComponentCost
+		var qty sql.NullFloat64
+		var unit, code, costUnit sql.NullString
+		var costPrice sql.NullInt64
+		if err := rows.Scan(&pid, &c.ComponentID, &c.Name, &qty, &unit, &code, &costPrice, &costUnit); err != nil {
+			return err
+		}
+		i, ok := index[pid]
+		if !ok {
+			continue
+		}
+		c.Quantity = qty.Float64
+		c.Unit = unit.String
+		c.UnitCode = nullStringToPtr(code)
+		c.CostPrice = nullInt64ToPtr(costPrice)
+		c.CostUnit = nullStringToPtr(costUnit)
+		list[i].Components = append(list[i].Components, c)
+	}
+	return rows.Err()
+}
+
+func (r *MenuRepository) loadCostingOptions(ctx context.Context, merchantID, productID string, list []models.ProductCost, index map[string]int) error {
+	criteria := ""
+	args := []interface{}{merchantID}
+	if productID != "" {
+		criteria = " AND pca.product_id = ?"
+		args = append(args, productID)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT pca.product_id, ca.id, ca.title, ca.min_options, ca.max_options,
+		       cao.id, cao.title, cao.extra_price, cao.max_quantity, cao.cost_price
+		FROM products p
+		INNER JOIN product_configurable_attribute pca ON pca.product_id = p.product_id AND pca.enabled = 1
+		INNER JOIN configurable_attributes ca ON ca.id = pca.configurable_attribute_id AND ca.enabled = 1
+		INNER JOIN configurable_attribute_options cao ON cao.configurable_attribute_id = ca.id AND cao.enabled = 1
+		WHERE p.merchant_id = ?`+criteria+`
+		ORDER BY pca.product_id, pca.num_order, cao.id`, args...)
+	if err != nil {
+		return fmt.Errorf("costing options query error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pid string
+		var a models.AttributeCost
+		var o models.OptionCost
+		var minOptions, maxOptions, extraPrice, maxQuantity, costPrice sql.NullInt64
+		if err := rows.Scan(&pid, &a.AttributeID, &a.Title, &minOptions, &maxOptions,
+			&o.OptionID, &o.Title, &extraPrice, &maxQuantity, &costPrice); err != nil {
+			return err
+		}
+		i, ok := index[pid]
+		if !ok {
+			continue
+		}
+		o.ExtraPrice = extraPrice.Int64
+		o.MaxQuantity = int(maxQuantity.Int64)
+		o.Cost = nullInt64ToPtr(costPrice)
+
+		attrs := list[i].Attributes
+		if n := len(attrs); n == 0 || attrs[n-1].AttributeID != a.AttributeID {
+			a.MinOptions, a.MaxOptions = int(minOptions.Int64), int(maxOptions.Int64)
+			a.Options = []models.OptionCost{}
+			attrs = append(attrs, a)
+		}
+		attrs[len(attrs)-1].Options = append(attrs[len(attrs)-1].Options, o)
+		list[i].Attributes = attrs
+	}
+	return rows.Err()
+}
+
+// GetTargetMargin : merchant_parameters.target_food_margin, nil when not set
+func (r *MenuRepository) GetTargetMargin(ctx context.Context, merchantID string) (*float64, error) {
+	var target sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT target_food_margin FROM merchant_parameters WHERE merchant_id = ?
+	`, merchantID).Scan(&target)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nullFloat64Ptr(target), nil
+}
+
+// SetComponentCost : sql.ErrNoRows if not a component of the merchant
+func (r *MenuRepository) SetComponentCost(ctx context.Context, merchantID, componentID string, req models.CostRequest) error {
+	r.log.Info("SetComponentCost START", zap.String("merchant_id", merchantID), zap.String("component_id", componentID))
+
+	var exists int
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT 1 FROM components WHERE merchant_id = ? AND component_id = ?
+	`, merchantID, componentID).Scan(&exists); err != nil {
+		return err
+	}
+
+	cols, vals := costFields(req, true)
+	if len(cols) == 0 {
+		return nil
+	}
+	vals = append(vals, merchantID, componentID)
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE components SET `+strings.Join(cols, " = ?, ")+` = ?
+		WHERE merchant_id = ? AND component_id = ?`, vals...)
+	return err
+}
+
+// SetOptionCost : sql.ErrNoRows if the option isn't on a product of the merchant
+func (r *MenuRepository) SetOptionCost(ctx context.Context, merchantID, optionID string, req models.CostRequest) error {
+	r.log.Info("SetOptionCost START", zap.String("merchant_id", merchantID), zap.String("option_id", optionID))
+
+	var exists int
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT 1 FROM configurable_attribute_options cao
+		INNER JOIN product_configurable_attribute pca ON pca.configurable_attribute_id = cao.configurable_attribute_id
+		INNER JOIN products p ON p.product_id = pca.product_id
+		WHERE cao.id = ? AND p.merchant_id = ?
+		LIMIT 1`, optionID, merchantID).Scan(&exists); err != nil {
+		return err
+	}
+
+	cols, vals := costFields(req, false)
+	if len(cols) == 0 {
+		return nil
+	}
+	vals = append(vals, optionID)
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE configurable_attribute_options SET `+strings.Join(cols, " = ?, ")+` = ?
+		WHERE id = ?`, vals...)
+	return err
+}
+
+// costFields : "" unsets the cost unit (back to the unit of the recipes)
+func costFields(req models.CostRequest, withUnit bool) ([]string, []interface{}) {
+	var cols []string
+	var vals []interface{}
+	if req.CostPrice != nil {
+		cols = append(cols, "cost_price")
+		vals = append(vals, *req.CostPrice)
+	}
+	if withUnit && req.CostUnit != nil {
+		cols = append(cols, "cost_unit")
+		vals = append(vals, nullIfEmpty(*req.CostUnit))
+	}
+	return cols, vals
+}
@@ -0,0 +1,406 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+type CustomersRepository struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewCustomersRepository(db *sql.DB, log *zap.Logger) *CustomersRepository {
+	return &CustomersRepository{db: db, log: log}
+}
+
+const customerColumns = `
+	c.customer_id, c.customer_name, c.customer_tel, c.customer_temporary_phone, c.customer_temporary_phone_code,
+	c.customer_zone_code, c.customer_business_name, c.customer_birthdate, c.customer_additional_info,
+	c.customer_nb_orders, c.customer_address, c.customer_lat, c.customer_lng,
+	c.customer_floor_number, c.customer_door_number, c.customer_additional_address`
+
+// phoneDigits : le téléphone tel que stocké, sans espaces / points / tirets
+const phoneDigits = "REPLACE(REPLACE(REPLACE(%s, ' ', ''), '.', ''), '-', '')"
+
+// SearchCustomers : phone matches on the last digits (+33 6..., 06... are the same number),
+// name on any part of it. Both empty = latest customers.
+func (r *CustomersRepository) SearchCustomers(ctx context.Context, merchantID, phone, name string, limit int) ([]models.CustomerProfile, error) {
+	r.log.Info("SearchCustomers START", zap.String("merchant_id", merchantID))
+
+	criteria := ""
+	args := []interface{}{merchantID}
+	if phone != "" {
+		tel := fmt.Sprintf(phoneDigits, "c.customer_tel")
+		tempTel := fmt.Sprintf(phoneDigits, "c.customer_temporary_phone")
+		criteria += " AND (" + tel + " LIKE ? OR " + tempTel + " LIKE ?) "
+		args = append(args, "%"+escapeLike(phone), "%"+escapeLike(phone))
+	}
+	if name != "" {
+		criteria += " AND (c.customer_name LIKE ? OR c.customer_business_name LIKE ?) "
+		args = append(args, "%"+escapeLike(name)+"%", "%"+escapeLike(name)+"%")
+	}
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+customerColumns+`
+		FROM customer c
+		WHERE c.merchant_id = ? `+criteria+`
+		ORDER BY c.customer_nb_orders DESC, c.customer_id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("customers query error: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.CustomerProfile{}
+	for rows.Next() {
+		c, err := scanCustomer(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *c)
+	}
+	return list, rows.Err()
+}
+
+// GetCustomer : customer + address book, sql.ErrNoRows if not a customer of the merchant
+func (r *CustomersRepository) GetCustomer(ctx context.Context, merchantID, customerID string) (*models.CustomerProfile, error) {
+	c, err := scanCustomer(r.db.QueryRowContext(ctx, `
+		SELECT `+customerColumns+`
+		FROM customer c
+		WHERE c.merchant_id = ? AND c.customer_id = ?`, merchantID, customerID))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, label, address, lat, lng, floor_number, door_number, additional_address, zone_code, is_default
+		FROM customer_address
+		WHERE customer_id = ? AND merchant_id = ? AND enabled = 1
+		ORDER BY is_default DESC, updated_at DESC`, customerID, merchantID)
+	if err != nil {
+		return nil, fmt.Errorf("customer addresses query error: %w", err)
+	}
+	defer rows.Close()
+
+	c.Addresses = []models.CustomerAddress{}
+	for rows.Next() {
+		var a models.CustomerAddress
+		var label, floor, door, additional, zone sql.NullString
+		var lat, lng sql.NullFloat64
+		if err := rows.Scan(&a.AddressID, &label, &a.Address, &lat, &lng, &floor, &door, &additional, &zone, &a.IsDefault); err != nil {
+			return nil, err
+		}
+		a.Label = nullStringToPtr(label)
+		a.Lat = nullFloat64Ptr(lat)
+		a.Lng = nullFloat64Ptr(lng)
+		a.FloorNumber = nullStringToPtr(floor)
+		a.DoorNumber = nullStringToPtr(door)
+		a.AdditionalAddress = nullStringToPtr(additional)
+		a.ZoneCode = nullStringToPtr(zone)
+		c.Addresses = append(c.Addresses, a)
+	}
+	return c, rows.Err()
+}
+
+// CreateCustomer inserts the customer, and its first address as the default one
+func (r *CustomersRepository) CreateCustomer(ctx context.Context, merchantID string, req models.CustomerRequest) (string, error) {
+	r.log.Info("CreateCustomer START", zap.String("merchant_id", merchantID))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	cols, vals := customerFields(req)
+	cols = append(cols, "merchant_id", "customer_nb_orders")
+	vals = append(vals, merchantID, 0)
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO customer (`+strings.Join(cols, ", ")+`)
+		VALUES (`+placeholders(len(cols))+`)`, vals...)
+	if err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("insert customer error: %w", err)
+	}
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	customerID := strconv.FormatInt(lastID, 10)
+
+	if req.Address != nil {
+		isDefault := true
+		req.Address.IsDefault = &isDefault
+		if _, err := insertCustomerAddress(ctx, tx, merchantID, customerID, *req.Address); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	return customerID, tx.Commit()
+}
+
+// UpdateCustomer only writes the fields sent, sql.ErrNoRows if not a customer of the merchant
+func (r *CustomersRepository) UpdateCustomer(ctx context.Context, merchantID, customerID string, req models.CustomerRequest) error {
+	r.log.Info("UpdateCustomer START", zap.String("customer_id", customerID))
+
+	if err := r.customerExists(ctx, r.db, merchantID, customerID); err != nil {
+		return err
+	}
+
+	cols, vals := customerFields(req)
+	if len(cols) == 0 {
+		return nil
+	}
+	vals = append(vals, customerID, merchantID)
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE customer SET `+strings.Join(cols, " = ?, ")+` = ?
+		WHERE customer_id = ? AND merchant_id = ?`, vals...)
+	return err
+}
+
+// AddAddress : the first address of a customer is the default one whatever is asked
+func (r *CustomersRepository) AddAddress(ctx context.Context, merchantID, customerID string, req models.CustomerAddressRequest) (string, error) {
+	r.log.Info("AddAddress START", zap.String("customer_id", customerID))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if err := r.customerExists(ctx, tx, merchantID, customerID); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM customer_address WHERE customer_id = ? AND merchant_id = ? AND enabled = 1
+	`, customerID, merchantID).Scan(&count); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if count == 0 {
+		isDefault := true
+		req.IsDefault = &isDefault
+	}
+
+	addressID, err := insertCustomerAddress(ctx, tx, merchantID, customerID, req)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	return addressID, tx.Commit()
+}
+
+// UpdateAddress only writes the fields sent; the default address is copied back to the customer
+func (r *CustomersRepository) UpdateAddress(ctx context.Context, merchantID, customerID, addressID string, req models.CustomerAddressRequest) error {
+	r.log.Info("UpdateAddress START", zap.String("customer_id", customerID), zap.String("address_id", addressID))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var isDefault bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT is_default FROM customer_address
+		WHERE id = ? AND customer_id = ? AND merchant_id = ? AND enabled = 1
+		FOR UPDATE`, addressID, customerID, merchantID).Scan(&isDefault)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	cols, vals := addressFields(req)
+	if len(cols) > 0 {
+		vals = append(vals, addressID)
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE customer_address SET `+strings.Join(cols, " = ?, ")+` = ?, updated_at = UTC_TIMESTAMP()
+			WHERE id = ?`, vals...); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("update customer_address error: %w", err)
+		}
+	}
+
+	// on ne retire pas le défaut d'une adresse : on en choisit une autre
+	if isDefault || (req.IsDefault != nil && *req.IsDefault) {
+		if err := setDefaultAddress(ctx, tx, customerID, addressID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteAddress disables the address; the customer keeps the last default address on its own columns
+func (r *CustomersRepository) DeleteAddress(ctx context.Context, merchantID, customerID, addressID string) error {
+	r.log.Info("DeleteAddress START", zap.String("customer_id", customerID), zap.String("address_id", addressID))
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE customer_address SET enabled = 0, is_default = 0, updated_at = UTC_TIMESTAMP()
+		WHERE id = ? AND customer_id = ? AND merchant_id = ? AND enabled = 1`, addressID, customerID, merchantID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *CustomersRepository) customerExists(ctx context.Context, q queryer, merchantID, customerID string) error {
+	var id int64
+	return q.QueryRowContext(ctx, `
+		SELECT customer_id FROM customer WHERE customer_id = ? AND merchant_id = ?
+	`, customerID, merchantID).Scan(&id)
+}
+
+func insertCustomerAddress(ctx context.Context, tx *sql.Tx, merchantID, customerID string, req models.CustomerAddressRequest) (string, error) {
+	cols, vals := addressFields(req)
+	cols = append(cols, "customer_id", "merchant_id", "created_at", "updated_at")
+	vals = append(vals, customerID, merchantID)
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO customer_address (`+strings.Join(cols, ", ")+`)
+		VALUES (`+placeholders(len(cols)-2)+`, UTC_TIMESTAMP(), UTC_TIMESTAMP())`, vals...)
+	if err != nil {
+		return "", fmt.Errorf("insert customer_address error: %w", err)
+	}
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	addressID := strconv.FormatInt(lastID, 10)
+
+	if req.IsDefault != nil && *req.IsDefault {
+		if err := setDefaultAddress(ctx, tx, customerID, addressID); err != nil {
+			return "", err
+		}
+	}
+	return addressID, nil
+}
+
+// setDefaultAddress : one default per customer, copied to customer.customer_address & co (read by orders)
+func setDefaultAddress(ctx context.Context, tx *sql.Tx, customerID, addressID string) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE customer_address SET is_default = (id = ?)
+		WHERE customer_id = ? AND enabled = 1`, addressID, customerID); err != nil {
+		return fmt.Errorf("default customer_address error: %w", err)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		UPDATE customer c
+		INNER JOIN customer_address a ON a.customer_id = c.customer_id AND a.id = ?
+		SET c.customer_address = a.address, c.customer_lat = a.lat, c.customer_lng = a.lng,
+		    c.customer_floor_number = a.floor_number, c.customer_door_number = a.door_number,
+		    c.customer_additional_address = a.additional_address,
+		    c.customer_zone_code = COALESCE(a.zone_code, c.customer_zone_code)
+		WHERE c.customer_id = ?`, addressID, customerID)
+	if err != nil {
+		return fmt.Errorf("customer default address error: %w", err)
+	}
+	return nil
+}
+
+// customerFields : columns / values of the fields sent
+func customerFields(req models.CustomerRequest) ([]string, []interface{}) {
+	var cols []string
+	var vals []interface{}
+	add := func(col string, v *string) {
+		if v != nil {
+			cols = append(cols, col)
+			vals = append(vals, *v)
+		}
+	}
+	add("customer_name", req.Name)
+	add("customer_tel", req.Tel)
+	add("customer_temporary_phone", req.TemporaryPhone)
+	add("customer_temporary_phone_code", req.TemporaryPhoneCode)
+	add("customer_zone_code", req.ZoneCode)
+	add("customer_business_name", req.BusinessName)
+	add("customer_birthdate", req.Birthdate)
+	add("customer_additional_info", req.AdditionalInfo)
+	return cols, vals
+}
+
+// addressFields : columns / values of the fields sent, is_default excepted (see setDefaultAddress)
+func addressFields(req models.CustomerAddressRequest) ([]string, []interface{}) {
+	var cols []string
+	var vals []interface{}
+	add := func(col string, v interface{}) {
+		cols = append(cols, col)
+		vals = append(vals, v)
+	}
+	if req.Label != nil {
+		add("label", *req.Label)
+	}
+	if req.Address != nil {
+		add("address", *req.Address)
+	}
+	if req.Lat != nil {
+		add("lat", *req.Lat)
+	}
+	if req.Lng != nil {
+		add("lng", *req.Lng)
+	}
+	if req.FloorNumber != nil {
+		add("floor_number", *req.FloorNumber)
+	}
+	if req.DoorNumber != nil {
+		add("door_number", *req.DoorNumber)
+	}
+	if req.AdditionalAddress != nil {
+		add("additional_address", *req.AdditionalAddress)
+	}
+	if req.ZoneCode != nil {
+		add("zone_code", *req.ZoneCode)
+	}
+	return cols, vals
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCustomer(row rowScanner) (*models.CustomerProfile, error) {
+	var c models.CustomerProfile
+	var name, tel, tempPhone, tempPhoneCode, zone, business, birthdate, info, address, floor, door, additional sql.NullString
+	var nbOrders sql.NullInt64
+	var lat, lng sql.NullFloat64
+	if err := row.Scan(&c.CustomerID, &name, &tel, &tempPhone, &tempPhoneCode, &zone, &business, &birthdate, &info,
+		&nbOrders, &address, &lat, &lng, &floor, &door, &additional); err != nil {
+		return nil, err
+	}
+	c.Name = nullStringToPtr(name)
+	c.Tel = nullStringToPtr(tel)
+	c.TemporaryPhone = nullStringToPtr(tempPhone)
+	c.TemporaryPhoneCode = nullStringToPtr(tempPhoneCode)
+	c.ZoneCode = nullStringToPtr(zone)
+	c.BusinessName = nullStringToPtr(business)
+	c.Birthdate = nullStringToPtr(birthdate)
+	c.AdditionalInfo = nullStringToPtr(info)
+	c.NbOrders = int(nbOrders.Int64)
+	c.Address = nullStringToPtr(address)
+	c.Lat = nullFloat64Ptr(lat)
+	c.Lng = nullFloat64Ptr(lng)
+	c.FloorNumber = nullStringToPtr(floor)
+	c.DoorNumber = nullStringToPtr(door)
+	c.AdditionalAddress = nullStringToPtr(additional)
+	return &c, nil
+}
+
+// escapeLike : % and _ typed by the user are literal
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,502 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrOrderAlreadyAssigned : the order is already in another active delivery session
+	ErrOrderAlreadyAssigned = errors.New("order already assigned to another delivery session")
+	// ErrIllegalSessionChange : the session status does not allow this change
+	ErrIllegalSessionChange = errors.New("illegal delivery session change")
+)
+
+// GetDeliverySession returns one session (whatever its status) with its orders sorted by priority
+func (r *DeliverySessionsRepository) GetDeliverySession(ctx context.Context, merchantID, sessionID, lang string) (*models.DeliverySession, error) {
+	sessions, err := r.fetchDeliverySessions(ctx, merchantID, "ds.id = ?", sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	session := sessions[0]
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT order_id, priority FROM delivery_session_order
+		WHERE delivery_session_id = ?
+		ORDER BY priority ASC`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch session order ids: %w", err)
+	}
+	defer rows.Close()
+
+	priorities := map[string]int64{}
+	var orderIDs []string
+	for rows.Next() {
+		var oid string
+		var priority sql.NullInt64
+		if err := rows.Scan(&oid, &priority); err != nil {
+			return nil, err
+		}
+		priorities[oid] = priority.Int64
+		orderIDs = append(orderIDs, oid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(orderIDs) == 0 {
+		return &session, nil
+	}
+
+	ordersRepo := NewOrdersRepository(r.db, r.log)
+	orders, err := ordersRepo.fetchAndBuildOrders(ctx, merchantID, OrderFilter{OrderIDs: orderIDs, Lang: lang})
+	if err != nil {
+		return nil, err
+	}
+
+	// la session terminée n'est plus jointe par le constructeur : on remet session + priorité à la main
+	for i := range orders {
+		p := priorities[orders[i].OrderID]
+		orders[i].Priority = &p
+		orders[i].DeliverySessionID = &session.DeliverySessionID
+	}
+	sort.SliceStable(orders, func(i, j int) bool { return *orders[i].Priority < *orders[j].Priority })
+	session.Orders = orders
+
+	return &session, nil
+}
+
+// CreateDeliverySession opens a PENDING session for a driver, optionally with its first orders
+func (r *DeliverySessionsRepository) CreateDeliverySession(ctx context.Context, merchantID, driverID string, orderIDs []string) (string, error) {
+	r.log.Info("CreateDeliverySession START", zap.String("merchant_id", merchantID), zap.String("driver_id", driverID), zap.Int("orders", len(orderIDs)))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM users WHERE user_id = ? AND merchant_id = ?`, driverID, merchantID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return "", fmt.Errorf("%w: driver %s", ErrInvalidReference, driverID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO delivery_session (merchant_id, user_id, status) VALUES (?, ?, ?)
+	`, merchantID, driverID, SessionPending)
+	if err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("insert delivery_session error: %w", err)
+	}
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	sessionID := strconv.FormatInt(lastID, 10)
+
+	for _, orderID := range orderIDs {
+		if err := attachOrder(ctx, tx, merchantID, sessionID, orderID); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	return sessionID, tx.Commit()
+}
+
+// AttachOrder adds an order at the end of a PENDING session
+func (r *DeliverySessionsRepository) AttachOrder(ctx context.Context, merchantID, sessionID, driverID, orderID string) error {
+	r.log.Info("AttachOrder START", zap.String("delivery_session_id", sessionID), zap.String("order_id", orderID))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	status, err := lockDeliverySession(ctx, tx, merchantID, sessionID, driverID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !isPendingSession(status) {
+		tx.Rollback()
+		return fmt.Errorf("%w: session is %s", ErrIllegalSessionChange, status)
+	}
+
+	if err := attachOrder(ctx, tx, merchantID, sessionID, orderID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DetachOrder removes an order from a PENDING session
+func (r *DeliverySessionsRepository) DetachOrder(ctx context.Context, merchantID, sessionID, driverID, orderID string) error {
+	r.log.Info("DetachOrder START", zap.String("delivery_session_id", sessionID), zap.String("order_id", orderID))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	status, err := lockDeliverySession(ctx, tx, merchantID, sessionID, driverID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !isPendingSession(status) {
+		tx.Rollback()
+		return fmt.Errorf("%w: session is %s", ErrIllegalSessionChange, status)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM delivery_session_order WHERE delivery_session_id = ? AND order_id = ?
+	`, sessionID, orderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+
+	if err := touchOrders(ctx, tx, `order_id = ?`, orderID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReorderOrders rewrites the stops priority, orderIDs must be exactly the orders of the session
+func (r *DeliverySessionsRepository) ReorderOrders(ctx context.Context, merchantID, sessionID, driverID string, orderIDs []string) error {
+	r.log.Info("ReorderOrders START", zap.String("delivery_session_id", sessionID), zap.Strings("order_ids", orderIDs))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	status, err := lockDeliverySession(ctx, tx, merchantID, sessionID, driverID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	// le livreur peut encore changer l'ordre de ses arrêts une fois parti
+	if status == SessionCompleted {
+		tx.Rollback()
+		return fmt.Errorf("%w: session is %s", ErrIllegalSessionChange, status)
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT order_id FROM delivery_session_order WHERE delivery_session_id = ?`, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	current := map[string]bool{}
+	for rows.Next() {
+		var oid string
+		if err := rows.Scan(&oid); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		current[oid] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, oid := range orderIDs {
+		if !current[oid] || seen[oid] {
+			tx.Rollback()
+			return fmt.Errorf("%w: order %s", ErrInvalidReference, oid)
+		}
+		seen[oid] = true
+	}
+	if len(seen) != len(current) {
+		tx.Rollback()
+		return fmt.Errorf("%w: every order of the session must be listed", ErrInvalidReference)
+	}
+
+	for i, oid := range orderIDs {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE delivery_session_order SET priority = ? WHERE delivery_session_id = ? AND order_id = ?
+		`, i+1, sessionID, oid); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := touchOrders(ctx, tx, `order_id IN (SELECT order_id FROM delivery_session_order WHERE delivery_session_id = ?)`, sessionID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateSessionStatus moves PENDING -> DEPARTED -> COMPLETED and carries the orders along:
+// departed = OPEN orders become DONE, completed = OPEN/DONE orders become CLOSED.
+// A session can't be completed while one of these orders is still unpaid (cash on delivery
+// not recorded yet): ErrIllegalSessionChange. Returns the ids of the orders that moved.
+func (r *DeliverySessionsRepository) UpdateSessionStatus(ctx context.Context, merchantID, sessionID, driverID, newStatus, userID string) ([]string, error) {
+	r.log.Info("UpdateSessionStatus START", zap.String("delivery_session_id", sessionID), zap.String("status", newStatus))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := lockDeliverySession(ctx, tx, merchantID, sessionID, driverID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var fromStates []string
+	var toState string
+	switch {
+	case newStatus == SessionDeparted && isPendingSession(status):
+		fromStates, toState = []string{"OPEN"}, "DONE"
+	case newStatus == SessionCompleted && status == SessionDeparted:
+		fromStates, toState = []string{"OPEN", "DONE"}, "CLOSED"
+	default:
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: %s -> %s", ErrIllegalSessionChange, status, newStatus)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT o.order_id, o.state, o.isPaid
+		FROM delivery_session_order dso
+		INNER JOIN orders o ON o.order_id = dso.order_id
+		WHERE dso.delivery_session_id = ?
+		FOR UPDATE`, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	type orderState struct {
+		id, state string
+		paid      bool
+	}
+	var orders []orderState
+	for rows.Next() {
+		var st orderState
+		var state sql.NullString
+		var isPaid sql.NullInt64
+		if err := rows.Scan(&st.id, &state, &isPaid); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		st.state = state.String
+		st.paid = isPaid.Int64 == 1
+		orders = append(orders, st)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if newStatus == SessionDeparted && len(orders) == 0 {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: session has no order", ErrIllegalSessionChange)
+	}
+
+	var moved []string
+	for _, o := range orders {
+		move := false
+		for _, s := range fromStates {
+			if o.state == s {
+				move = true
+			}
+		}
+		if !move {
+			continue
+		}
+		if toState == "CLOSED" && !o.paid {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: order %s is not paid", ErrIllegalSessionChange, o.id)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE orders SET state = ? WHERE order_id = ?`, toState, o.id); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := insertOrderStateHistory(ctx, tx, o.id, o.state, toState, userID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		moved = append(moved, o.id)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE delivery_session SET status = ? WHERE id = ?`, newStatus, sessionID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := touchOrders(ctx, tx, `order_id IN (SELECT order_id FROM delivery_session_order WHERE delivery_session_id = ?)`, sessionID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// lockDeliverySession locks the session row and returns its status. A non empty driverID
+// restricts the change to the driver of the session (ErrNotSessionDriver otherwise).
+func lockDeliverySession(ctx context.Context, tx *sql.Tx, merchantID, sessionID, driverID string) (string, error) {
+	var status, sessionDriver sql.NullString
+	err := tx.QueryRowContext(ctx, `
+		SELECT status, user_id FROM delivery_session WHERE id = ? AND merchant_id = ? FOR UPDATE
+	`, sessionID, merchantID).Scan(&status, &sessionDriver)
+	if err != nil {
+		return "", err
+	}
+	if driverID != "" && sessionDriver.String != driverID {
+		return "", ErrNotSessionDriver
+	}
+	return status.String, nil
+}
+
+func isPendingSession(status string) bool {
+	return status == "1" || status == SessionPending
+}
+
+// attachOrder : only delivery orders still in progress, one active session per order
+func attachOrder(ctx context.Context, tx *sql.Tx, merchantID, sessionID, orderID string) error {
+	var orderType, state sql.NullString
+	err := tx.QueryRowContext(ctx, `
+		SELECT order_type, state FROM orders WHERE order_id = ? AND merchant_id = ? FOR UPDATE
+	`, orderID, merchantID).Scan(&orderType, &state)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: order %s", ErrInvalidReference, orderID)
+	}
+	if err != nil {
+		return err
+	}
+	if orderType.String != "DELIVERY" || (state.String != "OPEN" && state.String != "DONE") {
+		return fmt.Errorf("%w: order %s is not an open delivery", ErrInvalidReference, orderID)
+	}
+
+	var currentSession string
+	err = tx.QueryRowContext(ctx, `
+		SELECT ds.id FROM delivery_session_order dso
+		INNER JOIN delivery_session ds ON ds.id = dso.delivery_session_id
+		WHERE dso.order_id = ? AND ds.status IN (`+activeSessionStatuses+`)
+		LIMIT 1`, orderID).Scan(&currentSession)
+	switch {
+	case err == nil && currentSession == sessionID:
+		return nil
+	case err == nil:
+		return fmt.Errorf("%w: order %s is in session %s", ErrOrderAlreadyAssigned, orderID, currentSession)
+	case err != sql.ErrNoRows:
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO delivery_session_order (delivery_session_id, order_id, priority)
+		SELECT ?, ?, COALESCE(MAX(priority), 0) + 1 FROM delivery_session_order WHERE delivery_session_id = ?
+	`, sessionID, orderID, sessionID); err != nil {
+		return fmt.Errorf("insert delivery_session_order error: %w", err)
+	}
+
+	return touchOrders(ctx, tx, `order_id = ?`, orderID)
+}
+
+// touchOrders bumps last_update so the apps pick the change up on their next delta sync
+func touchOrders(ctx context.Context, tx *sql.Tx, where string, args ...interface{}) error {
+	_, err := tx.ExecContext(ctx, `UPDATE orders SET last_update = UTC_TIMESTAMP() WHERE `+where, args...)
+	return err
+}
+
+// positionTrailSize : number of GPS fixes kept per session
+const positionTrailSize = 50
+
+// ErrNotSessionDriver : only the delivery man of the session can push its position or,
+// without the reception right, change the session
+var ErrNotSessionDriver = errors.New("user is not the driver of this delivery session")
+
+// RecordPosition stores a GPS fix in the session trail and as the driver's latest position (users.lat/lng)
+func (r *DeliverySessionsRepository) RecordPosition(ctx context.Context, merchantID, sessionID, userID string, lat, lng float64, recordedAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var status, driverID sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT status, user_id FROM delivery_session WHERE id = ? AND merchant_id = ?
+	`, sessionID, merchantID).Scan(&status, &driverID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if status.String == SessionCompleted {
+		tx.Rollback()
+		return fmt.Errorf("%w: session is %s", ErrIllegalSessionChange, status.String)
+	}
+	if driverID.String != userID {
+		tx.Rollback()
+		return ErrNotSessionDriver
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO delivery_session_position (delivery_session_id, user_id, lat, lng, recorded_at) VALUES (?, ?, ?, ?, ?)
+	`, sessionID, userID, lat, lng, recordedAt.UTC()); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("insert delivery_session_position error: %w", err)
+	}
+
+	// le device peut renvoyer des points en retard : on ne recule pas la position courante
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET lat = ?, lng = ?
+		WHERE user_id = ? AND NOT EXISTS (
+			SELECT 1 FROM delivery_session_position WHERE delivery_session_id = ? AND recorded_at > ?
+		)
+	`, lat, lng, userID, sessionID, recordedAt.UTC()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// MySQL refuse un LIMIT dans un IN direct : table dérivée
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM delivery_session_position
+		WHERE delivery_session_id = ? AND id NOT IN (
+			SELECT id FROM (
+				SELECT id FROM delivery_session_position WHERE delivery_session_id = ?
+				ORDER BY recorded_at DESC, id DESC LIMIT ?
+			) keep
+		)
+	`, sessionID, sessionID, positionTrailSize); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
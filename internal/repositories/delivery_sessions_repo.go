@@ -9,6 +9,16 @@ import (
 	"go.uber.org/zap"
 )
 
+// Statuts delivery_session ('1' = legacy PENDING)
+const (
+	SessionPending   = "PENDING"
+	SessionDeparted  = "DEPARTED"
+	SessionCompleted = "COMPLETED"
+)
+
+// activeSessionStatuses : une session partie reste visible tant qu'elle n'est pas terminée
+const activeSessionStatuses = "'1','PENDING','DEPARTED'"
+
 // LegacyOrdersRepository implements the PHP-style (legacy) data retrieval for pending orders
 type DeliverySessionsRepository struct {
 	db  *sql.DB
@@ -20,12 +30,12 @@ func NewDeliverySessionsRepository(db *sql.DB, log *zap.Logger) *DeliverySession
 }
 
 // GetPendingDeliverySessions : Optimisé pour éviter les timeouts
-func (r *DeliverySessionsRepository) GetPendingDeliverySessions(ctx context.Context, merchantID string) ([]models.DeliverySession, error) {
+func (r *DeliverySessionsRepository) GetPendingDeliverySessions(ctx context.Context, merchantID, lang string) ([]models.DeliverySession, error) {
 	// On instancie le repo orders (nécessaire pour le constructeur partagé)
 	ordersRepo := NewOrdersRepository(r.db, r.log)
 
 	// 1. Récupérer les sessions actives
-	sessions, err := r.fetchDeliverySessions(ctx, merchantID, "status IN ('1','PENDING')")
+	sessions, err := r.fetchDeliverySessions(ctx, merchantID, "ds.status IN ("+activeSessionStatuses+")")
 	if err != nil {
 		return nil, err
 	}
@@ -39,23 +49,20 @@ func (r *DeliverySessionsRepository) GetPendingDeliverySessions(ctx context.Cont
 	// Cela évite de refaire les jointures sessions <-> orders dans les 11 requêtes suivantes.
 
 	// A. Construire la liste des ID de sessions
-	sessionIDs := ""
-	for i, s := range sessions {
-		if i > 0 {
-			sessionIDs += ","
-		}
-		sessionIDs += fmt.Sprintf("'%s'", s.DeliverySessionID) // Ajout des quotes au cas où c'est du string/uuid
+	sessionIDs := make([]interface{}, 0, len(sessions))
+	for _, s := range sessions {
+		sessionIDs = append(sessionIDs, s.DeliverySessionID)
 	}
 
 	// B. Requête légère pour avoir juste les IDs des commandes
 	// On utilise r.db.QueryContext directement car c'est une requête interne simple
-	qOrderIDs := fmt.Sprintf(`
+	qOrderIDs := `
 		SELECT DISTINCT order_id 
 		FROM delivery_session_order 
-		WHERE delivery_session_id IN (%s)
-	`, sessionIDs)
+		WHERE delivery_session_id IN (` + placeholders(len(sessionIDs)) + `)
+	`
 
-	rows, err := r.db.QueryContext(ctx, qOrderIDs)
+	rows, err := r.db.QueryContext(ctx, qOrderIDs, sessionIDs...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch session order ids: %w", err)
 	}
@@ -75,17 +82,8 @@ func (r *DeliverySessionsRepository) GetPendingDeliverySessions(ctx context.Cont
 		return sessions, nil
 	}
 
-	// 3. Construire le filtre PAR ORDER ID (MySQL adore ça, c'est instantané)
-	ordersFilter := ""
-	for i, oid := range orderIDList {
-		if i > 0 {
-			ordersFilter += ","
-		}
-		ordersFilter += fmt.Sprintf("'%s'", oid)
-	}
-
-	// Le filtre magique : on tape directement sur la Primary Key ou l'index principal
-	filter := fmt.Sprintf(" AND o.order_id IN (%s) ", ordersFilter)
+	// 3. Filtre PAR ORDER ID (MySQL adore ça, c'est instantané) : on tape directement sur la Primary Key
+	filter := OrderFilter{OrderIDs: orderIDList, Lang: lang}
 
 	// 4. On appelle le monstre partagé avec ce filtre optimisé
 	orders, err := ordersRepo.fetchAndBuildOrders(ctx, merchantID, filter)
@@ -128,14 +126,15 @@ func (r *DeliverySessionsRepository) GetPendingDeliverySessions(ctx context.Cont
 }
 
 // fetchDeliverySessions : Helper pour récupérer les sessions seules
-func (r *DeliverySessionsRepository) fetchDeliverySessions(ctx context.Context, merchantID string, filterStatus string) ([]models.DeliverySession, error) {
+func (r *DeliverySessionsRepository) fetchDeliverySessions(ctx context.Context, merchantID string, filterStatus string, args ...interface{}) ([]models.DeliverySession, error) {
 	q := `
-       SELECT id, u.user_id, u.profile_picture, u.first_name, u.last_name, u.lat, u.lng, u.planning_color, ds.status
+       SELECT id, u.user_id, u.profile_picture, u.first_name, u.last_name, u.lat, u.lng, u.planning_color, ds.status,
+              (SELECT MAX(dsp.recorded_at) FROM delivery_session_position dsp WHERE dsp.delivery_session_id = ds.id)
        FROM delivery_session ds
        INNER JOIN users u on u.user_id = ds.user_id
        WHERE ds.merchant_id = ? AND ` + filterStatus
 
-	rows, err := r.db.QueryContext(ctx, q, merchantID)
+	rows, err := r.db.QueryContext(ctx, q, append([]interface{}{merchantID}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -145,7 +144,8 @@ func (r *DeliverySessionsRepository) fetchDeliverySessions(ctx context.Context,
 	for rows.Next() {
 		var profilePic, firstName, lastName, planningColor, status, id, userID sql.NullString
 		var lat, lng sql.NullFloat64
-		if err := rows.Scan(&id, &userID, &profilePic, &firstName, &lastName, &lat, &lng, &planningColor, &status); err != nil {
+		var positionAt sql.NullTime
+		if err := rows.Scan(&id, &userID, &profilePic, &firstName, &lastName, &lat, &lng, &planningColor, &status, &positionAt); err != nil {
 			return nil, err
 		}
 
@@ -160,6 +160,7 @@ func (r *DeliverySessionsRepository) fetchDeliverySessions(ctx context.Context,
 				UserID: userID.String, FirstName: &firstName.String, LastName: &lastName.String,
 				Lat: nullFloat64Ptr(lat), Lng: nullFloat64Ptr(lng),
 			},
+			PositionAt: nullTimePtr(positionAt),
 		}
 		sessions = append(sessions, ds)
 	}
@@ -179,7 +180,7 @@ func (r *DeliverySessionsRepository) GetDeliverySessions(ctx context.Context, me
 SELECT id, u.user_id, u.profile_picture, u.first_name, u.last_name, u.lat, u.lng, u.planning_color, ds.status
 FROM delivery_session ds
 INNER JOIN users u on u.user_id = ds.user_id
-WHERE status IN ('1','PENDING')
+WHERE ds.status IN (` + activeSessionStatuses + `)
 AND ds.merchant_id = ?`
 	rows, err := tx.QueryContext(ctx, qDeliverySessions, merchantID)
 	if err != nil {
@@ -0,0 +1,485 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// ErrTableInUse : the table has an open order or an upcoming booking, it can't be removed
+var ErrTableInUse = errors.New("table in use")
+
+// GetFloors : enabled floors of the merchant with their areas and tables
+func (r *LocationsRepository) GetFloors(ctx context.Context, merchantID string) ([]models.Floor, error) {
+	r.log.Info("GetFloors START", zap.String("merchant_id", merchantID))
+	return r.loadFloors(ctx, merchantID, "")
+}
+
+// GetFloor : sql.ErrNoRows if not an enabled floor of the merchant
+func (r *LocationsRepository) GetFloor(ctx context.Context, merchantID, floorID string) (*models.Floor, error) {
+	floors, err := r.loadFloors(ctx, merchantID, floorID)
+	if err != nil {
+		return nil, err
+	}
+	if len(floors) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &floors[0], nil
+}
+
+// loadFloors : floorID "" = every floor
+func (r *LocationsRepository) loadFloors(ctx context.Context, merchantID, floorID string) ([]models.Floor, error) {
+	criteria := ""
+	args := []interface{}{merchantID}
+	if floorID != "" {
+		criteria = " AND f.id = ? "
+		args = append(args, floorID)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT f.id, f.name FROM floors f
+		WHERE f.merchant_id = ? AND f.enabled IS TRUE `+criteria+`
+		ORDER BY f.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("floors query error: %w", err)
+	}
+	defer rows.Close()
+
+	floors := []models.Floor{}
+	index := map[string]int{}
+	for rows.Next() {
+		var f models.Floor
+		var name sql.NullString
+		if err := rows.Scan(&f.FloorID, &name); err != nil {
+			return nil, err
+		}
+		f.Name = name.String
+		f.Areas = []models.Area{}
+		f.Tables = []models.FloorTable{}
+		index[f.FloorID] = len(floors)
+		floors = append(floors, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(floors) == 0 {
+		return floors, nil
+	}
+
+	areaRows, err := r.db.QueryContext(ctx, `
+		SELECT fa.id, fa.floor_id, fa.name, fa.points, fa.x, fa.y, fa.angle, fa.stroke_color, fa.color
+		FROM floor_areas fa
+		INNER JOIN floors f ON f.id = fa.floor_id
+		WHERE f.merchant_id = ? AND f.enabled IS TRUE AND fa.enabled IS TRUE `+criteria+`
+		ORDER BY fa.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("floor_areas query error: %w", err)
+	}
+	defer areaRows.Close()
+
+	for areaRows.Next() {
+		var a models.Area
+		var name, points, strokeColor, color sql.NullString
+		var x, y, angle sql.NullFloat64
+		if err := areaRows.Scan(&a.AreaID, &a.FloorID, &name, &points, &x, &y, &angle, &strokeColor, &color); err != nil {
+			return nil, err
+		}
+		a.Name = name.String
+		a.Points = parseAreaPoints(points.String)
+		a.X, a.Y, a.Angle = x.Float64, y.Float64, angle.Float64
+		a.StrokeColor = nullStringToPtr(strokeColor)
+		a.Color = nullStringToPtr(color)
+		if i, ok := index[a.FloorID]; ok {
+			floors[i].Areas = append(floors[i].Areas, a)
+		}
+	}
+	if err := areaRows.Err(); err != nil {
+		return nil, err
+	}
+
+	tableRows, err := r.db.QueryContext(ctx, `
+		SELECT l.location_id, l.location_name, l.location_desc, l.seats, l.location_order, l.floor_id,
+		       l.shape, l.current_x, l.current_y, l.current_width, l.current_height, l.angle
+		FROM locations l
+		INNER JOIN floors f ON f.id = l.floor_id AND f.merchant_id = l.merchant_id
+		WHERE l.merchant_id = ? AND l.enabled IS TRUE AND f.enabled IS TRUE `+criteria+`
+		ORDER BY l.location_order`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("floor tables query error: %w", err)
+	}
+	defer tableRows.Close()
+
+	for tableRows.Next() {
+		var t models.FloorTable
+		var name, desc, shape sql.NullString
+		var seats, order sql.NullInt64
+		var x, y, w, h, angle sql.NullFloat64
+		if err := tableRows.Scan(&t.LocationID, &name, &desc, &seats, &order, &t.FloorID,
+			&shape, &x, &y, &w, &h, &angle); err != nil {
+			return nil, err
+		}
+		t.LocationName = name.String
+		t.LocationDesc = nullStringToPtr(desc)
+		t.Seats = int(seats.Int64)
+		t.Order = int(order.Int64)
+		t.Shape = shape.String
+		t.X, t.Y, t.Width, t.Height, t.Angle = x.Float64, y.Float64, w.Float64, h.Float64, angle.Float64
+		if i, ok := index[t.FloorID]; ok {
+			floors[i].Tables = append(floors[i].Tables, t)
+		}
+	}
+	return floors, tableRows.Err()
+}
+
+func (r *LocationsRepository) CreateFloor(ctx context.Context, merchantID, name string) (string, error) {
+	r.log.Info("CreateFloor START", zap.String("merchant_id", merchantID))
+
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO floors (merchant_id, name, enabled) VALUES (?, ?, TRUE)
+	`, merchantID, name)
+	if err != nil {
+		return "", fmt.Errorf("insert floor error: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+func (r *LocationsRepository) RenameFloor(ctx context.Context, merchantID, floorID, name string) error {
+	return r.inFloorTx(ctx, merchantID, floorID, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE floors SET name = ? WHERE id = ?`, name, floorID)
+		return err
+	})
+}
+
+// DeleteFloor disables the floor with its areas and tables, refused while one of its tables is in use
+func (r *LocationsRepository) DeleteFloor(ctx context.Context, merchantID, floorID string) error {
+	r.log.Info("DeleteFloor START", zap.String("merchant_id", merchantID), zap.String("floor_id", floorID))
+
+	return r.inFloorTx(ctx, merchantID, floorID, func(tx *sql.Tx) error {
+		if err := removeFloorTables(ctx, tx, merchantID, floorID, nil); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE floor_areas SET enabled = FALSE WHERE floor_id = ?`, floorID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE floors SET enabled = FALSE WHERE id = ?`, floorID)
+		return err
+	})
+}
+
+// SaveArea creates the area (no id) or updates it, returns its id
+func (r *LocationsRepository) SaveArea(ctx context.Context, merchantID string, area models.Area) (string, error) {
+	var areaID string
+	err := r.inFloorTx(ctx, merchantID, area.FloorID, func(tx *sql.Tx) error {
+		var err error
+		areaID, err = saveArea(ctx, tx, area)
+		return err
+	})
+	return areaID, err
+}
+
+func (r *LocationsRepository) DeleteArea(ctx context.Context, merchantID, floorID, areaID string) error {
+	return r.inFloorTx(ctx, merchantID, floorID, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE floor_areas SET enabled = FALSE WHERE id = ? AND floor_id = ? AND enabled IS TRUE
+		`, areaID, floorID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// SaveTable creates the table (no location_id) or updates it, possibly moving it to table.FloorID
+func (r *LocationsRepository) SaveTable(ctx context.Context, merchantID string, table models.FloorTable) (string, error) {
+	var locationID string
+	err := r.inFloorTx(ctx, merchantID, table.FloorID, func(tx *sql.Tx) error {
+		var err error
+		locationID, err = saveTable(ctx, tx, merchantID, table)
+		return err
+	})
+	return locationID, err
+}
+
+// DeleteTable disables the table, refused while it is in use
+func (r *LocationsRepository) DeleteTable(ctx context.Context, merchantID, floorID, locationID string) error {
+	r.log.Info("DeleteTable START", zap.String("merchant_id", merchantID), zap.String("location_id", locationID))
+
+	return r.inFloorTx(ctx, merchantID, floorID, func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRowContext(ctx, `
+			SELECT 1 FROM locations WHERE location_id = ? AND merchant_id = ? AND floor_id = ? AND enabled IS TRUE
+		`, locationID, merchantID, floorID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		return disableTables(ctx, tx, merchantID, []string{locationID})
+	})
+}
+
+// SaveFloorLayout applies a whole floor in one transaction: rename, upsert the areas and tables
+// given, remove the floor's areas and tables that are not in the request
+func (r *LocationsRepository) SaveFloorLayout(ctx context.Context, merchantID, floorID string, layout models.FloorLayoutRequest) error {
+	r.log.Info("SaveFloorLayout START", zap.String("merchant_id", merchantID), zap.String("floor_id", floorID),
+		zap.Int("areas", len(layout.Areas)), zap.Int("tables", len(layout.Tables)))
+
+	return r.inFloorTx(ctx, merchantID, floorID, func(tx *sql.Tx) error {
+		if layout.Name != nil {
+			if _, err := tx.ExecContext(ctx, `UPDATE floors SET name = ? WHERE id = ?`, *layout.Name, floorID); err != nil {
+				return err
+			}
+		}
+
+		keptAreas := make([]interface{}, 0, len(layout.Areas))
+		for _, a := range layout.Areas {
+			a.FloorID = floorID
+			id, err := saveArea(ctx, tx, a)
+			if err != nil {
+				return err
+			}
+			keptAreas = append(keptAreas, id)
+		}
+		q := `UPDATE floor_areas SET enabled = FALSE WHERE floor_id = ? AND enabled IS TRUE`
+		if len(keptAreas) > 0 {
+			q += ` AND id NOT IN (` + placeholders(len(keptAreas)) + `)`
+		}
+		if _, err := tx.ExecContext(ctx, q, append([]interface{}{floorID}, keptAreas...)...); err != nil {
+			return err
+		}
+
+		keptTables := make([]string, 0, len(layout.Tables))
+		for _, t := range layout.Tables {
+			t.FloorID = floorID
+			id, err := saveTable(ctx, tx, merchantID, t)
+			if err != nil {
+				return err
+			}
+			keptTables = append(keptTables, id)
+		}
+		return removeFloorTables(ctx, tx, merchantID, floorID, keptTables)
+	})
+}
+
+// inFloorTx : fn runs with the floor row locked, sql.ErrNoRows if not an enabled floor of the merchant
+func (r *LocationsRepository) inFloorTx(ctx context.Context, merchantID, floorID string, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var id string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM floors WHERE id = ? AND merchant_id = ? AND enabled IS TRUE FOR UPDATE
+	`, floorID, merchantID).Scan(&id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveArea(ctx context.Context, tx *sql.Tx, a models.Area) (string, error) {
+	points, err := json.Marshal(a.Points)
+	if err != nil {
+		return "", err
+	}
+
+	if a.AreaID == "" {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO floor_areas (floor_id, name, points, x, y, angle, stroke_color, color, enabled)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, TRUE)
+		`, a.FloorID, a.Name, string(points), a.X, a.Y, a.Angle, a.StrokeColor, a.Color)
+		if err != nil {
+			return "", fmt.Errorf("insert floor_area error: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(id, 10), nil
+	}
+
+	// l'aire doit déjà être sur cet étage : pas de déplacement d'un étage à l'autre
+	var exists int
+	err = tx.QueryRowContext(ctx, `
+		SELECT 1 FROM floor_areas WHERE id = ? AND floor_id = ? AND enabled IS TRUE
+	`, a.AreaID, a.FloorID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: area %s", ErrInvalidReference, a.AreaID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE floor_areas SET name = ?, points = ?, x = ?, y = ?, angle = ?, stroke_color = ?, color = ?
+		WHERE id = ?
+	`, a.Name, string(points), a.X, a.Y, a.Angle, a.StrokeColor, a.Color, a.AreaID); err != nil {
+		return "", fmt.Errorf("update floor_area error: %w", err)
+	}
+	return a.AreaID, nil
+}
+
+func saveTable(ctx context.Context, tx *sql.Tx, merchantID string, t models.FloorTable) (string, error) {
+	if t.LocationID == "" {
+		order := t.Order
+		if order == 0 {
+			if err := tx.QueryRowContext(ctx, `
+				SELECT COALESCE(MAX(location_order), 0) + 1 FROM locations WHERE merchant_id = ?
+			`, merchantID).Scan(&order); err != nil {
+				return "", err
+			}
+		}
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO locations (merchant_id, floor_id, location_name, location_desc, seats, location_order,
+			                       shape, current_x, current_y, current_width, current_height, angle, enabled)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, TRUE)
+		`, merchantID, t.FloorID, t.LocationName, t.LocationDesc, t.Seats, order,
+			t.Shape, t.X, t.Y, t.Width, t.Height, t.Angle)
+		if err != nil {
+			return "", fmt.Errorf("insert location error: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(id, 10), nil
+	}
+
+	var order int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(location_order, 0) FROM locations
+		WHERE location_id = ? AND merchant_id = ? AND enabled IS TRUE
+		FOR UPDATE`, t.LocationID, merchantID).Scan(&order)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: location %s", ErrInvalidReference, t.LocationID)
+	}
+	if err != nil {
+		return "", err
+	}
+	if t.Order != 0 {
+		order = t.Order
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE locations
+		SET floor_id = ?, location_name = ?, location_desc = ?, seats = ?, location_order = ?,
+		    shape = ?, current_x = ?, current_y = ?, current_width = ?, current_height = ?, angle = ?
+		WHERE location_id = ? AND merchant_id = ?
+	`, t.FloorID, t.LocationName, t.LocationDesc, t.Seats, order,
+		t.Shape, t.X, t.Y, t.Width, t.Height, t.Angle, t.LocationID, merchantID); err != nil {
+		return "", fmt.Errorf("update location error: %w", err)
+	}
+	return t.LocationID, nil
+}
+
+// removeFloorTables disables the tables of the floor except kept
+func removeFloorTables(ctx context.Context, tx *sql.Tx, merchantID, floorID string, kept []string) error {
+	args := []interface{}{merchantID, floorID}
+	q := `SELECT location_id FROM locations WHERE merchant_id = ? AND floor_id = ? AND enabled IS TRUE`
+	if len(kept) > 0 {
+		q += ` AND location_id NOT IN (` + placeholders(len(kept)) + `)`
+		for _, id := range kept {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return disableTables(ctx, tx, merchantID, ids)
+}
+
+// disableTables : ErrTableInUse if one of them has an open order or an active booking not over yet
+func disableTables(ctx context.Context, tx *sql.Tx, merchantID string, locationIDs []string) error {
+	ids := make([]interface{}, 0, len(locationIDs))
+	for _, id := range locationIDs {
+		ids = append(ids, id)
+	}
+
+	var busy string
+	args := append([]interface{}{merchantID}, ids...)
+	args = append(args, merchantID)
+	args = append(args, ids...)
+	err := tx.QueryRowContext(ctx, `
+		SELECT ol.location_id FROM order_location ol
+		INNER JOIN orders o ON o.order_id = ol.order_id
+		WHERE o.merchant_id = ? AND o.state NOT IN ('DELETED','DONE','CANCELED','CLOSED')
+		AND ol.location_id IN (`+placeholders(len(ids))+`)
+		UNION
+		SELECT bl.location_id FROM booked_location bl
+		INNER JOIN bookings b ON b.booking_id = bl.booking_id
+		WHERE b.merchant_id = ? AND b.status IN (`+activeBookingStatuses+`) AND b.booking_date_to > UTC_TIMESTAMP()
+		AND bl.location_id IN (`+placeholders(len(ids))+`)
+		LIMIT 1`, args...).Scan(&busy)
+	if err == nil {
+		return fmt.Errorf("%w: location %s", ErrTableInUse, busy)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE locations SET enabled = FALSE
+		WHERE merchant_id = ? AND location_id IN (`+placeholders(len(ids))+`)
+	`, append([]interface{}{merchantID}, ids...)...)
+	return err
+}
+
+// parseAreaPoints : points are stored as JSON, flat [x1, y1, ...] or older [{"x":..,"y":..}, ...]
+func parseAreaPoints(raw string) []float64 {
+	points := []float64{}
+	if raw == "" {
+		return points
+	}
+	if err := json.Unmarshal([]byte(raw), &points); err == nil {
+		return points
+	}
+
+	var pairs []struct {
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+	}
+	if err := json.Unmarshal([]byte(raw), &pairs); err != nil {
+		return []float64{}
+	}
+	points = make([]float64, 0, len(pairs)*2)
+	for _, p := range pairs {
+		points = append(points, p.X, p.Y)
+	}
+	return points
+}
@@ -0,0 +1,273 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// Production statuses stored in orderitems.production_status
+const (
+	ProductionPending     = "PENDING"
+	ProductionInProgress  = "IN_PROGRESS"
+	ProductionReady       = "READY"
+	ProductionDistributed = "DISTRIBUTED"
+)
+
+// ErrQuantityUnavailable : the cook asks to move more than what is left in the previous step
+var ErrQuantityUnavailable = errors.New("quantity unavailable for this production step")
+
+// ErrProductionBackwards : IN_PROGRESS asked for an item already READY / DISTRIBUTED,
+// steps only move forward
+var ErrProductionBackwards = errors.New("production status can't move backwards")
+
+type KitchenRepository struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewKitchenRepository(db *sql.DB, log *zap.Logger) *KitchenRepository {
+	return &KitchenRepository{db: db, log: log}
+}
+
+// GetOpenItems returns every order item of an OPEN order that is not fully distributed, oldest first
+func (r *KitchenRepository) GetOpenItems(ctx context.Context, merchantID string, onlyPaid bool) ([]models.KitchenItem, error) {
+	r.log.Info("GetOpenItems START", zap.String("merchant_id", merchantID), zap.Bool("only_paid", onlyPaid))
+
+	filter := ""
+	if onlyPaid {
+		filter = " AND (o.isPaid = 1 OR oi.isPaid = 1) "
+	}
+
+	q := `
+		SELECT o.order_id, o.order_num, o.order_type, oi.order_item_id, oi.product_id, p.name, pc.categ_name, p.production_color,
+		       oi.quantity, oi.production_status, oi.production_status_done_quantity, oi.ready_for_distribution_quantity,
+		       oi.distributed_quantity, oi.ordered_on, TIMESTAMPDIFF(SECOND, oi.ordered_on, UTC_TIMESTAMP()), oi.isPaid
+		FROM orders o
+		INNER JOIN orderitems oi ON oi.order_id = o.order_id AND oi.merchant_id = o.merchant_id
+		INNER JOIN products p ON p.product_id = oi.product_id AND p.merchant_id = oi.merchant_id
+		LEFT JOIN productcateg pc ON pc.merchant_id = oi.merchant_id AND p.category = pc.merchant_categ_id
+		WHERE o.merchant_id = ? AND o.state = 'OPEN' AND oi.quantity > 0
+		AND oi.distributed_quantity < oi.quantity ` + filter + `
+		ORDER BY oi.ordered_on ASC, oi.order_item_id ASC`
+
+	rows, err := r.db.QueryContext(ctx, q, merchantID)
+	if err != nil {
+		return nil, fmt.Errorf("kitchen items query error: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.KitchenItem{}
+	index := map[string]int{}
+	for rows.Next() {
+		var it models.KitchenItem
+		var orderNum, orderType, category, color, status sql.NullString
+		var done, ready, distributed, elapsed sql.NullInt64
+		var orderedOn sql.NullTime
+		var isPaid sql.NullBool
+
+		if err := rows.Scan(&it.OrderID, &orderNum, &orderType, &it.OrderItemID, &it.ProductID, &it.Name, &category, &color,
+			&it.Quantity, &status, &done, &ready, &distributed, &orderedOn, &elapsed, &isPaid); err != nil {
+			return nil, err
+		}
+		it.OrderNum = nullStringToPtr(orderNum)
+		it.OrderType = nullStringToPtr(orderType)
+		it.Category = nullStringToPtr(category)
+		it.ProductionColor = nullStringToPtr(color)
+		it.ProductionStatus = status.String
+		if it.ProductionStatus == "" {
+			it.ProductionStatus = ProductionPending
+		}
+		it.ProductionStatusDoneQuantity = int(done.Int64)
+		it.ReadyForDistributionQuantity = int(ready.Int64)
+		it.DistributedQuantity = int(distributed.Int64)
+		it.OrderedOn = nullTimePtr(orderedOn)
+		it.ElapsedSeconds = elapsed.Int64
+		it.IsPaid = isPaid.Bool
+		it.Extra = []string{}
+		it.Without = []string{}
+
+		index[it.OrderItemID] = len(items)
+		items = append(items, it)
+	}
+	if len(items) == 0 {
+		return items, nil
+	}
+
+	// extras / withouts : names only, that's what the cook needs
+	for _, step := range []struct {
+		table string
+		extra bool
+	}{{"extra", true}, {"without", false}} {
+		q := `
+			SELECT x.order_item_id, c.name
+			FROM ` + step.table + ` x
+			INNER JOIN orders o ON o.order_id = x.order_id
+			INNER JOIN components c ON c.component_id = x.component_id AND c.merchant_id = o.merchant_id
+			WHERE o.merchant_id = ? AND o.state = 'OPEN'`
+		rows, err := r.db.QueryContext(ctx, q, merchantID)
+		if err != nil {
+			return nil, fmt.Errorf("kitchen %s query error: %w", step.table, err)
+		}
+		for rows.Next() {
+			var orderItemID, name sql.NullString
+			if err := rows.Scan(&orderItemID, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			i, ok := index[orderItemID.String]
+			if !ok {
+				continue
+			}
+			if step.extra {
+				items[i].Extra = append(items[i].Extra, name.String)
+			} else {
+				items[i].Without = append(items[i].Without, name.String)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// comments : one line per comment of the item, in the order they were written
+	rows, err = r.db.QueryContext(ctx, `
+		SELECT oc.order_item_id, oc.content
+		FROM order_comments oc
+		INNER JOIN orders o ON o.order_id = oc.order_id
+		WHERE o.merchant_id = ? AND o.state = 'OPEN' AND oc.order_item_id IS NOT NULL
+		ORDER BY oc.creation_date ASC, oc.id ASC`, merchantID)
+	if err != nil {
+		return nil, fmt.Errorf("kitchen comments query error: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var orderItemID, content sql.NullString
+		if err := rows.Scan(&orderItemID, &content); err != nil {
+			return nil, err
+		}
+		i, ok := index[orderItemID.String]
+		if !ok || !content.Valid {
+			continue
+		}
+		if items[i].Comment == nil {
+			items[i].Comment = &content.String
+			continue
+		}
+		joined := *items[i].Comment + "\n" + content.String
+		items[i].Comment = &joined
+	}
+
+	return items, rows.Err()
+}
+
+// UpdateItemStatus moves quantities of an order item through the production steps
+// and returns the order it belongs to. quantity <= 0 means "everything available".
+// The order must still be OPEN, ErrStateConflict otherwise.
+func (r *KitchenRepository) UpdateItemStatus(ctx context.Context, merchantID, orderItemID, status string, quantity int) (string, error) {
+	r.log.Info("UpdateItemStatus START", zap.String("order_item_id", orderItemID), zap.String("status", status), zap.Int("quantity", quantity))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var orderID string
+	var current, orderState sql.NullString
+	var qty, done, ready, distributed sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+		SELECT oi.order_id, oi.production_status, oi.quantity, oi.production_status_done_quantity,
+		       oi.ready_for_distribution_quantity, oi.distributed_quantity, o.state
+		FROM orderitems oi
+		INNER JOIN orders o ON o.order_id = oi.order_id
+		WHERE oi.order_item_id = ? AND oi.merchant_id = ?
+		FOR UPDATE
+	`, orderItemID, merchantID).Scan(&orderID, &current, &qty, &done, &ready, &distributed, &orderState)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	// commande clôturée / annulée entre l'affichage de l'écran cuisine et le tap
+	if orderState.String != "OPEN" {
+		tx.Rollback()
+		return "", fmt.Errorf("%w: order is %s", ErrStateConflict, orderState.String)
+	}
+
+	switch status {
+	case ProductionInProgress:
+		// un tap en retard (ou en double) ne doit pas renvoyer en cuisine un item déjà prêt
+		if current.String == ProductionReady || current.String == ProductionDistributed {
+			tx.Rollback()
+			return "", fmt.Errorf("%w: item is %s", ErrProductionBackwards, current.String)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE orderitems SET production_status = ? WHERE order_item_id = ?
+		`, ProductionInProgress, orderItemID)
+
+	case ProductionReady:
+		remaining := int(qty.Int64 - done.Int64)
+		if quantity <= 0 {
+			quantity = remaining
+		}
+		if quantity <= 0 || quantity > remaining {
+			tx.Rollback()
+			return "", fmt.Errorf("%w: %d left to produce", ErrQuantityUnavailable, remaining)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE orderitems
+			SET production_status_done_quantity = production_status_done_quantity + ?,
+			    ready_for_distribution_quantity = ready_for_distribution_quantity + ?,
+			    production_status = CASE WHEN production_status_done_quantity >= quantity THEN ? ELSE ? END
+			WHERE order_item_id = ?
+		`, quantity, quantity, ProductionReady, ProductionInProgress, orderItemID)
+
+	case ProductionDistributed:
+		available := int(ready.Int64)
+		if quantity <= 0 {
+			quantity = available
+		}
+		if quantity <= 0 || quantity > available {
+			tx.Rollback()
+			return "", fmt.Errorf("%w: %d ready for distribution", ErrQuantityUnavailable, available)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE orderitems
+			SET distributed_quantity = distributed_quantity + ?,
+			    ready_for_distribution_quantity = ready_for_distribution_quantity - ?,
+			    isDistributed = (distributed_quantity >= quantity),
+			    production_status = CASE WHEN distributed_quantity >= quantity THEN ? ELSE production_status END
+			WHERE order_item_id = ?
+		`, quantity, quantity, ProductionDistributed, orderItemID)
+
+	default:
+		tx.Rollback()
+		return "", fmt.Errorf("unknown production status %q", status)
+	}
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	// order is distributed once every item is
+	_, err = tx.ExecContext(ctx, `
+		UPDATE orders o
+		SET o.isDistributed = NOT EXISTS (
+			SELECT 1 FROM orderitems oi
+			WHERE oi.order_id = o.order_id AND oi.quantity > 0 AND oi.distributed_quantity < oi.quantity
+		),
+		o.last_update = UTC_TIMESTAMP()
+		WHERE o.order_id = ?
+	`, orderID)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	return orderID, tx.Commit()
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"welloresto-api/internal/models"
 
 	"go.uber.org/zap"
@@ -25,7 +24,7 @@ func (r *LocationsRepository) GetLocations(ctx context.Context, merchantID strin
 	// ---------------------------------------------
 	// 1) LOCATIONS + TABLES OUVERTES
 	// ---------------------------------------------
-	queryLocations := fmt.Sprintf(`
+	queryLocations := `
 		SELECT DISTINCT 
 			l.location_id, l.location_name, l.location_desc, l.seats, 
 			l.location_order, l.floor_id, l.shape, l.current_x, l.current_y,
@@ -37,14 +36,14 @@ func (r *LocationsRepository) GetLocations(ctx context.Context, merchantID strin
 			FROM order_location ol
 			INNER JOIN orders o ON o.order_id = ol.order_id
 			WHERE o.state NOT IN ('DELETED','DONE','CANCELED','CLOSED')
-			AND o.merchant_id = %s
+			AND o.merchant_id = ?
 		) ol ON l.location_id = ol.location_id
-		WHERE l.merchant_id = %s
+		WHERE l.merchant_id = ?
 		AND l.enabled IS TRUE
 		ORDER BY l.location_order ASC;
-	`, merchantID, merchantID)
+	`
 
-	rowsLoc, err := r.db.QueryContext(ctx, queryLocations)
+	rowsLoc, err := r.db.QueryContext(ctx, queryLocations, merchantID, merchantID)
 	if err != nil {
 		r.log.Error("locations query error", zap.Error(err))
 		return nil, err
@@ -68,7 +67,7 @@ func (r *LocationsRepository) GetLocations(ctx context.Context, merchantID strin
 	// ---------------------------------------------
 	// 2) BOOKINGS
 	// ---------------------------------------------
-	queryBookings := fmt.Sprintf(`
+	queryBookings := `
 		SELECT 
 			b.booking_id, b.booking_number, b.comment, b.party_size, 
 			bl.location_id, b.booking_date_from, b.booking_date_to, 
@@ -78,12 +77,12 @@ func (r *LocationsRepository) GetLocations(ctx context.Context, merchantID strin
 		INNER JOIN booked_location bl ON bl.booking_id = b.booking_id
 		INNER JOIN locations l ON l.location_id = bl.location_id
 		INNER JOIN customer c ON c.customer_id = b.customer_id
-		WHERE b.merchant_id = %s
+		WHERE b.merchant_id = ?
 		AND b.status IN ('ACCEPTED')
 		AND b.booking_date_to > UTC_TIMESTAMP - INTERVAL 5 HOUR;
-	`, merchantID)
+	`
 
-	rowsBook, err := r.db.QueryContext(ctx, queryBookings)
+	rowsBook, err := r.db.QueryContext(ctx, queryBookings, merchantID)
 	if err != nil {
 		r.log.Error("bookings query error", zap.Error(err))
 		return nil, err
@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// ErrComponentOutOfStock : a product can't come back while a component of its recipe is out
+var ErrComponentOutOfStock = errors.New("component out of stock")
+
+// products.unavailable_reason / components.unavailable_reason
+const (
+	unavailableManual      = "MANUAL"
+	unavailableComponent   = "COMPONENT"
+	unavailableSafetyStock = "SAFETY_STOCK"
+)
+
+// SetProductAvailability 86s / brings back one product. Only the products whose status
+// actually changed are returned.
+func (r *MenuRepository) SetProductAvailability(ctx context.Context, merchantID, productID string, available bool) (*models.AvailabilityChange, error) {
+	r.log.Info("SetProductAvailability START", zap.String("merchant_id", merchantID), zap.String("product_id", productID), zap.Bool("available", available))
+
+	change := &models.AvailabilityChange{Available: available, ProductIDs: []string{}, ComponentIDs: []string{}}
+	err := r.inMenuTx(ctx, merchantID, func(tx *sql.Tx) error {
+		var status sql.NullInt64
+		err := tx.QueryRowContext(ctx, `
+			SELECT status FROM products WHERE merchant_id = ? AND product_id = ? AND enabled = 1
+			FOR UPDATE`, merchantID, productID).Scan(&status)
+		if err != nil {
+			return err
+		}
+
+		if available {
+			var component string
+			err := tx.QueryRowContext(ctx, `
+				SELECT c.name FROM recipes rc
+				INNER JOIN requires rq ON rq.recipe_id = rc.recipe_id AND rq.enabled = 1
+				INNER JOIN components c ON c.component_id = rq.component_id
+				WHERE rc.product_id = ? AND c.merchant_id = ? AND c.status = 0
+				LIMIT 1`, productID, merchantID).Scan(&component)
+			if err == nil {
+				return fmt.Errorf("%w: %s", ErrComponentOutOfStock, component)
+			}
+			if err != sql.ErrNoRows {
+				return err
+			}
+		}
+
+		if (status.Int64 == 1) == available {
+			// déjà out à cause d'un composant : il devient MANUAL, le retour du composant ne le remet plus
+			if !available {
+				_, err := tx.ExecContext(ctx, `
+					UPDATE products SET unavailable_reason = ? WHERE merchant_id = ? AND product_id = ?
+				`, unavailableManual, merchantID, productID)
+				return err
+			}
+			return nil
+		}
+		reason := interface{}(nil)
+		if !available {
+			reason = unavailableManual
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE products SET status = ?, unavailable_reason = ? WHERE merchant_id = ? AND product_id = ?
+		`, available, reason, merchantID, productID); err != nil {
+			return err
+		}
+		change.ProductIDs = append(change.ProductIDs, productID)
+		return queueAvailabilitySync(ctx, tx, merchantID, change.ProductIDs, available)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// SetComponentAvailability 86s / brings back a component, with the products of its recipes
+func (r *MenuRepository) SetComponentAvailability(ctx context.Context, merchantID, componentID string, available bool) (*models.AvailabilityChange, error) {
+	r.log.Info("SetComponentAvailability START", zap.String("merchant_id", merchantID), zap.String("component_id", componentID), zap.Bool("available", available))
+
+	var change *models.AvailabilityChange
+	err := r.inMenuTx(ctx, merchantID, func(tx *sql.Tx) error {
+		var err error
+		change, err = setComponentAvailability(ctx, tx, merchantID, componentID, available, unavailableManual)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// setComponentAvailability : out (for reason, MANUAL or SAFETY_STOCK), every available product
+// requiring it goes out (COMPONENT); back, the products it took out come back unless another
+// of their components is still out.
+// Runs in the caller's transaction, sql.ErrNoRows if not a component of the merchant.
+func setComponentAvailability(ctx context.Context, tx *sql.Tx, merchantID, componentID string, available bool, reason string) (*models.AvailabilityChange, error) {
+	change := &models.AvailabilityChange{Available: available, ProductIDs: []string{}, ComponentIDs: []string{}}
+
+	var status sql.NullInt64
+	err := tx.QueryRowContext(ctx, `
+		SELECT status FROM components WHERE merchant_id = ? AND component_id = ?
+		FOR UPDATE`, merchantID, componentID).Scan(&status)
+	if err != nil {
+		return nil, err
+	}
+	if (status.Int64 == 1) == available {
+		// déjà out sous le stock de sécurité : il devient MANUAL, une réception ne le remet plus
+		if !available && reason == unavailableManual {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE components SET unavailable_reason = ? WHERE merchant_id = ? AND component_id = ?
+			`, unavailableManual, merchantID, componentID)
+			return change, err
+		}
+		return change, nil
+	}
+
+	componentReason := interface{}(nil)
+	if !available {
+		componentReason = reason
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE components SET status = ?, unavailable_reason = ? WHERE merchant_id = ? AND component_id = ?
+	`, available, componentReason, merchantID, componentID); err != nil {
+		return nil, err
+	}
+	change.ComponentIDs = append(change.ComponentIDs, componentID)
+
+	var q string
+	if available {
+		q = `
+			SELECT DISTINCT p.product_id FROM products p
+			INNER JOIN recipes rc ON rc.product_id = p.product_id
+			INNER JOIN requires rq ON rq.recipe_id = rc.recipe_id AND rq.enabled = 1
+			WHERE p.merchant_id = ? AND rq.component_id = ? AND p.enabled = 1
+			AND p.status = 0 AND p.unavailable_reason = '` + unavailableComponent + `'
+			AND NOT EXISTS (
+				SELECT 1 FROM recipes rc2
+				INNER JOIN requires rq2 ON rq2.recipe_id = rc2.recipe_id AND rq2.enabled = 1
+				INNER JOIN components c2 ON c2.component_id = rq2.component_id
+				WHERE rc2.product_id = p.product_id AND c2.status = 0
+			)
+			FOR UPDATE`
+	} else {
+		q = `
+			SELECT DISTINCT p.product_id FROM products p
+			INNER JOIN recipes rc ON rc.product_id = p.product_id
+			INNER JOIN requires rq ON rq.recipe_id = rc.recipe_id AND rq.enabled = 1
+			WHERE p.merchant_id = ? AND rq.component_id = ? AND p.enabled = 1 AND p.status = 1
+			FOR UPDATE`
+	}
+	rows, err := tx.QueryContext(ctx, q, merchantID, componentID)
+	if err != nil {
+		return nil, fmt.Errorf("component products query error: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		change.ProductIDs = append(change.ProductIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(change.ProductIDs) > 0 {
+		reason := interface{}(nil)
+		if !available {
+			reason = unavailableComponent
+		}
+		args := []interface{}{available, reason, merchantID}
+		for _, id := range change.ProductIDs {
+			args = append(args, id)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE products SET status = ?, unavailable_reason = ?
+			WHERE merchant_id = ? AND product_id IN (`+placeholders(len(change.ProductIDs))+`)
+		`, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := queueAvailabilitySync(ctx, tx, merchantID, change.ProductIDs, available); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// queueAvailabilitySync : one outbox row per product when the merchant is plugged into Uber Eats
+// (drained by services.AvailabilitySync). Components are not items on the platforms, the
+// products they take out / bring back are. Deliveroo is out of scope: no brand id nor API
+// credentials are stored for it (see migration 0015), nothing is queued for its merchants.
+func queueAvailabilitySync(ctx context.Context, tx *sql.Tx, merchantID string, productIDs []string, available bool) error {
+	for _, id := range productIDs {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO integration_availability_outbox (merchant_id, integration, item_id, available, created_at)
+			SELECT iue.merchant_id, ?, ?, ?, UTC_TIMESTAMP() FROM integration_uber_eats iue
+			WHERE iue.merchant_id = ? AND iue.enabled = 1 AND iue.bearer_token IS NOT NULL AND iue.store_id IS NOT NULL
+		`, IntegrationUberEats, id, available, merchantID); err != nil {
+			return fmt.Errorf("availability outbox error: %w", err)
+		}
+	}
+	return nil
+}
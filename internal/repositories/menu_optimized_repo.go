@@ -16,7 +16,7 @@ func NewOptimizedMenuRepository(db *sql.DB) *OptimizedMenuRepository {
 	return &OptimizedMenuRepository{db: db}
 }
 
-func (r *OptimizedMenuRepository) GetMenu(ctx context.Context, merchantID string, lastMenu *time.Time) (*models.MenuResponse, error) {
+func (r *OptimizedMenuRepository) GetMenu(ctx context.Context, merchantID string, lastMenu *time.Time, lang string) (*models.MenuResponse, error) {
 
 	// TRANSACTION
 	tx, err := r.db.BeginTx(ctx, nil)
@@ -220,13 +220,16 @@ ORDER BY p.by_product_of IS NOT NULL, p.category, p.name ASC
 	// STEP 5 — components (requires) (1 query)
 	// -------------------------------------------------------------
 	reqRows, err := tx.QueryContext(ctx, `
-SELECT r.product_id, c.component_id, c.name, c.component_price, c.status, rq.quantity, uomd.uom_desc
+SELECT r.product_id, c.component_id, c.name, c.component_price, c.status, rq.quantity,
+       COALESCE(uoml.uom_desc, uomd.uom_desc), uc.code
 FROM components c
 INNER JOIN requires rq ON rq.component_id = c.component_id AND rq.enabled = true
 INNER JOIN recipes r ON r.recipe_id = rq.recipe_id
 INNER JOIN unit_of_measure_desc uomd ON uomd.id = rq.unit_of_measure AND uomd.lang='FR'
+LEFT JOIN unit_of_measure_desc uoml ON uoml.id = rq.unit_of_measure AND uoml.lang = ?
+LEFT JOIN unit_of_measure_code uc ON uc.id = rq.unit_of_measure
 WHERE c.merchant_id = ? AND c.available = 1
-`, merchantID)
+`, lang, merchantID)
 	if err != nil {
 		rollback()
 		return nil, err
@@ -237,7 +240,7 @@ WHERE c.merchant_id = ? AND c.available = 1
 	for reqRows.Next() {
 		var pid string
 		var cu models.ComponentUsage
-		var uom sql.NullString
+		var uom, code sql.NullString
 
 		err := reqRows.Scan(
 			&pid,
@@ -247,6 +250,7 @@ WHERE c.merchant_id = ? AND c.available = 1
 			&cu.Status,
 			&cu.Quantity,
 			&uom,
+			&code,
 		)
 		if err != nil {
 			rollback()
@@ -255,6 +259,7 @@ WHERE c.merchant_id = ? AND c.available = 1
 		if uom.Valid {
 			cu.UnitOfMeasure = uom.String
 		}
+		cu.UnitCode = code.String
 		compMap[pid] = append(compMap[pid], cu)
 	}
 
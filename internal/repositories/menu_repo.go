@@ -20,7 +20,7 @@ func NewMenuRepository(db *sql.DB, log *zap.Logger) *MenuRepository {
 	return &MenuRepository{db: db, log: log}
 }
 
-func (r *MenuRepository) GetMenu(ctx context.Context, merchantID string, lastMenu *time.Time) (*models.MenuResponse, error) {
+func (r *MenuRepository) GetMenu(ctx context.Context, merchantID string, lastMenu *time.Time, lang string) (*models.MenuResponse, error) {
 	startTotal := time.Now()
 	r.log.Info("GetMenu START", zap.String("merchant_id", merchantID), zap.Time("start_at", startTotal))
 
@@ -231,7 +231,7 @@ func (r *MenuRepository) GetMenu(ctx context.Context, merchantID string, lastMen
             INNER JOIN tva_categories tva_in on tva_in.tva_id = p.tva_in_id
             INNER JOIN tva_categories tva_delivery on tva_delivery.tva_id = p.tva_delivery_id
             INNER JOIN tva_categories tva_take_away on tva_take_away.tva_id = p.tva_take_away_id
-            WHERE p.merchant_id = ? AND p.by_product_of IS NOT NULL AND p.available = 1
+            WHERE p.merchant_id = ? AND p.by_product_of IS NOT NULL AND p.available = 1 AND p.enabled = 1
         `
 		rows, err := runQuery(step, q, merchantID)
 		if err != nil {
@@ -278,14 +278,17 @@ func (r *MenuRepository) GetMenu(ctx context.Context, merchantID string, lastMen
 	{
 		step := "components_requires"
 		q := `
-            SELECT r.product_id, c.component_id, c.name, c.component_price, c.status, rq.quantity, uomd.uom_desc
+            SELECT r.product_id, c.component_id, c.name, c.component_price, c.status, rq.quantity,
+                   COALESCE(uoml.uom_desc, uomd.uom_desc), uc.code
             FROM components c
             INNER JOIN requires rq on c.component_id = rq.component_id and rq.enabled = true
             INNER JOIN recipes r on r.recipe_id = rq.recipe_id
             INNER JOIN unit_of_measure_desc uomd on uomd.lang = 'FR' and uomd.id = rq.unit_of_measure
+            LEFT JOIN unit_of_measure_desc uoml on uoml.lang = ? and uoml.id = rq.unit_of_measure
+            LEFT JOIN unit_of_measure_code uc on uc.id = rq.unit_of_measure
             WHERE c.merchant_id = ? AND c.available = 1 AND rq.enabled = true
         `
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, lang, merchantID)
 		if err != nil {
 			return nil, err
 		}
@@ -294,14 +297,15 @@ func (r *MenuRepository) GetMenu(ctx context.Context, merchantID string, lastMen
 		for rows.Next() {
 			var productID string
 			var c models.ComponentUsage
-			var uom sql.NullString
-			if err := rows.Scan(&productID, &c.ComponentID, &c.Name, &c.Price, &c.Status, &c.Quantity, &uom); err != nil {
+			var uom, code sql.NullString
+			if err := rows.Scan(&productID, &c.ComponentID, &c.Name, &c.Price, &c.Status, &c.Quantity, &uom, &code); err != nil {
 				r.log.Error("components_requires scan failed", zap.Error(err))
 				return nil, err
 			}
 			if uom.Valid {
 				c.UnitOfMeasure = uom.String
 			}
+			c.UnitCode = code.String
 			compMap[productID] = append(compMap[productID], c)
 			count++
 		}
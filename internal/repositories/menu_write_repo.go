@@ -0,0 +1,525 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// ErrMenuItemInUse : a category still holding products, a group still holding sub-products
+var ErrMenuItemInUse = errors.New("menu item in use")
+
+// ListCategories : enabled categories, unavailable ones included (the menu only shows available ones)
+func (r *MenuRepository) ListCategories(ctx context.Context, merchantID string) ([]models.MenuCategory, error) {
+	return r.queryCategories(ctx, `WHERE pc.merchant_id = ? AND pc.enabled = 1 ORDER BY pc.categ_order ASC`, merchantID)
+}
+
+// GetCategory : sql.ErrNoRows if not an enabled category of the merchant
+func (r *MenuRepository) GetCategory(ctx context.Context, merchantID, categoryID string) (*models.MenuCategory, error) {
+	list, err := r.queryCategories(ctx, `WHERE pc.merchant_id = ? AND pc.merchant_categ_id = ? AND pc.enabled = 1`, merchantID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &list[0], nil
+}
+
+func (r *MenuRepository) queryCategories(ctx context.Context, where string, args ...interface{}) ([]models.MenuCategory, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT pc.merchant_categ_id, pc.categ_name, pc.categ_order, pc.bg_color, pc.available
+		FROM productcateg pc
+		`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("categories query error: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.MenuCategory{}
+	for rows.Next() {
+		var c models.MenuCategory
+		var name, bg sql.NullString
+		var order sql.NullInt64
+		var available sql.NullBool
+		if err := rows.Scan(&c.CategoryID, &name, &order, &bg, &available); err != nil {
+			return nil, err
+		}
+		c.Name = name.String
+		c.Order = int(order.Int64)
+		c.BgColor = nullStringToPtr(bg)
+		c.Available = available.Bool
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// CreateCategory : merchant_categ_id is numbered per merchant, like the legacy back office does
+func (r *MenuRepository) CreateCategory(ctx context.Context, merchantID string, req models.CategoryRequest) (string, error) {
+	r.log.Info("CreateCategory START", zap.String("merchant_id", merchantID))
+
+	var categoryID string
+	err := r.inMenuTx(ctx, merchantID, func(tx *sql.Tx) error {
+		var next, maxOrder int64
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(MAX(CAST(merchant_categ_id AS UNSIGNED)), 0) + 1, COALESCE(MAX(categ_order), 0)
+			FROM productcateg WHERE merchant_id = ?
+			FOR UPDATE`, merchantID).Scan(&next, &maxOrder); err != nil {
+			return err
+		}
+		categoryID = strconv.FormatInt(next, 10)
+
+		order := int(maxOrder) + 1
+		if req.Order != nil {
+			order = *req.Order
+		}
+		available := true
+		if req.Available != nil {
+			available = *req.Available
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO productcateg (merchant_id, merchant_categ_id, categ_name, categ_order, bg_color, available, enabled)
+			VALUES (?, ?, ?, ?, ?, ?, 1)
+		`, merchantID, categoryID, *req.Name, order, req.BgColor, available)
+		if err != nil {
+			return fmt.Errorf("insert productcateg error: %w", err)
+		}
+		return nil
+	})
+	return categoryID, err
+}
+
+// UpdateCategory only writes the fields sent
+func (r *MenuRepository) UpdateCategory(ctx context.Context, merchantID, categoryID string, req models.CategoryRequest) error {
+	r.log.Info("UpdateCategory START", zap.String("merchant_id", merchantID), zap.String("category_id", categoryID))
+
+	return r.inMenuTx(ctx, merchantID, func(tx *sql.Tx) error {
+		if err := categoryExists(ctx, tx, merchantID, categoryID); err != nil {
+			return err
+		}
+
+		cols, vals := categoryFields(req)
+		if len(cols) == 0 {
+			return nil
+		}
+		vals = append(vals, merchantID, categoryID)
+		_, err := tx.ExecContext(ctx, `
+			UPDATE productcateg SET `+strings.Join(cols, " = ?, ")+` = ?
+			WHERE merchant_id = ? AND merchant_categ_id = ?`, vals...)
+		return err
+	})
+}
+
+// DeleteCategory disables an empty category, ErrMenuItemInUse while products are in it
+func (r *MenuRepository) DeleteCategory(ctx context.Context, merchantID, categoryID string) error {
+	r.log.Info("DeleteCategory START", zap.String("merchant_id", merchantID), zap.String("category_id", categoryID))
+
+	return r.inMenuTx(ctx, merchantID, func(tx *sql.Tx) error {
+		if err := categoryExists(ctx, tx, merchantID, categoryID); err != nil {
+			return err
+		}
+
+		var count int
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM products WHERE merchant_id = ? AND category = ? AND enabled = 1
+		`, merchantID, categoryID).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %d products in category %s", ErrMenuItemInUse, count, categoryID)
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			UPDATE productcateg SET enabled = 0 WHERE merchant_id = ? AND merchant_categ_id = ?
+		`, merchantID, categoryID)
+		return err
+	})
+}
+
+const menuProductColumns = `
+	p.product_id, p.by_product_of, p.name, p.category, p.price, p.price_take_away, p.price_delivery, p.product_desc,
+	tva_in.tva_rate, tva_delivery.tva_rate, tva_take_away.tva_rate,
+	p.bg_color, p.is_product_group, p.status, p.is_available_on_sno, p.is_popular, p.image_url,
+	p.available_in, p.available_take_away, p.available_delivery`
+
+const menuProductJoins = `
+	INNER JOIN tva_categories tva_in ON tva_in.tva_id = p.tva_in_id
+	INNER JOIN tva_categories tva_delivery ON tva_delivery.tva_id = p.tva_delivery_id
+	INNER JOIN tva_categories tva_take_away ON tva_take_away.tva_id = p.tva_take_away_id`
+
+// GetProduct : the product as the menu shows it, with its sub-products. sql.ErrNoRows if unknown.
+func (r *MenuRepository) GetProduct(ctx context.Context, merchantID, productID string) (*models.ProductEntry, error) {
+	p, err := scanMenuProduct(r.db.QueryRowContext(ctx, `
+		SELECT `+menuProductColumns+`
+		FROM products p `+menuProductJoins+`
+		WHERE p.merchant_id = ? AND p.product_id = ? AND p.enabled = 1`, merchantID, productID))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+menuProductColumns+`
+		FROM products p `+menuProductJoins+`
+		WHERE p.merchant_id = ? AND p.by_product_of = ? AND p.product_id <> p.by_product_of AND p.enabled = 1
+		ORDER BY p.product_id`, merchantID, productID)
+	if err != nil {
+		return nil, fmt.Errorf("sub_products query error: %w", err)
+	}
+	defer rows.Close()
+
+	p.SubProducts = []models.ProductEntry{}
+	for rows.Next() {
+		sp, err := scanMenuProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		p.SubProducts = append(p.SubProducts, *sp)
+	}
+	return p, rows.Err()
+}
+
+// CreateProduct : a sub-product without a category goes in its group's one
+func (r *MenuRepository) CreateProduct(ctx context.Context, merchantID string, req models.ProductRequest) (string, error) {
+	r.log.Info("CreateProduct START", zap.String("merchant_id", merchantID))
+
+	var productID string
+	err := r.inMenuTx(ctx, merchantID, func(tx *sql.Tx) error {
+		refs := productRefs{IsProductGroup: req.IsProductGroup != nil && *req.IsProductGroup}
+		if req.CategoryID != nil {
+			refs.CategoryID = *req.CategoryID
+		}
+		if req.ByProductOf != nil {
+			refs.ByProductOf = *req.ByProductOf
+		}
+		parentCategory, err := checkProductRefs(ctx, tx, merchantID, "", refs, req)
+		if err != nil {
+			return err
+		}
+		if req.CategoryID == nil {
+			req.CategoryID = &parentCategory
+		}
+
+		// available / status explicites comme pour les catégories : le menu filtre sur available = 1
+		cols, vals := productFields(req)
+		cols = append(cols, "merchant_id", "enabled", "available", "status")
+		vals = append(vals, merchantID, 1, 1, 1)
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO products (`+strings.Join(cols, ", ")+`)
+			VALUES (`+placeholders(len(cols))+`)`, vals...)
+		if err != nil {
+			return fmt.Errorf("insert product error: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		productID = strconv.FormatInt(id, 10)
+		return nil
+	})
+	return productID, err
+}
+
+// UpdateProduct only writes the fields sent, the references are checked on the resulting product
+func (r *MenuRepository) UpdateProduct(ctx context.Context, merchantID, productID string, req models.ProductRequest) error {
+	r.log.Info("UpdateProduct START", zap.String("merchant_id", merchantID), zap.String("product_id", productID))
+
+	return r.inMenuTx(ctx, merchantID, func(tx *sql.Tx) error {
+		var refs productRefs
+		var category, byProductOf sql.NullString
+		err := tx.QueryRowContext(ctx, `
+			SELECT category, by_product_of, is_product_group FROM products
+			WHERE merchant_id = ? AND product_id = ? AND enabled = 1
+			FOR UPDATE`, merchantID, productID).Scan(&category, &byProductOf, &refs.IsProductGroup)
+		if err != nil {
+			return err
+		}
+		refs.CategoryID = category.String
+		// by_product_of = product_id : produit racine (convention legacy)
+		if byProductOf.Valid && byProductOf.String != productID {
+			refs.ByProductOf = byProductOf.String
+		}
+
+		if req.CategoryID != nil {
+			refs.CategoryID = *req.CategoryID
+		}
+		if req.ByProductOf != nil {
+			refs.ByProductOf = *req.ByProductOf
+		}
+		if req.IsProductGroup != nil {
+			refs.IsProductGroup = *req.IsProductGroup
+		}
+		if _, err := checkProductRefs(ctx, tx, merchantID, productID, refs, req); err != nil {
+			return err
+		}
+
+		cols, vals := productFields(req)
+		if len(cols) == 0 {
+			return nil
+		}
+		vals = append(vals, merchantID, productID)
+		_, err = tx.ExecContext(ctx, `
+			UPDATE products SET `+strings.Join(cols, " = ?, ")+` = ?
+			WHERE merchant_id = ? AND product_id = ?`, vals...)
+		return err
+	})
+}
+
+// DeleteProduct disables the product, and the sub-products of a group with it
+func (r *MenuRepository) DeleteProduct(ctx context.Context, merchantID, productID string) error {
+	r.log.Info("DeleteProduct START", zap.String("merchant_id", merchantID), zap.String("product_id", productID))
+
+	return r.inMenuTx(ctx, merchantID, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE products SET enabled = 0 WHERE merchant_id = ? AND product_id = ? AND enabled = 1
+		`, merchantID, productID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE products SET enabled = 0 WHERE merchant_id = ? AND by_product_of = ? AND enabled = 1
+		`, merchantID, productID)
+		return err
+	})
+}
+
+// inMenuTx : every menu write bumps last_menu_update in the same transaction,
+// the other tablets see a new value and reload the menu
+func (r *MenuRepository) inMenuTx(ctx context.Context, merchantID string, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := bumpLastMenuUpdate(ctx, tx, merchantID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// bumpLastMenuUpdate : the tablets reload the menu when last_menu_update moves
+func bumpLastMenuUpdate(ctx context.Context, tx *sql.Tx, merchantID string) error {
+	// GetMenu compare à la seconde : deux écritures dans la même seconde doivent quand même changer la valeur
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE merchant_parameters
+		SET last_menu_update = GREATEST(UTC_TIMESTAMP(), COALESCE(last_menu_update + INTERVAL 1 SECOND, UTC_TIMESTAMP()))
+		WHERE merchant_id = ?
+	`, merchantID); err != nil {
+		return fmt.Errorf("last_menu_update error: %w", err)
+	}
+	return nil
+}
+
+func categoryExists(ctx context.Context, tx *sql.Tx, merchantID, categoryID string) error {
+	var exists int
+	return tx.QueryRowContext(ctx, `
+		SELECT 1 FROM productcateg WHERE merchant_id = ? AND merchant_categ_id = ? AND enabled = 1
+	`, merchantID, categoryID).Scan(&exists)
+}
+
+// productRefs : category / group of a product once the request is applied
+type productRefs struct {
+	CategoryID     string
+	ByProductOf    string
+	IsProductGroup bool
+}
+
+// checkProductRefs : TVA categories exist, the category is the merchant's, the parent is a
+// root product group of the merchant and groups don't nest. Returns the parent's category.
+func checkProductRefs(ctx context.Context, tx *sql.Tx, merchantID, productID string, refs productRefs, req models.ProductRequest) (string, error) {
+	for _, id := range []*int64{req.TVAInID, req.TVATakeAwayID, req.TVADeliveryID} {
+		if id == nil {
+			continue
+		}
+		var exists int
+		err := tx.QueryRowContext(ctx, `SELECT 1 FROM tva_categories WHERE tva_id = ?`, *id).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%w: tva category %d", ErrInvalidReference, *id)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	parentCategory := ""
+	if refs.ByProductOf != "" {
+		if refs.ByProductOf == productID {
+			return "", fmt.Errorf("%w: product %s can't be its own group", ErrInvalidReference, productID)
+		}
+		if refs.IsProductGroup {
+			return "", fmt.Errorf("%w: a product group can't be in another group", ErrInvalidReference)
+		}
+
+		var isGroup bool
+		var parentOf, category sql.NullString
+		err := tx.QueryRowContext(ctx, `
+			SELECT is_product_group, by_product_of, category FROM products
+			WHERE merchant_id = ? AND product_id = ? AND enabled = 1
+		`, merchantID, refs.ByProductOf).Scan(&isGroup, &parentOf, &category)
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%w: product group %s", ErrInvalidReference, refs.ByProductOf)
+		}
+		if err != nil {
+			return "", err
+		}
+		if !isGroup || (parentOf.Valid && parentOf.String != refs.ByProductOf) {
+			return "", fmt.Errorf("%w: product %s is not a product group", ErrInvalidReference, refs.ByProductOf)
+		}
+		parentCategory = category.String
+	}
+
+	categoryID := refs.CategoryID
+	if categoryID == "" {
+		categoryID = parentCategory
+	}
+	if err := categoryExists(ctx, tx, merchantID, categoryID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%w: category %s", ErrInvalidReference, categoryID)
+		}
+		return "", err
+	}
+
+	if productID != "" && !refs.IsProductGroup {
+		var count int
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM products
+			WHERE merchant_id = ? AND by_product_of = ? AND product_id <> by_product_of AND enabled = 1
+		`, merchantID, productID).Scan(&count); err != nil {
+			return "", err
+		}
+		if count > 0 {
+			return "", fmt.Errorf("%w: product %s still has %d sub-products", ErrMenuItemInUse, productID, count)
+		}
+	}
+	return parentCategory, nil
+}
+
+func categoryFields(req models.CategoryRequest) ([]string, []interface{}) {
+	var cols []string
+	var vals []interface{}
+	add := func(col string, v interface{}) {
+		cols = append(cols, col)
+		vals = append(vals, v)
+	}
+	if req.Name != nil {
+		add("categ_name", *req.Name)
+	}
+	if req.Order != nil {
+		add("categ_order", *req.Order)
+	}
+	if req.BgColor != nil {
+		add("bg_color", nullIfEmpty(*req.BgColor))
+	}
+	if req.Available != nil {
+		add("available", *req.Available)
+	}
+	return cols, vals
+}
+
+// productFields : columns / values of the fields sent
+func productFields(req models.ProductRequest) ([]string, []interface{}) {
+	var cols []string
+	var vals []interface{}
+	add := func(col string, v interface{}) {
+		cols = append(cols, col)
+		vals = append(vals, v)
+	}
+	if req.Name != nil {
+		add("name", *req.Name)
+	}
+	if req.CategoryID != nil {
+		add("category", *req.CategoryID)
+	}
+	if req.ByProductOf != nil {
+		add("by_product_of", nullIfEmpty(*req.ByProductOf))
+	}
+	if req.IsProductGroup != nil {
+		add("is_product_group", *req.IsProductGroup)
+	}
+	if req.Description != nil {
+		add("product_desc", nullIfEmpty(*req.Description))
+	}
+	if req.BgColor != nil {
+		add("bg_color", nullIfEmpty(*req.BgColor))
+	}
+	if req.ImageURL != nil {
+		add("image_url", nullIfEmpty(*req.ImageURL))
+	}
+	if req.Price != nil {
+		add("price", *req.Price)
+	}
+	if req.PriceTakeAway != nil {
+		add("price_take_away", *req.PriceTakeAway)
+	}
+	if req.PriceDelivery != nil {
+		add("price_delivery", *req.PriceDelivery)
+	}
+	if req.TVAInID != nil {
+		add("tva_in_id", *req.TVAInID)
+	}
+	if req.TVATakeAwayID != nil {
+		add("tva_take_away_id", *req.TVATakeAwayID)
+	}
+	if req.TVADeliveryID != nil {
+		add("tva_delivery_id", *req.TVADeliveryID)
+	}
+	if req.AvailableIn != nil {
+		add("available_in", *req.AvailableIn)
+	}
+	if req.AvailableTakeAway != nil {
+		add("available_take_away", *req.AvailableTakeAway)
+	}
+	if req.AvailableDelivery != nil {
+		add("available_delivery", *req.AvailableDelivery)
+	}
+	if req.IsAvailableOnSNO != nil {
+		add("is_available_on_sno", *req.IsAvailableOnSNO)
+	}
+	if req.IsPopular != nil {
+		add("is_popular", *req.IsPopular)
+	}
+	return cols, vals
+}
+
+func scanMenuProduct(row rowScanner) (*models.ProductEntry, error) {
+	var p models.ProductEntry
+	var by, desc, bg, imageURL sql.NullString
+	var tvaIn, tvaDel, tvaTake sql.NullFloat64
+	var status sql.NullInt64
+	var sno, popular, availIn, availTake, availDel sql.NullBool
+	if err := row.Scan(
+		&p.ProductID, &by, &p.Name, &p.Category, &p.Price, &p.PriceTakeAway, &p.PriceDelivery, &desc,
+		&tvaIn, &tvaDel, &tvaTake,
+		&bg, &p.IsProductGroup, &status, &sno, &popular, &imageURL,
+		&availIn, &availTake, &availDel,
+	); err != nil {
+		return nil, err
+	}
+	p.ByProductOf = nullStringToPtr(by)
+	p.Description = nullStringToPtr(desc)
+	p.BgColor = nullStringToPtr(bg)
+	p.ImageURL = nullStringToPtr(imageURL)
+	p.TVAIn, p.TVADelivery, p.TVATakeAway = tvaIn.Float64, tvaDel.Float64, tvaTake.Float64
+	p.Status = int(status.Int64)
+	p.IsAvailableOnSNO = sno.Bool
+	p.IsPopular = popular.Bool
+	p.AvailableIn, p.AvailableTakeAway, p.AvailableDelivery = availIn.Bool, availTake.Bool, availDel.Bool
+	p.SubProducts = []models.ProductEntry{}
+	p.Configuration = models.ConfigurableResponse{Attributes: []models.ConfigurableAttribute{}}
+	return &p, nil
+}
@@ -0,0 +1,315 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidReference is returned when a write references a product, component,
+// option, location or customer that does not belong to the merchant.
+var ErrInvalidReference = errors.New("invalid reference")
+
+// ErrInvalidDiscount : discounted price without discount (or the other way round), or above the price
+var ErrInvalidDiscount = errors.New("invalid discount")
+
+// CreateOrder persists an order and all its children (orderitems, extra, without,
+// order_item_configuration, order_location) in a single transaction.
+// Prices are always taken from the catalog, never from the payload, except the discounted price
+// of a line given with a discount of the merchant (never above the catalog price).
+// loc is the merchant time zone: order_num restarts at local midnight.
+func (r *OrdersRepository) CreateOrder(ctx context.Context, merchantID string, order models.Order, loc *time.Location) (string, error) {
+	r.log.Info("CreateOrder START", zap.String("merchant_id", merchantID), zap.Int("products", len(order.Products)))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("BeginTx failed: %w", err)
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	orderType := ""
+	if order.OrderType != nil {
+		orderType = *order.OrderType
+	}
+
+	// --- 1. Prices (catalog) ---
+	type itemToInsert struct {
+		entry     models.ProductEntry
+		unitPrice int64
+		tvaRate   float64
+		extras    []int64 // component price, same index as entry.Extra
+	}
+	items := make([]itemToInsert, 0, len(order.Products))
+	var ttc, tva int64
+
+	for _, p := range order.Products {
+		var price, priceTakeAway, priceDelivery sql.NullInt64
+		var tvaIn, tvaTakeAway, tvaDelivery sql.NullFloat64
+
+		err := tx.QueryRowContext(ctx, `
+			SELECT p.price, p.price_take_away, p.price_delivery,
+			       tva_in.tva_rate, tva_take_away.tva_rate, tva_delivery.tva_rate
+			FROM products p
+			INNER JOIN tva_categories tva_in ON tva_in.tva_id = p.tva_in_id
+			INNER JOIN tva_categories tva_delivery ON tva_delivery.tva_id = p.tva_delivery_id
+			INNER JOIN tva_categories tva_take_away ON tva_take_away.tva_id = p.tva_take_away_id
+			WHERE p.product_id = ? AND p.merchant_id = ? AND p.enabled = 1`,
+			p.ProductID, merchantID,
+		).Scan(&price, &priceTakeAway, &priceDelivery, &tvaIn, &tvaTakeAway, &tvaDelivery)
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%w: product %s", ErrInvalidReference, p.ProductID)
+		}
+		if err != nil {
+			return "", fmt.Errorf("product price query error: %w", err)
+		}
+
+		it := itemToInsert{entry: p}
+		switch orderType {
+		case "DELIVERY":
+			it.unitPrice, it.tvaRate = priceDelivery.Int64, tvaDelivery.Float64
+		case "TAKE_AWAY":
+			it.unitPrice, it.tvaRate = priceTakeAway.Int64, tvaTakeAway.Float64
+		default:
+			it.unitPrice, it.tvaRate = price.Int64, tvaIn.Float64
+		}
+
+		for _, e := range p.Extra {
+			var compPrice sql.NullInt64
+			err := tx.QueryRowContext(ctx,
+				`SELECT component_price FROM components WHERE component_id = ? AND merchant_id = ?`,
+				e.ComponentID, merchantID,
+			).Scan(&compPrice)
+			if err == sql.ErrNoRows {
+				return "", fmt.Errorf("%w: extra component %s", ErrInvalidReference, e.ComponentID)
+			}
+			if err != nil {
+				return "", fmt.Errorf("extra price query error: %w", err)
+			}
+			it.extras = append(it.extras, compPrice.Int64)
+			it.unitPrice += compPrice.Int64
+		}
+
+		for _, w := range p.Without {
+			var found int
+			err := tx.QueryRowContext(ctx,
+				`SELECT 1 FROM components WHERE component_id = ? AND merchant_id = ?`,
+				w.ComponentID, merchantID,
+			).Scan(&found)
+			if err == sql.ErrNoRows {
+				return "", fmt.Errorf("%w: without component %s", ErrInvalidReference, w.ComponentID)
+			}
+			if err != nil {
+				return "", fmt.Errorf("without component query error: %w", err)
+			}
+		}
+
+		for _, a := range p.Configuration.Attributes {
+			for _, o := range a.Options {
+				if o.Selected == 0 && o.Quantity == 0 {
+					continue
+				}
+				var extraPrice sql.NullInt64
+				err := tx.QueryRowContext(ctx, `
+					SELECT cao.extra_price
+					FROM configurable_attribute_options cao
+					INNER JOIN product_configurable_attribute pca ON pca.configurable_attribute_id = cao.configurable_attribute_id
+					WHERE cao.id = ? AND pca.product_id = ?
+					LIMIT 1`,
+					o.ID, p.ProductID,
+				).Scan(&extraPrice)
+				if err == sql.ErrNoRows {
+					return "", fmt.Errorf("%w: option %s for product %s", ErrInvalidReference, o.ID, p.ProductID)
+				}
+				if err != nil {
+					return "", fmt.Errorf("option price query error: %w", err)
+				}
+				it.unitPrice += extraPrice.Int64 * int64(optionQuantity(o))
+			}
+		}
+
+		if p.DiscountID != nil || p.DiscountedPrice != nil {
+			if err := checkDiscount(ctx, tx, merchantID, p, it.unitPrice); err != nil {
+				return "", err
+			}
+			// comme le PHP : oi.price porte le prix remisé (discounted_price au fetch)
+			it.unitPrice = *p.DiscountedPrice
+		}
+
+		lineTotal := it.unitPrice * int64(p.Quantity)
+		ttc += lineTotal
+		tva += vatFromGross(lineTotal, it.tvaRate)
+		items = append(items, it)
+	}
+
+	if order.DeliveryFees != nil {
+		ttc += *order.DeliveryFees
+	}
+
+	// --- 2. Order header ---
+	orderNum, err := nextDailyNumber(ctx, tx, merchantID, "ORDER", time.Now().In(loc), `
+		SELECT COALESCE(MAX(CAST(order_num AS UNSIGNED)), 0)
+		FROM orders
+		WHERE merchant_id = ? AND creation_date >= ? AND creation_date < ?`)
+	if err != nil {
+		return "", err
+	}
+
+	var customerID interface{}
+	if order.Customer != nil && order.Customer.CustomerID != nil {
+		var found int64
+		err := tx.QueryRowContext(ctx,
+			`SELECT customer_id FROM customer WHERE customer_id = ? AND merchant_id = ?`,
+			*order.Customer.CustomerID, merchantID,
+		).Scan(&found)
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%w: customer %d", ErrInvalidReference, *order.Customer.CustomerID)
+		}
+		if err != nil {
+			return "", fmt.Errorf("customer query error: %w", err)
+		}
+		customerID = *order.Customer.CustomerID
+	}
+	isDelivery := 0
+	if orderType == "DELIVERY" {
+		isDelivery = 1
+	}
+
+	// responsible (le livreur) reste NULL, il est posé par les sessions de livraison
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO orders
+		(merchant_id, order_num, order_type, state, scheduled, price, TVA, HT, cutlery_notes,
+		 isPaid, isDistributed, dateCall, estimated_ready, isDelivery, delivery_fees, fulfillment_type,
+		 places_settings, pager_number, customer_id, creation_date, last_update)
+		VALUES (?, ?, ?, 'OPEN', ?, ?, ?, ?, ?, 0, 0, ?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP())`,
+		merchantID, orderNum, order.OrderType, order.Scheduled, ttc, tva, ttc-tva, order.CutleryNotes,
+		order.CallHour, order.EstimatedReady, isDelivery, order.DeliveryFees, order.FulfillmentType,
+		order.PlacesSettings, order.PagerNumber, customerID,
+	)
+	if err != nil {
+		return "", fmt.Errorf("insert order error: %w", err)
+	}
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	orderID := strconv.FormatInt(lastID, 10)
+
+	// --- 3. Order items + children ---
+	for _, it := range items {
+		p := it.entry
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO orderitems
+			(order_id, merchant_id, product_id, quantity, paid_quantity, price, isPaid, isDistributed,
+			 ordered_on, discount_id, ready_for_distribution_quantity, distributed_quantity,
+			 production_status, production_status_done_quantity)
+			VALUES (?, ?, ?, ?, 0, ?, 0, 0, UTC_TIMESTAMP(), ?, 0, 0, 'PENDING', 0)`,
+			orderID, merchantID, p.ProductID, p.Quantity, it.unitPrice, p.DiscountID,
+		)
+		if err != nil {
+			return "", fmt.Errorf("insert orderitem error: %w", err)
+		}
+		itemID, err := res.LastInsertId()
+		if err != nil {
+			return "", err
+		}
+
+		for i, e := range p.Extra {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO extra (order_item_id, order_id, product_id, component_id, price) VALUES (?, ?, ?, ?, ?)`,
+				itemID, orderID, p.ProductID, e.ComponentID, it.extras[i],
+			); err != nil {
+				return "", fmt.Errorf("insert extra error: %w", err)
+			}
+		}
+
+		for _, w := range p.Without {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO without (order_item_id, order_id, product_id, component_id) VALUES (?, ?, ?, ?)`,
+				itemID, orderID, p.ProductID, w.ComponentID,
+			); err != nil {
+				return "", fmt.Errorf("insert without error: %w", err)
+			}
+		}
+
+		for _, a := range p.Configuration.Attributes {
+			for _, o := range a.Options {
+				if o.Selected == 0 && o.Quantity == 0 {
+					continue
+				}
+				if _, err := tx.ExecContext(ctx,
+					`INSERT INTO order_item_configuration (order_item_id, configuration_attribute_option_id, quantity) VALUES (?, ?, ?)`,
+					itemID, o.ID, optionQuantity(o),
+				); err != nil {
+					return "", fmt.Errorf("insert order_item_configuration error: %w", err)
+				}
+			}
+		}
+	}
+
+	// --- 4. Locations (tables) ---
+	for _, l := range order.Location {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO order_location (order_id, location_id)
+			SELECT ?, l.location_id FROM locations l
+			WHERE l.location_id = ? AND l.merchant_id = ? AND l.enabled IS TRUE`,
+			orderID, l.LocationID, merchantID,
+		)
+		if err != nil {
+			return "", fmt.Errorf("insert order_location error: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return "", fmt.Errorf("%w: location %s", ErrInvalidReference, l.LocationID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	committed = true
+
+	r.log.Info("CreateOrder END", zap.String("order_id", orderID), zap.Int64("ttc", ttc))
+	return orderID, nil
+}
+
+// checkDiscount : a discount of the merchant and a discounted unit price in [0, unitPrice]
+func checkDiscount(ctx context.Context, tx *sql.Tx, merchantID string, p models.ProductEntry, unitPrice int64) error {
+	if p.DiscountID == nil || p.DiscountedPrice == nil {
+		return fmt.Errorf("%w: product %s needs both discount_id and discounted_price", ErrInvalidDiscount, p.ProductID)
+	}
+	if *p.DiscountedPrice < 0 || *p.DiscountedPrice > unitPrice {
+		return fmt.Errorf("%w: discounted price of product %s must be between 0 and %d", ErrInvalidDiscount, p.ProductID, unitPrice)
+	}
+	var exists int
+	err := tx.QueryRowContext(ctx,
+		`SELECT 1 FROM discounts WHERE discount_id = ? AND merchant_id = ?`,
+		*p.DiscountID, merchantID,
+	).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: discount %d", ErrInvalidReference, *p.DiscountID)
+	}
+	if err != nil {
+		return fmt.Errorf("discount query error: %w", err)
+	}
+	return nil
+}
+
+// optionQuantity : an option sent as "selected" without quantity counts once
+func optionQuantity(o models.ConfigurableOption) int {
+	if o.Quantity > 0 {
+		return o.Quantity
+	}
+	return 1
+}
@@ -5,22 +5,144 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 	"welloresto-api/internal/models"
 
 	"go.uber.org/zap"
 )
 
+// ==================================================================================
+// FILTER
+// ==================================================================================
+
+// OrderFilter : critères sur 'o' (orders) appliqués aux 11 requêtes du constructeur.
+// Les champs vides sont ignorés ; OrderIDs non nil mais vide ne retourne rien.
+type OrderFilter struct {
+	OrderIDs          []string
+	States            []string
+	CreatedFrom       *time.Time // o.creation_date >= CreatedFrom
+	CreatedTo         *time.Time // o.creation_date <= CreatedTo
+	App               string     // WR_DELIVERY / WR_WAITER (ou "1" / "2") : mêmes règles que les commandes en cours
+	DeliverySessionID string     // via dso (delivery_session_order), toujours joint par le constructeur
+	OrderTypes        []string
+	Brands            []string // o.brand (plateformes : Uber Eats, Deliveroo...)
+	MOPs              []string // au moins un paiement actif avec ce moyen de paiement
+	CustomerID        string
+	LocationID        string // table (order_location)
+	MinTTC            *int64 // o.price, en centimes
+	MaxTTC            *int64
+	Lang              string // libellés (unités de mesure) : langue de la requête, "" = français
+}
+
+// sql compiles the filter into an " AND ..." clause and its args, in placeholder order
+func (f OrderFilter) sql() (string, []interface{}) {
+	var clause strings.Builder
+	var args []interface{}
+
+	if f.OrderIDs != nil {
+		if len(f.OrderIDs) == 0 {
+			return " AND FALSE ", nil
+		}
+		clause.WriteString(" AND o.order_id IN (" + placeholders(len(f.OrderIDs)) + ") ")
+		for _, id := range f.OrderIDs {
+			args = append(args, id)
+		}
+	}
+	if len(f.States) > 0 {
+		clause.WriteString(" AND o.state IN (" + placeholders(len(f.States)) + ") ")
+		for _, st := range f.States {
+			args = append(args, st)
+		}
+	}
+	if f.CreatedFrom != nil {
+		clause.WriteString(" AND o.creation_date >= ? ")
+		args = append(args, f.CreatedFrom.UTC())
+	}
+	if f.CreatedTo != nil {
+		clause.WriteString(" AND o.creation_date <= ? ")
+		args = append(args, f.CreatedTo.UTC())
+	}
+	clause.WriteString(appCondition(f.App))
+	if f.DeliverySessionID != "" {
+		clause.WriteString(" AND dso.delivery_session_id = ? ")
+		args = append(args, f.DeliverySessionID)
+	}
+	if len(f.OrderTypes) > 0 {
+		clause.WriteString(" AND o.order_type IN (" + placeholders(len(f.OrderTypes)) + ") ")
+		for _, t := range f.OrderTypes {
+			args = append(args, t)
+		}
+	}
+	if len(f.Brands) > 0 {
+		clause.WriteString(" AND o.brand IN (" + placeholders(len(f.Brands)) + ") ")
+		for _, b := range f.Brands {
+			args = append(args, b)
+		}
+	}
+	if len(f.MOPs) > 0 {
+		clause.WriteString(" AND EXISTS (SELECT 1 FROM payments fp WHERE fp.order_id = o.order_id AND fp.enabled = 1 AND fp.mop IN (" + placeholders(len(f.MOPs)) + ")) ")
+		for _, m := range f.MOPs {
+			args = append(args, m)
+		}
+	}
+	if f.CustomerID != "" {
+		clause.WriteString(" AND o.customer_id = ? ")
+		args = append(args, f.CustomerID)
+	}
+	if f.LocationID != "" {
+		clause.WriteString(" AND EXISTS (SELECT 1 FROM order_location fl WHERE fl.order_id = o.order_id AND fl.location_id = ?) ")
+		args = append(args, f.LocationID)
+	}
+	if f.MinTTC != nil {
+		clause.WriteString(" AND o.price >= ? ")
+		args = append(args, *f.MinTTC)
+	}
+	if f.MaxTTC != nil {
+		clause.WriteString(" AND o.price <= ? ")
+		args = append(args, *f.MaxTTC)
+	}
+
+	return clause.String(), args
+}
+
+// appCondition : commandes visibles par l'app (livreur : ses livraisons et celles d'une session
+// active, serveur : sur place), sans paramètre. Même prédicat que events.MatchesApp pour le stream.
+func appCondition(app string) string {
+	switch app {
+	case "1", "WR_DELIVERY":
+		return " AND o.order_type = 'DELIVERY' AND (o.fulfillment_type = 'DELIVERY_BY_RESTAURANT' OR EXISTS (" +
+			"SELECT 1 FROM delivery_session_order app_dso " +
+			"INNER JOIN delivery_session app_ds ON app_ds.id = app_dso.delivery_session_id AND app_ds.status IN (" + activeSessionStatuses + ") " +
+			"WHERE app_dso.order_id = o.order_id)) "
+	case "2", "WR_WAITER":
+		return " AND o.order_type NOT IN ('DELIVERY','TAKE_AWAY') "
+	}
+	return ""
+}
+
+// placeholders : "?,?,?" pour une clause IN de n éléments
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
 // ==================================================================================
 // PRIVATE SHARED BUILDER (THE CORE)
 // ==================================================================================
 
-// fetchAndBuildOrders exécute les 11 requêtes avec un filtre additionnel (WHERE clause)
+// fetchAndBuildOrders exécute les 11 requêtes avec le filtre compilé en placeholders (cf. OrderFilter)
 // C'est ici qu'on optimise et qu'on log.
-func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID string, additionalFilter string) ([]models.Order, error) {
+func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID string, filter OrderFilter) ([]models.Order, error) {
 	startTotal := time.Now()
 	r.log.Info("fetchAndBuildOrders START", zap.String("merchant_id", merchantID))
 
+	additionalFilter, filterArgs := filter.sql()
+	// merchant_id est toujours le premier placeholder, le filtre suit
+	args := append([]interface{}{merchantID}, filterArgs...)
+
 	// Begin transaction (read-only)
 	// Note: On utilise le ctx parent. Si la requête HTTP est annulée, la transaction s'arrêtera proprement.
 	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
@@ -74,7 +196,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id 
 		WHERE o.merchant_id = ? ` + additionalFilter
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -97,23 +219,25 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		step := "components"
 		q := `
 		SELECT r.product_id, c.component_id, c.name, c.component_price as price, c.status,
-		rq.quantity, uomd.uom_desc
+		rq.quantity, COALESCE(uoml.uom_desc, uomd.uom_desc), uc.code
 		FROM components c
 		INNER JOIN requires rq ON c.component_id = rq.component_id AND rq.enabled IS TRUE
 		INNER JOIN recipes r ON r.recipe_id = rq.recipe_id
 		INNER JOIN unit_of_measure_desc uomd ON uomd.lang = 'FR' AND uomd.id = rq.unit_of_measure
+		LEFT JOIN unit_of_measure_desc uoml ON uoml.lang = ? AND uoml.id = rq.unit_of_measure
+		LEFT JOIN unit_of_measure_code uc ON uc.id = rq.unit_of_measure
 		WHERE c.merchant_id = ? AND c.available = '1' AND rq.enabled IS TRUE`
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, filter.Lang, merchantID)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
 		for rows.Next() {
-			var productID, name, uom sql.NullString
+			var productID, name, uom, code sql.NullString
 			var compID, price, status sql.NullInt64
 			var qty sql.NullFloat64
-			if err := rows.Scan(&productID, &compID, &name, &price, &status, &qty, &uom); err != nil {
+			if err := rows.Scan(&productID, &compID, &name, &price, &status, &qty, &uom, &code); err != nil {
 				return nil, err
 			}
 			componentsMap[productID.String] = append(componentsMap[productID.String], models.ComponentUsage{
@@ -123,6 +247,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 				Price:         price.Int64,
 				Quantity:      qty.Float64,
 				UnitOfMeasure: uom.String,
+				UnitCode:      code.String,
 				Status:        int(status.Int64),
 			})
 		}
@@ -143,7 +268,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id 
 		WHERE o.merchant_id = ? ` + additionalFilter
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -181,7 +306,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id 
 		WHERE o.merchant_id = ? ` + additionalFilter
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -218,7 +343,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id 
 		WHERE oi.merchant_id = ? ` + additionalFilter
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -258,7 +383,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id 
 		WHERE o.merchant_id = ? ` + additionalFilter
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -300,7 +425,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id 
 		WHERE o.merchant_id = ? ` + additionalFilter
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -343,7 +468,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id
 		WHERE o.merchant_id = ? and oc.order_item_id is null ` + additionalFilter
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -385,7 +510,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id
 		WHERE o.merchant_id = ? ` + additionalFilter
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -441,7 +566,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id 
 		WHERE oi.quantity > 0 AND o.merchant_id = ? ` + additionalFilter
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -563,7 +688,7 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 	}
 
 	// --- 1. HEADER ---
-	// On injecte 'additionalFilter' qui contient soit "state='OPEN'" soit "order_id=X"
+	// On injecte 'additionalFilter' (OrderFilter compilé), ses valeurs sont dans args
 	var orders []models.Order
 	{
 		step := "header"
@@ -579,10 +704,10 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 		LEFT JOIN customer c ON o.customer_id = c.customer_id
 		LEFT JOIN users u ON o.responsible = u.user_id AND o.merchant_id = u.merchant_id
 		LEFT JOIN delivery_session_order dso ON dso.order_id = o.order_id
-		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id AND ds.status IN ('1','PENDING')
+		LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id AND ds.status IN (` + activeSessionStatuses + `)
 		WHERE o.merchant_id = ? ` + additionalFilter
 
-		rows, err := runQuery(step, q, merchantID)
+		rows, err := runQuery(step, q, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -615,6 +740,10 @@ func (r *OrdersRepository) fetchAndBuildOrders(ctx context.Context, merchantID s
 			ord.BrandOrderNum = nullStringToPtr(brandOrderNum)
 			ord.BrandStatus = nullStringToPtr(brandStatus)
 			ord.DeliverySessionID = &deliverySessionID.String
+			// rang dans la session active seulement (dso d'une session terminée ignoré)
+			if deliverySessionID.Valid && priority.Valid {
+				ord.Priority = &priority.Int64
+			}
 			ord.OrderType = nullStringToPtr(orderType)
 			ord.CutleryNotes = nullStringToPtr(cutleryNotes)
 			ord.State = nullStringToPtr(state)
@@ -3,7 +3,11 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 	"welloresto-api/internal/models"
 
 	"go.uber.org/zap"
@@ -23,24 +27,35 @@ func NewOrdersRepository(db *sql.DB, log *zap.Logger) *OrdersRepository {
 // ==================================================================================
 
 // GetPendingOrders : Récupère toutes les commandes en cours (Optimisé)
-func (r *OrdersRepository) GetPendingOrders(ctx context.Context, merchantID, app string) (*models.PendingOrdersResponse, error) {
-	r.log.Info("GetPendingOrders START", zap.String("merchant_id", merchantID))
+// Avec since != nil (delta sync) : uniquement les commandes modifiées depuis, + les IDs sortis du set "pending"
+func (r *OrdersRepository) GetPendingOrders(ctx context.Context, merchantID, app string, since *time.Time, lang string) (*models.PendingOrdersResponse, error) {
+	r.log.Info("GetPendingOrders START", zap.String("merchant_id", merchantID), zap.Bool("delta", since != nil))
 
 	// On a besoin du repo session pour récupérer les sessions à la fin
 	deliverySessionRepo := NewDeliverySessionsRepository(r.db, r.log)
 
+	// Horloge DB : le client renverra cette valeur comme prochain "since"
+	var syncTimestamp time.Time
+	if err := r.db.QueryRowContext(ctx, `SELECT UTC_TIMESTAMP()`).Scan(&syncTimestamp); err != nil {
+		return nil, fmt.Errorf("failed to read sync timestamp: %w", err)
+	}
+
 	// ========================================================================
 	// ÉTAPE 1 : OPTIMISATION - Récupérer les IDs d'abord
 	// ========================================================================
 
 	// 1.a. On construit la clause WHERE complexe ici
-	criteria := " AND ((o.state IN ('OPEN') AND o.brand_status NOT IN('ONLINE_PAYMENT_PENDING')) OR ds.id IS NOT NULL) "
+	pendingCond := "((o.state IN ('OPEN') AND o.brand_status NOT IN('ONLINE_PAYMENT_PENDING')) OR ds.id IS NOT NULL)"
 
 	// Ajout filtre APP
-	if app == "1" || app == "WR_DELIVERY" {
-		criteria += " AND o.order_type = 'DELIVERY' AND o.fulfillment_type = 'DELIVERY_BY_RESTAURANT' "
-	} else if app == "2" || app == "WR_WAITER" {
-		criteria += " AND o.order_type NOT IN ('DELIVERY','TAKE_AWAY') "
+	appCond := appCondition(app)
+
+	criteria := " AND " + pendingCond + appCond
+	args := []interface{}{merchantID}
+	if since != nil {
+		// >= : une modif dans la même seconde que le dernier sync ne doit pas être perdue
+		criteria += " AND o.last_update >= ? "
+		args = append(args, since.UTC())
 	}
 
 	// 1.b. Requête légère pour récupérer UNIQUEMENT les IDs
@@ -48,22 +63,41 @@ func (r *OrdersRepository) GetPendingOrders(ctx context.Context, merchantID, app
 	qIDs := `SELECT DISTINCT o.order_id
              FROM orders o
              LEFT JOIN delivery_session_order dso ON dso.order_id = o.order_id
-             LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id AND ds.status IN ('1','PENDING')
+             LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id AND ds.status IN (` + activeSessionStatuses + `)
              WHERE o.merchant_id = ? ` + criteria
 
-	rows, err := r.db.QueryContext(ctx, qIDs, merchantID)
+	orderIDs, err := r.queryOrderIDs(ctx, qIDs, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch pending order ids: %w", err)
 	}
-	defer rows.Close()
 
-	var orderIDs []string
-	for rows.Next() {
-		var oid string
-		if err := rows.Scan(&oid); err != nil {
-			return nil, err
+	// 1.c. Delta : commandes modifiées depuis "since" qui ne sont plus en cours
+	removedIDs := []string{}
+	if since != nil {
+		qRemoved := `SELECT DISTINCT o.order_id
+             FROM orders o
+             LEFT JOIN delivery_session_order dso ON dso.order_id = o.order_id
+             LEFT JOIN delivery_session ds ON ds.id = dso.delivery_session_id AND ds.status IN (` + activeSessionStatuses + `)
+             WHERE o.merchant_id = ? AND o.last_update >= ? ` + appCond + `
+             AND NOT COALESCE(` + pendingCond + `, FALSE)`
+
+		removedIDs, err = r.queryOrderIDs(ctx, qRemoved, merchantID, since.UTC())
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch removed order ids: %w", err)
+		}
+		// une commande encore en cours n'est jamais "removed" : elle peut ressortir ici par une
+		// autre ligne delivery_session_order, ou être revenue dans le set entre les deux requêtes
+		removedIDs = excludeIDs(removedIDs, orderIDs)
+
+		if len(orderIDs) == 0 && len(removedIDs) == 0 {
+			return &models.PendingOrdersResponse{
+				Status:           "no_update_required",
+				SyncTimestamp:    &syncTimestamp,
+				Orders:           []models.Order{},
+				DeliverySessions: []models.DeliverySession{},
+				RemovedOrderIDs:  removedIDs,
+			}, nil
 		}
-		orderIDs = append(orderIDs, oid)
 	}
 
 	// ========================================================================
@@ -74,8 +108,11 @@ func (r *OrdersRepository) GetPendingOrders(ctx context.Context, merchantID, app
 		// ou on retourne tout vide. Selon ton besoin métier.
 		// Ici je retourne tout vide pour être rapide.
 		return &models.PendingOrdersResponse{
+			Status:           "ok",
+			SyncTimestamp:    &syncTimestamp,
 			Orders:           []models.Order{},
 			DeliverySessions: []models.DeliverySession{},
+			RemovedOrderIDs:  removedIDs,
 		}, nil
 	}
 
@@ -83,17 +120,8 @@ func (r *OrdersRepository) GetPendingOrders(ctx context.Context, merchantID, app
 	// ÉTAPE 2 : Appeler le constructeur avec le filtre OPTIMISÉ (IN)
 	// ========================================================================
 
-	// Construction de la chaîne "IN ('id1', 'id2')"
-	idsStr := ""
-	for i, oid := range orderIDs {
-		if i > 0 {
-			idsStr += ","
-		}
-		idsStr += fmt.Sprintf("'%s'", oid)
-	}
-
-	// Le filtre magique qui va rendre les 11 requêtes suivantes instantanées
-	filterOptimized := fmt.Sprintf(" AND o.order_id IN (%s) ", idsStr)
+	// Le filtre magique (IN sur les IDs) qui va rendre les 11 requêtes suivantes instantanées
+	filterOptimized := OrderFilter{OrderIDs: orderIDs, Lang: lang}
 
 	orders, err := r.fetchAndBuildOrders(ctx, merchantID, filterOptimized)
 	if err != nil {
@@ -106,24 +134,61 @@ func (r *OrdersRepository) GetPendingOrders(ctx context.Context, merchantID, app
 
 	// Récupérer les sessions (spécifique à cet endpoint)
 	// Note : comme on est dans le même package 'repositories', on a accès aux méthodes privées (minuscule)
-	sessions, err := deliverySessionRepo.fetchDeliverySessions(ctx, merchantID, "status IN ('1','PENDING')")
+	sessions, err := deliverySessionRepo.fetchDeliverySessions(ctx, merchantID, "ds.status IN ("+activeSessionStatuses+")")
 	if err != nil {
 		return nil, err
 	}
 
 	// Assemblage final
 	return &models.PendingOrdersResponse{
+		Status:           "ok",
+		SyncTimestamp:    &syncTimestamp,
 		Orders:           orders,
 		DeliverySessions: sessions,
+		RemovedOrderIDs:  removedIDs,
 	}, nil
 }
 
+// excludeIDs : ids sans ceux de exclude, ordre conservé
+func excludeIDs(ids, exclude []string) []string {
+	skip := make(map[string]bool, len(exclude))
+	for _, id := range exclude {
+		skip[id] = true
+	}
+	out := []string{}
+	for _, id := range ids {
+		if !skip[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// queryOrderIDs : requête légère qui ne retourne qu'une colonne order_id
+func (r *OrdersRepository) queryOrderIDs(ctx context.Context, q string, args ...interface{}) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var oid string
+		if err := rows.Scan(&oid); err != nil {
+			return nil, err
+		}
+		ids = append(ids, oid)
+	}
+	return ids, rows.Err()
+}
+
 // GetOrder : Récupère une seule commande par son ID (Réutilise toute la logique !)
-func (r *OrdersRepository) GetOrder(ctx context.Context, merchantID string, orderID string) (*models.Order, error) {
+func (r *OrdersRepository) GetOrder(ctx context.Context, merchantID, orderID, lang string) (*models.Order, error) {
 	r.log.Info("GetOrder START", zap.String("order_id", orderID))
 
 	// Filtre strict sur l'ID
-	filter := fmt.Sprintf(" AND o.order_id = '%s' ", orderID)
+	filter := OrderFilter{OrderIDs: []string{orderID}, Lang: lang}
 
 	orders, err := r.fetchAndBuildOrders(ctx, merchantID, filter)
 	if err != nil {
@@ -136,29 +201,166 @@ func (r *OrdersRepository) GetOrder(ctx context.Context, merchantID string, orde
 	return &orders[0], nil
 }
 
-func (r *OrdersRepository) GetHistory(ctx context.Context, merchantID string, req models.OrderHistoryRequest) ([]models.Order, error) {
+// GetHistory : commandes clôturées créées entre from et to (inclus)
+func (r *OrdersRepository) GetHistory(ctx context.Context, merchantID string, from, to time.Time, lang string) ([]models.Order, error) {
 	r.log.Info("GetHistory START", zap.String("merchant_id", merchantID))
 
-	filter := fmt.Sprintf(
-		" AND o.state = 'CLOSED' "+
-			"AND o.creation_date BETWEEN '%s' AND '%s' ",
-		req.DateFrom, req.DateTo,
-	)
+	filter := OrderFilter{
+		States:      []string{"CLOSED"},
+		CreatedFrom: &from,
+		CreatedTo:   &to,
+		Lang:        lang,
+	}
 
 	return r.fetchAndBuildOrders(ctx, merchantID, filter)
 }
 
-func (r *OrdersRepository) GetPaymentsForOrder(ctx context.Context, orderID string) ([]models.Payment, error) {
+// ErrInvalidCursor : the cursor was not produced by GetHistoryPage
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// GetHistoryPage : historique paginé par curseur (creation_date DESC, order_id DESC), projection légère.
+// L'arbre complet (11 requêtes) n'est construit qu'avec q.Expand, et seulement pour la page.
+func (r *OrdersRepository) GetHistoryPage(ctx context.Context, merchantID string, q models.OrderHistoryQuery, lang string) (*models.OrderHistoryPage, error) {
+	r.log.Info("GetHistoryPage START", zap.String("merchant_id", merchantID), zap.Int("limit", q.Limit))
+
+	filter := OrderFilter{
+		States:      q.States,
+		OrderTypes:  q.OrderTypes,
+		Brands:      q.Brands,
+		MOPs:        q.MOPs,
+		CustomerID:  q.CustomerID,
+		LocationID:  q.LocationID,
+		MinTTC:      q.MinTTC,
+		MaxTTC:      q.MaxTTC,
+		CreatedFrom: q.From,
+		CreatedTo:   q.To,
+		App:         q.App,
+	}
+	criteria, filterArgs := filter.sql()
+	args := append([]interface{}{merchantID}, filterArgs...)
+
+	if q.Cursor != "" {
+		after, afterID, err := decodeHistoryCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		criteria += " AND (o.creation_date < ? OR (o.creation_date = ? AND o.order_id < ?)) "
+		args = append(args, after, after, afterID)
+	}
+	// une ligne de plus pour savoir s'il reste une page
+	args = append(args, q.Limit+1)
+
+	// pas de jointure dso : DeliverySessionID n'est pas un critère de l'historique
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT o.order_id, o.order_num, o.order_type, o.state, o.brand, o.brand_order_num, o.means_of_payement,
+		       o.price, o.isPaid, o.creation_date, c.customer_id, c.customer_name,
+		       (SELECT GROUP_CONCAT(l.location_name ORDER BY l.location_name SEPARATOR ', ')
+		        FROM order_location ol
+		        INNER JOIN locations l ON l.location_id = ol.location_id AND l.merchant_id = o.merchant_id
+		        WHERE ol.order_id = o.order_id) AS location_names
+		FROM orders o
+		LEFT JOIN customer c ON o.customer_id = c.customer_id
+		WHERE o.merchant_id = ? AND o.creation_date IS NOT NULL `+criteria+`
+		ORDER BY o.creation_date DESC, o.order_id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.OrderHistoryPage{Orders: []models.OrderHistoryEntry{}}
+	for rows.Next() {
+		var e models.OrderHistoryEntry
+		var orderNum, orderType, state, brand, brandOrderNum, mop, customerName, locationNames sql.NullString
+		var price, customerID sql.NullInt64
+		var isPaid sql.NullBool
+		if err := rows.Scan(&e.OrderID, &orderNum, &orderType, &state, &brand, &brandOrderNum, &mop,
+			&price, &isPaid, &e.CreationDate, &customerID, &customerName, &locationNames); err != nil {
+			return nil, err
+		}
+		e.OrderNum = nullStringToPtr(orderNum)
+		e.OrderType = nullStringToPtr(orderType)
+		e.State = nullStringToPtr(state)
+		e.Brand = nullStringToPtr(brand)
+		e.BrandOrderNum = nullStringToPtr(brandOrderNum)
+		e.MeansOfPayment = nullStringToPtr(mop)
+		e.TTC = price.Int64
+		e.IsPaid = isPaid.Bool
+		e.CustomerID = nullInt64ToPtr(customerID)
+		e.CustomerName = nullStringToPtr(customerName)
+		e.LocationNames = nullStringToPtr(locationNames)
+		page.Orders = append(page.Orders, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Orders) > q.Limit {
+		page.Orders = page.Orders[:q.Limit]
+		last := page.Orders[len(page.Orders)-1]
+		next := encodeHistoryCursor(last.CreationDate, last.OrderID)
+		page.NextCursor = &next
+	}
+
+	if q.Expand && len(page.Orders) > 0 {
+		ids := make([]string, 0, len(page.Orders))
+		for _, e := range page.Orders {
+			ids = append(ids, e.OrderID)
+		}
+		orders, err := r.fetchAndBuildOrders(ctx, merchantID, OrderFilter{OrderIDs: ids, Lang: lang})
+		if err != nil {
+			return nil, err
+		}
+		// le constructeur ne trie pas : on remet l'ordre de la page
+		byID := make(map[string]models.Order, len(orders))
+		for _, o := range orders {
+			byID[o.OrderID] = o
+		}
+		page.Details = make([]models.Order, 0, len(ids))
+		for _, id := range ids {
+			if o, ok := byID[id]; ok {
+				page.Details = append(page.Details, o)
+			}
+		}
+	}
+
+	return page, nil
+}
+
+// encodeHistoryCursor : opaque pour le client, position de la dernière commande de la page
+func encodeHistoryCursor(creationDate time.Time, orderID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(creationDate.UTC().Format(time.RFC3339Nano) + "|" + orderID))
+}
+
+func decodeHistoryCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	date, orderID, ok := strings.Cut(string(raw), "|")
+	if !ok || orderID == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return t, orderID, nil
+}
+
+// GetPaymentsForOrder : payments of an order of the merchant (none for someone else's order)
+func (r *OrdersRepository) GetPaymentsForOrder(ctx context.Context, merchantID, orderID string) ([]models.Payment, error) {
 	r.log.Info("GetPaymentsForOrder START", zap.String("order_id", orderID))
 
 	q := `
-		SELECT order_id, payment_id, mop, amount, payment_date, enabled
-		FROM payments
-		WHERE order_id = ?
-		ORDER BY payment_date ASC
+		SELECT p.order_id, p.payment_id, p.mop, p.amount, p.payment_date, p.enabled
+		FROM payments p
+		INNER JOIN orders o ON o.order_id = p.order_id AND o.merchant_id = ?
+		WHERE p.order_id = ?
+		ORDER BY p.payment_date ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, q, orderID)
+	rows, err := r.db.QueryContext(ctx, q, merchantID, orderID)
 	if err != nil {
 		r.log.Error("GetPaymentsForOrder ERROR", zap.Error(err))
 		return nil, err
@@ -183,37 +385,272 @@ func (r *OrdersRepository) GetPaymentsForOrder(ctx context.Context, orderID stri
 		payments = append(payments, p)
 	}
 
-	return payments, nil
+	return payments, rows.Err()
 }
 
-func (r *OrdersRepository) DisablePayment(ctx context.Context, paymentID string) error {
-	r.log.Info("DisablePayment START", zap.String("payment_id", paymentID))
+// DisablePayment disables a payment of an order of the merchant.
+// sql.ErrNoRows when the payment is not one of this order (or the order not the merchant's).
+func (r *OrdersRepository) DisablePayment(ctx context.Context, merchantID, orderID, paymentID string) error {
+	r.log.Info("DisablePayment START", zap.String("order_id", orderID), zap.String("payment_id", paymentID))
 
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
+	var enabled sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+		SELECT p.enabled
+		FROM payments p
+		INNER JOIN orders o ON o.order_id = p.order_id AND o.merchant_id = ? AND p.order_id = ?
+		WHERE p.payment_id = ?
+		FOR UPDATE
+	`, merchantID, orderID, paymentID).Scan(&enabled)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Disable payment
-	_, err = tx.ExecContext(ctx, `
-		UPDATE payments SET enabled = 0 WHERE payment_id = ?
-	`, paymentID)
+	if _, err := tx.ExecContext(ctx, `UPDATE payments SET enabled = 0 WHERE payment_id = ?`, paymentID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Refresh order (isPaid + paid_quantity)
+	// seules les quantités de ce paiement sont retirées (une fois) : paid_quantity peut venir
+	// du PHP, qui n'écrit pas payment_orderitems
+	if enabled.Int64 == 1 {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE orderitems oi
+			INNER JOIN payment_orderitems poi ON poi.order_item_id = oi.order_item_id AND poi.payment_id = ?
+			SET oi.paid_quantity = GREATEST(oi.paid_quantity - poi.quantity, 0)
+		`, paymentID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := refreshPaymentStatus(ctx, tx, orderID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ErrPaymentExceedsDue : a split payment asks for more quantity than what is left to pay
+var ErrPaymentExceedsDue = errors.New("payment exceeds remaining quantity")
+
+// ErrOrderNotPayable : the order is CLOSED, CANCELED or DELETED
+var ErrOrderNotPayable = errors.New("order can't take payments")
+
+// ErrPaymentAmountMismatch : a split payment whose amount is not the value of its items
+var ErrPaymentAmountMismatch = errors.New("payment amount does not match its items")
+
+// AddPayment records a payment, optionally attached to order item quantities (split bill).
+// The order row is locked for the whole transaction so two devices paying the same table are serialized.
+func (r *OrdersRepository) AddPayment(ctx context.Context, merchantID, orderID string, req models.AddPaymentRequest) (int64, error) {
+	r.log.Info("AddPayment START", zap.String("order_id", orderID), zap.String("mop", req.MOP), zap.Int("items", len(req.Items)))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var state sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT state FROM orders WHERE order_id = ? AND merchant_id = ? FOR UPDATE
+	`, orderID, merchantID).Scan(&state)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	switch state.String {
+	case "CLOSED", "CANCELED", "DELETED":
+		tx.Rollback()
+		return 0, fmt.Errorf("%w: order is %s", ErrOrderNotPayable, state.String)
+	}
+
+	// une même ligne envoyée deux fois est payée une fois, pour la somme des quantités
+	items := []models.PaymentItemRequest{}
+	index := map[string]int{}
+	for _, it := range req.Items {
+		if i, ok := index[it.OrderItemID]; ok {
+			items[i].Quantity += it.Quantity
+			continue
+		}
+		index[it.OrderItemID] = len(items)
+		items = append(items, it)
+	}
+
+	var itemsAmount int64
+	for _, it := range items {
+		var quantity, paidQuantity, price sql.NullInt64
+		err := tx.QueryRowContext(ctx, `
+			SELECT quantity, paid_quantity, price FROM orderitems
+			WHERE order_item_id = ? AND order_id = ?
+			FOR UPDATE
+		`, it.OrderItemID, orderID).Scan(&quantity, &paidQuantity, &price)
+		if err == sql.ErrNoRows {
+			tx.Rollback()
+			return 0, fmt.Errorf("%w: order item %s", ErrInvalidReference, it.OrderItemID)
+		}
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if int64(it.Quantity) > quantity.Int64-paidQuantity.Int64 {
+			tx.Rollback()
+			return 0, fmt.Errorf("%w: order item %s", ErrPaymentExceedsDue, it.OrderItemID)
+		}
+		itemsAmount += price.Int64 * int64(it.Quantity)
+	}
+	// payer 1€ ne doit pas marquer 30€ de lignes comme payées
+	amount := req.Amount
+	if len(items) > 0 {
+		if amount != 0 && amount != itemsAmount {
+			tx.Rollback()
+			return 0, fmt.Errorf("%w: amount %d, items %d", ErrPaymentAmountMismatch, amount, itemsAmount)
+		}
+		amount = itemsAmount
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO payments (order_id, mop, amount, payment_date, enabled)
+		VALUES (?, ?, ?, UTC_TIMESTAMP(), 1)
+	`, orderID, req.MOP, amount)
 	if err != nil {
 		tx.Rollback()
+		return 0, err
+	}
+	paymentID, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, it := range items {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO payment_orderitems (payment_id, order_item_id, quantity) VALUES (?, ?, ?)
+		`, paymentID, it.OrderItemID, it.Quantity)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE orderitems SET paid_quantity = LEAST(quantity, paid_quantity + ?)
+			WHERE order_item_id = ? AND order_id = ?
+		`, it.Quantity, it.OrderItemID, orderID)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := refreshPaymentStatus(ctx, tx, orderID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return paymentID, nil
+}
+
+// refreshPaymentStatus recomputes orders.isPaid from the enabled payments and orderitems.isPaid
+// from paid_quantity. paid_quantity itself only moves by the quantities of the payment added or
+// disabled (it can come from the PHP backend, which doesn't write payment_orderitems).
+// When the amount covers the order, what is left to pay is attributed to its latest payment,
+// so that disabling this payment gives it back.
+func refreshPaymentStatus(ctx context.Context, tx *sql.Tx, orderID string) error {
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE orders o
+		SET o.isPaid = (
+			SELECT COALESCE(SUM(p.amount), 0) FROM payments p WHERE p.order_id = o.order_id AND p.enabled = 1
+		) >= o.price,
+		o.last_update = UTC_TIMESTAMP()
+		WHERE o.order_id = ?`, []interface{}{orderID}},
+
+		{`INSERT INTO payment_orderitems (payment_id, order_item_id, quantity)
+		SELECT last.payment_id, oi.order_item_id, oi.quantity - oi.paid_quantity
+		FROM orderitems oi
+		INNER JOIN orders o ON o.order_id = oi.order_id AND o.isPaid = 1
+		INNER JOIN (
+			SELECT MAX(payment_id) AS payment_id FROM payments WHERE order_id = ? AND enabled = 1
+		) last ON last.payment_id IS NOT NULL
+		WHERE oi.order_id = ? AND oi.paid_quantity < oi.quantity
+		ON DUPLICATE KEY UPDATE quantity = payment_orderitems.quantity + VALUES(quantity)`, []interface{}{orderID, orderID}},
+
+		{`UPDATE orderitems oi
+		INNER JOIN orders o ON o.order_id = oi.order_id
+		SET oi.paid_quantity = oi.quantity
+		WHERE oi.order_id = ? AND o.isPaid = 1`, []interface{}{orderID}},
+
+		{`UPDATE orderitems SET isPaid = (paid_quantity >= quantity) WHERE order_id = ?`, []interface{}{orderID}},
+	}
+	for _, st := range steps {
+		if _, err := tx.ExecContext(ctx, st.query, st.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrStateConflict : the order state changed between the read and the update
+var ErrStateConflict = errors.New("order state changed concurrently")
+
+func (r *OrdersRepository) GetOrderState(ctx context.Context, merchantID, orderID string) (string, error) {
+	var state sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		`SELECT state FROM orders WHERE order_id = ? AND merchant_id = ?`,
+		orderID, merchantID,
+	).Scan(&state)
+	if err != nil {
+		return "", err
+	}
+	return state.String, nil
+}
+
+// UpdateOrderState moves the order only if it is still in fromState, and keeps an audit row
+func (r *OrdersRepository) UpdateOrderState(ctx context.Context, merchantID, orderID, fromState, toState, userID string) error {
+	r.log.Info("UpdateOrderState START",
+		zap.String("order_id", orderID), zap.String("from", fromState), zap.String("to", toState), zap.String("user_id", userID))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
 		return err
 	}
 
-	// Refresh order as unpaid
-	_, err = tx.ExecContext(ctx, `
-		UPDATE orders o 
-		JOIN payments p ON o.order_id = p.order_id
-		SET o.isPaid = false, o.last_update = UTC_TIMESTAMP()
-		WHERE p.payment_id = ?
-	`, paymentID)
+	res, err := tx.ExecContext(ctx, `
+		UPDATE orders SET state = ?, last_update = UTC_TIMESTAMP()
+		WHERE order_id = ? AND merchant_id = ? AND state = ?
+	`, toState, orderID, merchantID, fromState)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return ErrStateConflict
+	}
+
+	if err := insertOrderStateHistory(ctx, tx, orderID, fromState, toState, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	return tx.Commit()
 }
+
+func insertOrderStateHistory(ctx context.Context, tx *sql.Tx, orderID, fromState, toState, userID string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO order_state_history (order_id, from_state, to_state, user_id, changed_at)
+		VALUES (?, ?, ?, ?, UTC_TIMESTAMP())
+	`, orderID, fromState, toState, userID)
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math"
 	"time"
 
 	"go.uber.org/zap"
@@ -128,3 +129,60 @@ func dumpRawRow(rows *sql.Rows) []interface{} {
 	rows.Scan(rawPtrs...)
 	return raw
 }
+
+// vatFromGross extracts the VAT part of a TTC amount for a rate expressed in percent (10, 5.5, 20...)
+func vatFromGross(gross int64, rate float64) int64 {
+	if rate <= 0 {
+		return 0
+	}
+	return int64(math.Round(float64(gross) - float64(gross)/(1+rate/100)))
+}
+
+// nextDailyNumber gives the next number of a per-merchant daily counter (order_num, booking_number).
+// The counter row stays locked until tx ends, so concurrent creates are serialized on it.
+// day is in the merchant time zone: the counter is per local day, like the Z and cash reports.
+// currentMax returns the highest number already given that day (the PHP backend still
+// numbers with MAX+1), it takes merchantID and the UTC bounds [start, end) of the day as arguments.
+func nextDailyNumber(ctx context.Context, tx *sql.Tx, merchantID, counter string, day time.Time, currentMax string) (int64, error) {
+	date := day.Format("2006-01-02")
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+
+	// crée la ligne du jour au besoin et la verrouille
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO daily_counters (merchant_id, counter_name, counter_date, last_value)
+		VALUES (?, ?, ?, 0)
+		ON DUPLICATE KEY UPDATE last_value = last_value`,
+		merchantID, counter, date,
+	); err != nil {
+		return 0, fmt.Errorf("%s counter error: %w", counter, err)
+	}
+	var last int64
+	if err := tx.QueryRowContext(ctx, `
+		SELECT last_value FROM daily_counters
+		WHERE merchant_id = ? AND counter_name = ? AND counter_date = ?
+		FOR UPDATE`,
+		merchantID, counter, date,
+	).Scan(&last); err != nil {
+		return 0, fmt.Errorf("%s counter error: %w", counter, err)
+	}
+
+	var given int64
+	if err := tx.QueryRowContext(ctx, currentMax, merchantID, start.UTC(), end.UTC()).Scan(&given); err != nil {
+		return 0, fmt.Errorf("%s max query error: %w", counter, err)
+	}
+	next := last
+	if given > next {
+		next = given
+	}
+	next++
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE daily_counters SET last_value = ?
+		WHERE merchant_id = ? AND counter_name = ? AND counter_date = ?`,
+		next, merchantID, counter, date,
+	); err != nil {
+		return 0, fmt.Errorf("%s counter error: %w", counter, err)
+	}
+	return next, nil
+}
@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+type ReportsRepository struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewReportsRepository(db *sql.DB, log *zap.Logger) *ReportsRepository {
+	return &ReportsRepository{db: db, log: log}
+}
+
+// GetCashReport aggregates payments by mop, and orders by order_type and by TVA rate, over [from, to) (UTC).
+// orders.price includes the delivery fees, which are not items: they are reported on their own
+// (DeliveryFees) so that the TVA rates plus the fees add up to the order type totals.
+func (r *ReportsRepository) GetCashReport(ctx context.Context, merchantID string, from, to time.Time) (*models.CashReport, error) {
+	r.log.Info("GetCashReport START", zap.String("merchant_id", merchantID), zap.Time("from", from), zap.Time("to", to))
+
+	report := &models.CashReport{From: from, To: to, OrderTypes: []models.OrderTypeTotal{}, TVARates: []models.TVARateTotal{}}
+
+	var err error
+	report.Payments, report.PaymentsTotal, err = paymentsByMOP(ctx, r.db, merchantID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("cash report payments query error: %w", err)
+	}
+
+	// --- Par type de commande ---
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT COALESCE(order_type, ''), COUNT(*), COALESCE(SUM(price), 0), COALESCE(SUM(TVA), 0), COALESCE(SUM(HT), 0),
+		       COALESCE(SUM(delivery_fees), 0)
+		FROM orders
+		WHERE merchant_id = ? AND creation_date >= ? AND creation_date < ? AND state NOT IN ('CANCELED', 'DELETED')
+		GROUP BY order_type
+		ORDER BY order_type
+	`, merchantID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("cash report order types query error: %w", err)
+	}
+	for rows.Next() {
+		var t models.OrderTypeTotal
+		var deliveryFees int64
+		if err := rows.Scan(&t.OrderType, &t.Count, &t.TTC, &t.TVA, &t.HT, &deliveryFees); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.DeliveryFees += deliveryFees
+		report.OrdersCount += t.Count
+		report.TTC += t.TTC
+		report.TVA += t.TVA
+		report.HT += t.HT
+		report.OrderTypes = append(report.OrderTypes, t)
+	}
+	rows.Close()
+
+	// --- Par taux de TVA : même choix de taux que fetchAndBuildOrders / CreateOrder selon le type ---
+	rows, err = r.db.QueryContext(ctx, `
+		SELECT CASE o.order_type
+		           WHEN 'DELIVERY' THEN tva_delivery.tva_rate
+		           WHEN 'TAKE_AWAY' THEN tva_take_away.tva_rate
+		           ELSE tva_in.tva_rate
+		       END AS rate,
+		       COALESCE(SUM(oi.price * oi.quantity), 0)
+		FROM orders o
+		INNER JOIN orderitems oi ON o.order_id = oi.order_id AND oi.merchant_id = o.merchant_id
+		INNER JOIN products p ON oi.product_id = p.product_id AND oi.merchant_id = p.merchant_id
+		INNER JOIN tva_categories tva_in ON tva_in.tva_id = p.tva_in_id
+		INNER JOIN tva_categories tva_delivery ON tva_delivery.tva_id = p.tva_delivery_id
+		INNER JOIN tva_categories tva_take_away ON tva_take_away.tva_id = p.tva_take_away_id
+		WHERE oi.quantity > 0 AND o.merchant_id = ? AND o.creation_date >= ? AND o.creation_date < ?
+		AND o.state NOT IN ('CANCELED', 'DELETED')
+		GROUP BY rate
+		ORDER BY rate
+	`, merchantID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("cash report tva query error: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t models.TVARateTotal
+		if err := rows.Scan(&t.Rate, &t.TTC); err != nil {
+			return nil, err
+		}
+		t.TVA = vatFromGross(t.TTC, t.Rate)
+		t.HT = t.TTC - t.TVA
+		report.TVARates = append(report.TVARates, t)
+	}
+
+	return report, rows.Err()
+}
+
+// paymentsByMOP : enabled payments of the merchant over [from, to), grouped by mop
+func paymentsByMOP(ctx context.Context, q queryer, merchantID string, from, to time.Time) ([]models.MOPTotal, int64, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT p.mop, COUNT(*), COALESCE(SUM(p.amount), 0)
+		FROM payments p
+		INNER JOIN orders o ON o.order_id = p.order_id
+		WHERE o.merchant_id = ? AND p.enabled = 1 AND p.payment_date >= ? AND p.payment_date < ?
+		GROUP BY p.mop
+		ORDER BY p.mop
+	`, merchantID, from, to)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	totals := []models.MOPTotal{}
+	var total int64
+	for rows.Next() {
+		var t models.MOPTotal
+		var amount float64
+		if err := rows.Scan(&t.MOP, &t.Count, &amount); err != nil {
+			return nil, 0, err
+		}
+		t.Amount = int64(amount)
+		total += t.Amount
+		totals = append(totals, t)
+	}
+	return totals, total, rows.Err()
+}
@@ -0,0 +1,671 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/units"
+
+	"go.uber.org/zap"
+)
+
+// stock_movements.movement_type
+const (
+	StockConsumption = "CONSUMPTION"
+	StockReception   = "RECEPTION"
+	StockInventory   = "INVENTORY"
+)
+
+type StockRepository struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewStockRepository(db *sql.DB, log *zap.Logger) *StockRepository {
+	return &StockRepository{db: db, log: log}
+}
+
+// stockRef : what a movement is attached to, empty values stored as NULL
+type stockRef struct {
+	OrderID     string
+	OrderItemID string
+	UserID      string
+	Comment     string
+}
+
+func (r *StockRepository) ListComponents(ctx context.Context, merchantID string) ([]models.StockComponent, error) {
+	r.log.Info("ListComponents START", zap.String("merchant_id", merchantID))
+	return r.queryComponents(ctx, `WHERE c.merchant_id = ? ORDER BY c.name`, merchantID)
+}
+
+// GetComponent : sql.ErrNoRows if not a component of the merchant
+func (r *StockRepository) GetComponent(ctx context.Context, merchantID, componentID string) (*models.StockComponent, error) {
+	list, err := r.queryComponents(ctx, `WHERE c.merchant_id = ? AND c.component_id = ?`, merchantID, componentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &list[0], nil
+}
+
+func (r *StockRepository) queryComponents(ctx context.Context, where string, args ...interface{}) ([]models.StockComponent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.component_id, c.name, c.category_id, c.status, c.stock_quantity, c.stock_unit, c.safety_stock, c.extra_quantity
+		FROM components c
+		`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("stock components query error: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.StockComponent{}
+	for rows.Next() {
+		var c models.StockComponent
+		var categoryID, stockUnit sql.NullString
+		var status sql.NullInt64
+		var safety, extra sql.NullFloat64
+		if err := rows.Scan(&c.ComponentID, &c.Name, &categoryID, &status, &c.StockQuantity, &stockUnit, &safety, &extra); err != nil {
+			return nil, err
+		}
+		c.CategoryID = nullStringToPtr(categoryID)
+		c.StockUnit = nullStringToPtr(stockUnit)
+		c.Status = int(status.Int64)
+		c.SafetyStock = nullFloat64Ptr(safety)
+		c.ExtraQuantity = nullFloat64Ptr(extra)
+		c.BelowSafetyStock = safety.Valid && c.StockQuantity <= safety.Float64
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// ListMovements : most recent first
+func (r *StockRepository) ListMovements(ctx context.Context, merchantID string, filter models.StockMovementFilter) ([]models.StockMovement, error) {
+	r.log.Info("ListMovements START", zap.String("merchant_id", merchantID), zap.String("component_id", filter.ComponentID))
+
+	criteria := ""
+	args := []interface{}{merchantID}
+	if filter.ComponentID != "" {
+		criteria += " AND sm.component_id = ?"
+		args = append(args, filter.ComponentID)
+	}
+	if filter.Type != "" {
+		criteria += " AND sm.movement_type = ?"
+		args = append(args, filter.Type)
+	}
+	if filter.From != nil {
+		criteria += " AND sm.created_at >= ?"
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		criteria += " AND sm.created_at < ?"
+		args = append(args, *filter.To)
+	}
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT sm.id, sm.component_id, c.name, sm.movement_type, sm.quantity, sm.stock_after,
+		       sm.order_id, sm.order_item_id, sm.user_id, sm.comment, sm.created_at
+		FROM stock_movements sm
+		INNER JOIN components c ON c.component_id = sm.component_id
+		WHERE sm.merchant_id = ?`+criteria+`
+		ORDER BY sm.created_at DESC, sm.id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("stock movements query error: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.StockMovement{}
+	for rows.Next() {
+		var m models.StockMovement
+		var orderID, orderItemID, userID, comment sql.NullString
+		if err := rows.Scan(&m.MovementID, &m.ComponentID, &m.ComponentName, &m.Type, &m.Quantity, &m.StockAfter,
+			&orderID, &orderItemID, &userID, &comment, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.OrderID = nullStringToPtr(orderID)
+		m.OrderItemID = nullStringToPtr(orderItemID)
+		m.UserID = nullStringToPtr(userID)
+		m.Comment = nullStringToPtr(comment)
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// UpdateComponent sets the stock unit / safety stock / extra portion of a component, the safety
+// stock applies right away. units.ErrIncompatibleUnits when the stock unit changes dimension.
+// A first stock unit (stock_unit NULL) converts nothing: the quantities were counted in the unit
+// of the recipes, they are taken as already in that unit. A conversion is recorded as an
+// INVENTORY movement of 0, its stock_after being the stock in the new unit.
+func (r *StockRepository) UpdateComponent(ctx context.Context, merchantID, userID, componentID string, req models.StockComponentRequest, disableUnderSafety bool) (*models.StockUpdate, error) {
+	r.log.Info("UpdateComponent START", zap.String("merchant_id", merchantID), zap.String("component_id", componentID))
+
+	return r.inStockTx(ctx, merchantID, disableUnderSafety, func(tx *sql.Tx) ([]string, error) {
+		var stockUnit sql.NullString
+		if err := tx.QueryRowContext(ctx, `
+			SELECT stock_unit FROM components WHERE merchant_id = ? AND component_id = ? FOR UPDATE
+		`, merchantID, componentID).Scan(&stockUnit); err != nil {
+			return nil, err
+		}
+
+		if req.StockUnit != nil && stockUnit.Valid && *req.StockUnit != stockUnit.String {
+			// même dimension seulement : le facteur est le même pour les trois quantités
+			factor, err := units.Convert(1, stockUnit.String, *req.StockUnit)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE components
+				SET stock_quantity = stock_quantity * ?, safety_stock = safety_stock * ?, extra_quantity = extra_quantity * ?
+				WHERE merchant_id = ? AND component_id = ?
+			`, factor, factor, factor, merchantID, componentID); err != nil {
+				return nil, err
+			}
+			// rien n'entre ni ne sort : le mouvement garde la trace du changement d'échelle de stock_after
+			comment := fmt.Sprintf("stock unit %s -> %s", stockUnit.String, *req.StockUnit)
+			if err := moveStock(ctx, tx, merchantID, componentID, StockInventory, 0, false, stockRef{UserID: userID, Comment: comment}); err != nil {
+				return nil, err
+			}
+		}
+
+		cols, vals := []string{}, []interface{}{}
+		if req.StockUnit != nil {
+			cols = append(cols, "stock_unit")
+			vals = append(vals, *req.StockUnit)
+		}
+		if req.SafetyStock != nil {
+			cols = append(cols, "safety_stock")
+			vals = append(vals, *req.SafetyStock)
+		}
+		if req.ExtraQuantity != nil {
+			cols = append(cols, "extra_quantity")
+			vals = append(vals, *req.ExtraQuantity)
+		}
+		for i, col := range cols {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE components SET `+col+` = ? WHERE merchant_id = ? AND component_id = ?
+			`, vals[i], merchantID, componentID); err != nil {
+				return nil, err
+			}
+		}
+		return []string{componentID}, nil
+	})
+}
+
+// Receive adds a delivery to the stock
+func (r *StockRepository) Receive(ctx context.Context, merchantID, userID string, req models.StockCountRequest, disableUnderSafety bool) (*models.StockUpdate, error) {
+	r.log.Info("Receive START", zap.String("merchant_id", merchantID), zap.Int("items", len(req.Items)))
+	return r.count(ctx, merchantID, StockReception, userID, req, disableUnderSafety)
+}
+
+// Inventory sets the stock to what was counted, the difference is recorded as the movement
+func (r *StockRepository) Inventory(ctx context.Context, merchantID, userID string, req models.StockCountRequest, disableUnderSafety bool) (*models.StockUpdate, error) {
+	r.log.Info("Inventory START", zap.String("merchant_id", merchantID), zap.Int("items", len(req.Items)))
+	return r.count(ctx, merchantID, StockInventory, userID, req, disableUnderSafety)
+}
+
+func (r *StockRepository) count(ctx context.Context, merchantID, movementType, userID string, req models.StockCountRequest, disableUnderSafety bool) (*models.StockUpdate, error) {
+	return r.inStockTx(ctx, merchantID, disableUnderSafety, func(tx *sql.Tx) ([]string, error) {
+		touched := []string{}
+		seen := map[string]bool{}
+		for _, it := range req.Items {
+			if !seen[it.ComponentID] {
+				seen[it.ComponentID] = true
+				touched = append(touched, it.ComponentID)
+			}
+		}
+		if err := lockComponents(ctx, tx, merchantID, touched); err != nil {
+			return nil, err
+		}
+
+		ref := stockRef{UserID: userID, Comment: req.Comment}
+		for _, it := range req.Items {
+			if err := moveStock(ctx, tx, merchantID, it.ComponentID, movementType, it.Quantity, movementType == StockInventory, ref); err != nil {
+				return nil, err
+			}
+		}
+		return touched, nil
+	})
+}
+
+// lockComponents locks the stock rows up front, always in the same order so two
+// concurrent movements can't deadlock. ErrInvalidReference if one isn't a component of the merchant.
+func lockComponents(ctx context.Context, tx *sql.Tx, merchantID string, componentIDs []string) error {
+	if len(componentIDs) == 0 {
+		return nil
+	}
+	args := []interface{}{merchantID}
+	for _, id := range componentIDs {
+		args = append(args, id)
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT component_id FROM components
+		WHERE merchant_id = ? AND component_id IN (`+placeholders(len(componentIDs))+`)
+		ORDER BY component_id
+		FOR UPDATE`, args...)
+	if err != nil {
+		return fmt.Errorf("components lock error: %w", err)
+	}
+	defer rows.Close()
+
+	found := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range componentIDs {
+		if !found[id] {
+			return fmt.Errorf("%w: component %s", ErrInvalidReference, id)
+		}
+	}
+	return nil
+}
+
+// ConsumeOrder takes the components of what was produced out of the stock: the produced
+// units (production_status_done_quantity), or every unit once the order is done (wholeOrder,
+// always the case for a DONE / CLOSED order).
+// orderitems.stock_consumed_quantity keeps track of what was already taken, so it can be
+// called again for the same order: only the new units are consumed. An order created before
+// the merchant started managing stock (merchant.stock_enabled_at) consumes nothing.
+func (r *StockRepository) ConsumeOrder(ctx context.Context, merchantID, orderID, userID string, wholeOrder, disableUnderSafety bool) (*models.StockUpdate, error) {
+	r.log.Info("ConsumeOrder START", zap.String("merchant_id", merchantID), zap.String("order_id", orderID), zap.Bool("whole_order", wholeOrder))
+
+	update, err := r.inStockTx(ctx, merchantID, disableUnderSafety, func(tx *sql.Tx) ([]string, error) {
+		type pending struct {
+			orderItemID, productID string
+			target, units          int
+		}
+
+		var state sql.NullString
+		var beforeStock bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT o.state, COALESCE(o.creation_date < m.stock_enabled_at, 0)
+			FROM orders o
+			INNER JOIN merchant m ON m.id = o.merchant_id
+			WHERE o.order_id = ? AND o.merchant_id = ?
+		`, orderID, merchantID).Scan(&state, &beforeStock); err != nil {
+			return nil, err
+		}
+		if beforeStock {
+			return nil, nil
+		}
+		if state.String == "DONE" || state.String == "CLOSED" {
+			wholeOrder = true
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			SELECT oi.order_item_id, oi.product_id, oi.quantity, oi.production_status_done_quantity, oi.stock_consumed_quantity
+			FROM orderitems oi
+			WHERE oi.order_id = ? AND oi.merchant_id = ?
+			ORDER BY oi.order_item_id
+			FOR UPDATE`, orderID, merchantID)
+		if err != nil {
+			return nil, fmt.Errorf("order items query error: %w", err)
+		}
+		var items []pending
+		for rows.Next() {
+			var it pending
+			var qty, done, consumed sql.NullInt64
+			if err := rows.Scan(&it.orderItemID, &it.productID, &qty, &done, &consumed); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			it.target = int(done.Int64)
+			if wholeOrder || it.target > int(qty.Int64) {
+				it.target = int(qty.Int64)
+			}
+			// quantité baissée après production : ce qui a été produit reste consommé
+			if it.units = it.target - int(consumed.Int64); it.units > 0 {
+				items = append(items, it)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		perUnit := make([]map[string]float64, len(items))
+		seen := map[string]bool{}
+		touched := []string{}
+		for i, it := range items {
+			if perUnit[i], err = r.componentsPerUnit(ctx, tx, merchantID, it.orderItemID, it.productID); err != nil {
+				return nil, err
+			}
+			for id, qty := range perUnit[i] {
+				if qty > 0 && !seen[id] {
+					seen[id] = true
+					touched = append(touched, id)
+				}
+			}
+		}
+		sort.Strings(touched)
+		if err := lockComponents(ctx, tx, merchantID, touched); err != nil {
+			return nil, err
+		}
+
+		for i, it := range items {
+			ref := stockRef{OrderID: orderID, OrderItemID: it.orderItemID, UserID: userID}
+			for _, id := range touched {
+				qty := perUnit[i][id]
+				if qty <= 0 {
+					continue
+				}
+				if err := moveStock(ctx, tx, merchantID, id, StockConsumption, -qty*float64(it.units), false, ref); err != nil {
+					return nil, err
+				}
+			}
+
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE orderitems SET stock_consumed_quantity = ? WHERE order_item_id = ?
+			`, it.target, it.orderItemID); err != nil {
+				return nil, err
+			}
+		}
+		return touched, nil
+	})
+	if err != nil {
+		r.log.Error("ConsumeOrder failed", zap.String("order_id", orderID), zap.Error(err))
+		return nil, err
+	}
+	return update, nil
+}
+
+// componentsPerUnit : what one unit of an order item takes out of the stock, component_id -> quantity
+// in the stock unit of the component. The recipe of the product, minus the components removed
+// ("without"), plus the extras (components.extra_quantity, or the quantity of the recipe when not set).
+// With a stock unit set, a recipe line without a unit, or whose unit doesn't convert to the stock
+// unit, is left out (and logged): its quantity means nothing in the stock unit.
+func (r *StockRepository) componentsPerUnit(ctx context.Context, tx *sql.Tx, merchantID, orderItemID, productID string) (map[string]float64, error) {
+	recipe := map[string]float64{}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT rq.component_id, rq.quantity, uc.code, c.stock_unit
+		FROM recipes rc
+		INNER JOIN requires rq ON rq.recipe_id = rc.recipe_id AND rq.enabled = 1
+		INNER JOIN components c ON c.component_id = rq.component_id AND c.merchant_id = ?
+		LEFT JOIN unit_of_measure_code uc ON uc.id = rq.unit_of_measure
+		WHERE rc.product_id = ?`, merchantID, productID)
+	if err != nil {
+		return nil, fmt.Errorf("recipe query error: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		var qty sql.NullFloat64
+		var code, stockUnit sql.NullString
+		if err := rows.Scan(&id, &qty, &code, &stockUnit); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		q := qty.Float64
+		if stockUnit.Valid && !code.Valid {
+			// ligne sans unité connue : sa quantité ne veut rien dire dans l'unité de stock
+			r.log.Warn("recipe line without unit, component not consumed",
+				zap.String("order_item_id", orderItemID), zap.String("product_id", productID),
+				zap.String("component_id", id), zap.String("stock_unit", stockUnit.String))
+			continue
+		}
+		if code.Valid && stockUnit.Valid {
+			converted, err := units.Convert(q, code.String, stockUnit.String)
+			if err != nil {
+				// recette mal saisie : on ne bloque pas la commande, ce composant n'est pas consommé
+				r.log.Warn("recipe quantity not converted, component not consumed",
+					zap.String("order_item_id", orderItemID), zap.String("product_id", productID),
+					zap.String("component_id", id), zap.Error(err))
+				continue
+			}
+			q = converted
+		}
+		recipe[id] += q
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	perUnit := make(map[string]float64, len(recipe))
+	for id, qty := range recipe {
+		perUnit[id] = qty
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT component_id FROM without WHERE order_item_id = ?`, orderItemID)
+	if err != nil {
+		return nil, fmt.Errorf("without query error: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		delete(perUnit, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT e.component_id, c.extra_quantity
+		FROM extra e
+		INNER JOIN components c ON c.component_id = e.component_id AND c.merchant_id = ?
+		WHERE e.order_item_id = ?`, merchantID, orderItemID)
+	if err != nil {
+		return nil, fmt.Errorf("extra query error: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var extra sql.NullFloat64
+		if err := rows.Scan(&id, &extra); err != nil {
+			return nil, err
+		}
+		if extra.Valid {
+			perUnit[id] += extra.Float64
+		} else {
+			perUnit[id] += recipe[id]
+		}
+	}
+	return perUnit, rows.Err()
+}
+
+// moveStock applies a movement to a component and records it. absolute: quantity is the new
+// stock (inventory count), the movement is the difference.
+// The component is expected to be locked already (lockComponents).
+func moveStock(ctx context.Context, tx *sql.Tx, merchantID, componentID, movementType string, quantity float64, absolute bool, ref stockRef) error {
+	var current float64
+	if err := tx.QueryRowContext(ctx, `
+		SELECT stock_quantity FROM components WHERE merchant_id = ? AND component_id = ?
+	`, merchantID, componentID).Scan(&current); err != nil {
+		return err
+	}
+
+	delta := quantity
+	if absolute {
+		delta = quantity - current
+	}
+	after := current + delta
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE components SET stock_quantity = ? WHERE merchant_id = ? AND component_id = ?
+	`, after, merchantID, componentID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO stock_movements (merchant_id, component_id, movement_type, quantity, stock_after,
+		                             order_id, order_item_id, user_id, comment, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())
+	`, merchantID, componentID, movementType, delta, after,
+		nullIfEmpty(ref.OrderID), nullIfEmpty(ref.OrderItemID), nullIfEmpty(ref.UserID), nullIfEmpty(ref.Comment)); err != nil {
+		return fmt.Errorf("stock movement insert error: %w", err)
+	}
+	return nil
+}
+
+// inStockTx runs fn, which returns the components it touched, then applies the safety stock
+// to them. The menu is bumped only when an availability changed.
+func (r *StockRepository) inStockTx(ctx context.Context, merchantID string, disableUnderSafety bool, fn func(tx *sql.Tx) ([]string, error)) (*models.StockUpdate, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := markStockEnabled(ctx, tx, merchantID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	touched, err := fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	update := &models.StockUpdate{Components: []models.StockComponent{}, Availability: []models.AvailabilityChange{}}
+	if disableUnderSafety && len(touched) > 0 {
+		update.Availability, err = applySafetyStock(ctx, tx, merchantID, touched)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if len(update.Availability) > 0 {
+			if err := bumpLastMenuUpdate(ctx, tx, merchantID); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range touched {
+		c, err := r.GetComponent(ctx, merchantID, id)
+		if err != nil {
+			return nil, err
+		}
+		update.Components = append(update.Components, *c)
+	}
+	return update, nil
+}
+
+// markStockEnabled sets merchant.stock_enabled_at on the first stock operation of the merchant,
+// the row is only locked that once
+func markStockEnabled(ctx context.Context, tx *sql.Tx, merchantID string) error {
+	var enabledAt sql.NullTime
+	if err := tx.QueryRowContext(ctx, `SELECT stock_enabled_at FROM merchant WHERE id = ?`, merchantID).Scan(&enabledAt); err != nil {
+		return err
+	}
+	if enabledAt.Valid {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+		UPDATE merchant SET stock_enabled_at = UTC_TIMESTAMP() WHERE id = ? AND stock_enabled_at IS NULL
+	`, merchantID)
+	return err
+}
+
+// PendingConsumptions : orders created since the merchant manages stock whose produced units
+// (every unit once DONE / CLOSED) are not all out of the stock yet, i.e. a consumption that
+// failed after the production / state change was committed. ConsumeOrder catches them up.
+func (r *StockRepository) PendingConsumptions(ctx context.Context, merchantID string, limit int) ([]models.PendingStockConsumption, error) {
+	r.log.Info("PendingConsumptions START", zap.String("merchant_id", merchantID))
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT o.order_id, o.state, o.creation_date,
+		       SUM(GREATEST(
+		           IF(o.state IN ('DONE', 'CLOSED'), oi.quantity, LEAST(COALESCE(oi.production_status_done_quantity, 0), oi.quantity))
+		           - oi.stock_consumed_quantity, 0)) AS units
+		FROM orders o
+		INNER JOIN merchant m ON m.id = o.merchant_id AND m.stock_enabled_at IS NOT NULL
+		INNER JOIN orderitems oi ON oi.order_id = o.order_id
+		WHERE o.merchant_id = ? AND o.creation_date >= m.stock_enabled_at
+		  AND o.state NOT IN ('CANCELED', 'DELETED')
+		GROUP BY o.order_id, o.state, o.creation_date
+		HAVING units > 0
+		ORDER BY o.creation_date
+		LIMIT ?`, merchantID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("pending consumptions query error: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.PendingStockConsumption{}
+	for rows.Next() {
+		var p models.PendingStockConsumption
+		var state sql.NullString
+		if err := rows.Scan(&p.OrderID, &state, &p.CreationDate, &p.Units); err != nil {
+			return nil, err
+		}
+		p.State = state.String
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// applySafetyStock : the available components at or under their safety stock go out (SAFETY_STOCK),
+// the ones it took out come back once above it. Returns the non-empty changes, out first.
+func applySafetyStock(ctx context.Context, tx *sql.Tx, merchantID string, componentIDs []string) ([]models.AvailabilityChange, error) {
+	args := []interface{}{merchantID}
+	for _, id := range componentIDs {
+		args = append(args, id)
+	}
+	in := ` AND component_id IN (` + placeholders(len(componentIDs)) + `)`
+
+	changes := []models.AvailabilityChange{}
+	for _, available := range []bool{false, true} {
+		q := `
+			SELECT component_id FROM components
+			WHERE merchant_id = ?` + in + ` AND status = 1
+			AND safety_stock IS NOT NULL AND stock_quantity <= safety_stock
+			ORDER BY component_id`
+		if available {
+			q = `
+				SELECT component_id FROM components
+				WHERE merchant_id = ?` + in + ` AND status = 0 AND unavailable_reason = '` + unavailableSafetyStock + `'
+				AND (safety_stock IS NULL OR stock_quantity > safety_stock)
+				ORDER BY component_id`
+		}
+
+		rows, err := tx.QueryContext(ctx, q, args...)
+		if err != nil {
+			return nil, fmt.Errorf("safety stock query error: %w", err)
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		merged := models.AvailabilityChange{Available: available, ProductIDs: []string{}, ComponentIDs: []string{}}
+		for _, id := range ids {
+			change, err := setComponentAvailability(ctx, tx, merchantID, id, available, unavailableSafetyStock)
+			if err != nil {
+				return nil, err
+			}
+			merged.ProductIDs = append(merged.ProductIDs, change.ProductIDs...)
+			merged.ComponentIDs = append(merged.ComponentIDs, change.ComponentIDs...)
+		}
+		if len(merged.ComponentIDs) > 0 {
+			changes = append(changes, merged)
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/units"
+
+	"go.uber.org/zap"
+)
+
+// ListUnits : every unit of measure the recipes can use, labelled in lang
+// (French when it has no translation)
+func (r *MenuRepository) ListUnits(ctx context.Context, lang string) ([]models.UnitOfMeasure, error) {
+	r.log.Info("ListUnits START", zap.String("lang", lang))
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT uomd.id, COALESCE(uoml.uom_desc, uomd.uom_desc), uc.code
+		FROM unit_of_measure_desc uomd
+		LEFT JOIN unit_of_measure_desc uoml ON uoml.id = uomd.id AND uoml.lang = ?
+		LEFT JOIN unit_of_measure_code uc ON uc.id = uomd.id
+		WHERE uomd.lang = 'FR'
+		ORDER BY uomd.id`, lang)
+	if err != nil {
+		return nil, fmt.Errorf("units query error: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.UnitOfMeasure{}
+	for rows.Next() {
+		var u models.UnitOfMeasure
+		var code sql.NullString
+		if err := rows.Scan(&u.ID, &u.Label, &code); err != nil {
+			return nil, err
+		}
+		if unit, err := units.Lookup(code.String); err == nil {
+			u.Code = &unit.Code
+			dimension := string(unit.Dimension)
+			u.Dimension = &dimension
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
@@ -3,135 +3,100 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"time"
 	"welloresto-api/internal/models"
+	"welloresto-api/internal/reqctx"
 )
 
 type UserRepository struct {
-	db *sql.DB
+	db           *sql.DB
+	sessionTTL   time.Duration
+	legacyTokens bool // accept users_rights.token / users.token as well
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *sql.DB, sessionTTL time.Duration, legacyTokens bool) *UserRepository {
+	return &UserRepository{db: db, sessionTTL: sessionTTL, legacyTokens: legacyTokens}
 }
 
-func (r *UserRepository) Login(ctx context.Context, username, encryptedPwd, plainPwd, token string) (*models.UserLoginRow, error) {
-	query := `
-SELECT
-    u.user_id,
-    u.name,
-    u.first_name,
-    u.last_name,
-    u.email,
-    u.tel,
-    u.enabled,
-    u.pin_code,
-    u.profile_picture,
-    u.reception_device_token,
-    u.waiter_device_token,
-    u.delivery_device_token,
-
-    ur.token AS rights_token,
-    ur.access_wrreception,
-    ur.access_wrdelivery,
-    ur.access_wrwaiter,
-    ur.print_merchant_cash_report,
-    ur.open_cash_drawer,
-    ur.merchant_id,
-
-    m.fullName,
-    m.merchantTel,
-    m.lat,
-    m.lng,
-    m.timezone,
-    CONCAT(m.street_number,' ',m.street,', ',m.zip_code,' ',m.city,', ',m.country),
-    m.logo,
-    m.web_site,
-
-    mp.delivery_fees,
-    mp.delivery_fees_limit,
-    mp.delivery_distance_limit,
-    mp.manage_on_site,
-    mp.manage_take_away,
-    mp.manage_delivery,
-    mp.kitchen_show_only_paid,
-    mp.service_required_for_ordering,
-    mp.warning_new_order_not_paid,
-    mp.disable_components_under_safety_stock,
-    mp.currency,
-    mp.is_open,
-
-    p.allow_waiter_account,
-    p.allow_delivery_account,
-    p.scannorder_ready,
-    p.stock_management,
-    p.hr_management,
-
-    sset.activated,
-
-    iue.store_id,
-    iue.estimated_preparation_time,
-    iue.delay_until,
-    iue.delay_duration,
-    iue.closed_until,
-
-    iud.customer_id,
-
-    ind.location_id
-
-FROM users u
-INNER JOIN users_rights ur ON ur.id = u.access_id
-INNER JOIN merchant m ON m.id = ur.merchant_id
-LEFT JOIN merchant_parameters mp ON mp.merchant_id = m.id
-LEFT JOIN subscriptions s ON s.merchant_id = m.id
-LEFT JOIN packages p ON p.id = s.package_id
-LEFT JOIN scannorder_settings sset ON sset.merchant_id = m.id
-LEFT JOIN integration_uber_eats iue ON iue.merchant_id = m.id AND iue.bearer_token IS NOT NULL
-LEFT JOIN integration_uber_direct iud ON iud.merchant_id = m.id AND iud.bearer_token IS NOT NULL
-LEFT JOIN integration_deliveroo ind ON ind.merchant_id = m.id
+// Login : legacy token login (ur.token), password logins go through GetCredentials + GetUserByID
+func (r *UserRepository) Login(ctx context.Context, token string) (*models.UserLoginRow, error) {
+	if token == "" || !r.legacyTokens {
+		return nil, nil
+	}
 
-WHERE 
-    (
-        (UPPER(u.name)=UPPER(?) AND u.password IN (?, ?))
-        OR (ur.token = ?)
-    )
+	query := userLoginSelect + `
+WHERE ur.token = ?
 LIMIT 1;
 `
 
-	row := r.db.QueryRowContext(ctx, query,
-		username, encryptedPwd, plainPwd,
-		token,
-	)
+	row := r.db.QueryRowContext(ctx, query, token)
 
-	data := &models.UserLoginRow{}
+	data, err := scanUserLoginRow(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return data, err
+}
 
-	err := row.Scan(
-		&data.UserID, &data.Name, &data.FirstName, &data.LastName, &data.Email, &data.Tel,
-		&data.Enabled, &data.PinCode, &data.ProfilePicture,
-		&data.ReceptionDeviceToken, &data.WaiterDeviceToken, &data.DeliveryDeviceToken,
+// GetCredentials returns every user with this name (names are matched case-insensitively, like the legacy login)
+func (r *UserRepository) GetCredentials(ctx context.Context, username string) ([]models.UserCredentials, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT user_id, password, password_hash, password_algo
+FROM users
+WHERE UPPER(name) = UPPER(?)
+`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		&data.RightsToken, &data.AccessReception, &data.AccessDelivery, &data.AccessWaiter,
-		&data.PrintMerchantCashReport, &data.OpenCashDrawer, &data.MerchantID,
+	var list []models.UserCredentials
+	for rows.Next() {
+		var c models.UserCredentials
+		if err := rows.Scan(&c.UserID, &c.LegacyPassword, &c.PasswordHash, &c.PasswordAlgo); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
 
-		&data.MerchantName, &data.MerchantTel, &data.MerchantLat, &data.MerchantLng, &data.TimeZone,
-		&data.MerchantAddress, &data.MerchantLogo, &data.WebSite,
+// UpdatePasswordHash stores the new hash. clearLegacy empties the legacy (AES / plain) password,
+// which must be kept as long as the PHP backend logs in with it.
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, userID, hash, algo string, clearLegacy bool) error {
+	_, err := r.db.ExecContext(ctx, `
+UPDATE users SET password_hash = ?, password_algo = ?,
+    password = IF(?, '', password)
+WHERE user_id = ?
+`, hash, algo, clearLegacy, userID)
+	return err
+}
 
-		&data.DeliveryFees, &data.DeliveryFeesLimit, &data.DeliveryDistanceLimit,
-		&data.ManageOnSite, &data.ManageTakeAway, &data.ManageDelivery,
-		&data.KitchenShowOnlyPaid, &data.ServiceRequiredForOrdering,
-		&data.WarningNewOrderNotPaid, &data.DisableSafetyStock,
-		&data.Currency, &data.IsOpen,
+func (r *UserRepository) GetUserByID(ctx context.Context, userID string) (*models.UserLoginRow, error) {
+	query := userLoginSelect + `
+WHERE u.user_id = ?
+LIMIT 1;
+`
 
-		&data.AllowWaiterAccount, &data.AllowDeliveryAccount,
-		&data.ScanNOrderReady, &data.StockManagement, &data.HrManagement,
+	row := r.db.QueryRowContext(ctx, query, userID)
 
-		&data.SNOActivated,
+	data, err := scanUserLoginRow(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return data, err
+}
 
-		&data.UEStoreID, &data.UEPrepTime, &data.UEDelayUntil, &data.UEDelayDuration, &data.UEClosedUntil,
+// GetUserForMerchant loads the user with their rights on merchantID, nil when they have none there
+func (r *UserRepository) GetUserForMerchant(ctx context.Context, userID, merchantID string) (*models.UserLoginRow, error) {
+	query := userMerchantSelect + `
+WHERE u.user_id = ? AND ur.merchant_id = ?
+LIMIT 1;
+`
 
-		&data.UDCustomerID,
-		&data.DrooLocationID,
-	)
+	row := r.db.QueryRowContext(ctx, query, userID, merchantID)
 
+	data, err := scanUserLoginRow(row)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -169,12 +134,51 @@ WHERE ur.user_id IS NOT NULL AND ur.user_id = ?
 	return list, nil
 }
 
+// GetUserByToken resolves a session token (auth_tokens), then the legacy shared tokens if still allowed
 func (r *UserRepository) GetUserByToken(ctx context.Context, token string) (*models.UserLoginRow, error) {
 	if token == "" {
 		return nil, nil
 	}
 
-	query := `
+	// déjà résolu par middleware.Authenticate pour cette requête
+	if user := reqctx.User(ctx, token); user != nil {
+		return user, nil
+	}
+
+	data, err := r.GetUserBySessionToken(ctx, token)
+	if err != nil || data != nil {
+		return data, err
+	}
+	if !r.legacyTokens {
+		return nil, sql.ErrNoRows
+	}
+
+	query := userLoginSelect + `
+WHERE ur.token = ? OR u.token = ?
+LIMIT 1;
+`
+
+	row := r.db.QueryRowContext(ctx, query, token, token)
+
+	data, err = scanUserLoginRow(row)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return data, err
+}
+
+// userLoginSelect : user + rights + merchant + parameters, shared by every user lookup.
+// The rights row is the user's home one (users.access_id).
+const userLoginSelect = userLoginColumns + `
+FROM users u
+INNER JOIN users_rights ur ON ur.id = u.access_id` + userMerchantJoins
+
+// userMerchantSelect : same row, but on any rights row of the user (one per merchant, see GetMerchants)
+const userMerchantSelect = userLoginColumns + `
+FROM users u
+INNER JOIN users_rights ur ON ur.user_id = u.user_id` + userMerchantJoins
+
+const userLoginColumns = `
 SELECT
     u.user_id,
     u.name,
@@ -195,6 +199,11 @@ SELECT
     ur.access_wrwaiter,
     ur.print_merchant_cash_report,
     ur.open_cash_drawer,
+    ur.reopen_order,
+    ur.manage_users,
+    ur.refund_payment,
+    ur.edit_floor_plan,
+    ur.edit_menu,
     ur.merchant_id,
 
     m.fullName,
@@ -236,9 +245,9 @@ SELECT
     iud.customer_id,
 
     ind.location_id
+`
 
-FROM users u
-INNER JOIN users_rights ur ON ur.id = u.access_id
+const userMerchantJoins = `
 INNER JOIN merchant m ON m.id = ur.merchant_id
 LEFT JOIN merchant_parameters mp ON mp.merchant_id = m.id
 LEFT JOIN subscriptions s ON s.merchant_id = m.id
@@ -247,13 +256,9 @@ LEFT JOIN scannorder_settings sset ON sset.merchant_id = m.id
 LEFT JOIN integration_uber_eats iue ON iue.merchant_id = m.id AND iue.bearer_token IS NOT NULL
 LEFT JOIN integration_uber_direct iud ON iud.merchant_id = m.id AND iud.bearer_token IS NOT NULL
 LEFT JOIN integration_deliveroo ind ON ind.merchant_id = m.id
-
-WHERE ur.token = ? OR u.token = ?
-LIMIT 1;
 `
 
-	row := r.db.QueryRowContext(ctx, query, token, token)
-
+func scanUserLoginRow(row *sql.Row) (*models.UserLoginRow, error) {
 	data := &models.UserLoginRow{}
 
 	err := row.Scan(
@@ -262,7 +267,7 @@ LIMIT 1;
 		&data.ReceptionDeviceToken, &data.WaiterDeviceToken, &data.DeliveryDeviceToken,
 
 		&data.RightsToken, &data.AccessReception, &data.AccessDelivery, &data.AccessWaiter,
-		&data.PrintMerchantCashReport, &data.OpenCashDrawer, &data.MerchantID,
+		&data.PrintMerchantCashReport, &data.OpenCashDrawer, &data.ReopenOrder, &data.ManageUsers, &data.RefundPayment, &data.EditFloorPlan, &data.EditMenu, &data.MerchantID,
 
 		&data.MerchantName, &data.MerchantTel, &data.MerchantLat, &data.MerchantLng, &data.TimeZone,
 		&data.MerchantAddress, &data.MerchantLogo, &data.WebSite,
@@ -284,8 +289,5 @@ LIMIT 1;
 		&data.DrooLocationID,
 	)
 
-	if err == sql.ErrNoRows {
-		return nil, err
-	}
 	return data, err
 }
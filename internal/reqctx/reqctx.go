@@ -0,0 +1,41 @@
+// Package reqctx holds what the middlewares resolve once per request (token, user), so that
+// the services and repositories can read it without depending on the HTTP middlewares.
+package reqctx
+
+import (
+	"context"
+	"welloresto-api/internal/models"
+)
+
+type ctxKey string
+
+const (
+	tokenKey ctxKey = "authToken"
+	userKey  ctxKey = "authUser"
+)
+
+// WithToken : token of the request (Authorization or ?token=), "" when none
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey, token)
+}
+
+// Token : token stored by WithToken, "" when none
+func Token(ctx context.Context) string {
+	token, _ := ctx.Value(tokenKey).(string)
+	return token
+}
+
+// WithUser : user the token of the request resolved to
+func WithUser(ctx context.Context, user *models.UserLoginRow) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// User returns the user resolved for this request if it was resolved for this token,
+// so that GetUserByToken(token) doesn't hit the DB a second time
+func User(ctx context.Context, token string) *models.UserLoginRow {
+	user, ok := ctx.Value(userKey).(*models.UserLoginRow)
+	if !ok || token == "" || Token(ctx) != token {
+		return nil
+	}
+	return user
+}
@@ -4,17 +4,26 @@ import (
 	"bytes"
 	"context"
 	"crypto/aes"
+	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
+	"welloresto-api/internal/models"
 	"welloresto-api/internal/repositories"
 )
 
 type AuthService struct {
-	repo *repositories.UserRepository
+	repo          *repositories.UserRepository
+	pinSessionTTL time.Duration
+	// legacyPasswords : users.password (AES / plain) is still written by the PHP backend, see config.LegacyPasswords
+	legacyPasswords bool
+	pinLimiter    *pinLimiter // per merchant + session user
+	pinMerchant   *pinLimiter // per merchant, every session together
 }
 
-func NewAuthService(r *repositories.UserRepository) *AuthService {
-	return &AuthService{repo: r}
+func NewAuthService(r *repositories.UserRepository, pinSessionTTL time.Duration, legacyPasswords bool) *AuthService {
+	return &AuthService{repo: r, pinSessionTTL: pinSessionTTL, legacyPasswords: legacyPasswords, pinLimiter: newPinLimiter(pinMaxFailures), pinMerchant: newPinLimiter(pinMerchantMaxFailures)}
 }
 
 // Fonction utilitaire pour ajouter le padding (PKCS#7)
@@ -24,11 +33,14 @@ func pkcs7Padding(ciphertext []byte, blockSize int) []byte {
 	return append(ciphertext, padtext...)
 }
 
+// phpPasswordKey : AES-128 key of users.password on the PHP side
+var phpPasswordKey = []byte("oBo9mPqMfJ2Ni4Ma")
+
 func encryptPHP(password string) (string, error) {
 	// CORRECTION 1 : Utiliser la clé directement si elle fait 16 chars (AES-128)
     // Si votre clé PHP est vraiment du base64, gardez le DecodeString, 
     // mais assurez-vous que le résultat décodé fasse 16, 24 ou 32 octets.
-	key := []byte("oBo9mPqMfJ2Ni4Ma") 
+	key := phpPasswordKey
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -66,20 +78,56 @@ func convertApp(app string) (int, error) {
 	}
 }
 
+// passwordLogin checks the password of every user with this name, and moves a legacy
+// (AES / plain) or outdated hash to argon2id once the password is known to be right.
+// Without legacyPasswords the legacy column is emptied at the same time.
+func (s *AuthService) passwordLogin(ctx context.Context, username, password string) (*models.UserLoginRow, error) {
+	creds, err := s.repo.GetCredentials(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range creds {
+		ok, rehash, err := verifyPassword(password, c, s.legacyPasswords)
+		if err != nil || !ok {
+			// un hash illisible ne doit pas bloquer un homonyme
+			continue
+		}
+
+		if rehash {
+			if hash, err := hashPassword(password); err == nil {
+				// best effort : the login is valid either way, next login will retry
+				_ = s.repo.UpdatePasswordHash(ctx, c.UserID, hash, PasswordAlgoArgon2id, !s.legacyPasswords)
+			}
+		}
+		return s.repo.GetUserByID(ctx, c.UserID)
+	}
+	return nil, nil
+}
+
 func (s *AuthService) Login(ctx context.Context, app string, deviceID string, username string, password string, token string) (map[string]interface{}, error) {
 
 	appID, _ := convertApp(app)
 
-	var encrypted string
+	var user *models.UserLoginRow
 	var err error
+	sessionToken := "" // set when the request already carries a valid session token
 
 	if username != "" && password != "" {
-		encrypted, err = encryptPHP(password)
+		user, err = s.passwordLogin(ctx, username, password)
+		if err != nil { return nil, err }
+	}
+	if user == nil && token != "" {
+		user, err = s.repo.GetUserBySessionToken(ctx, token)
+		if err != nil { return nil, err }
+		if user != nil {
+			sessionToken = token
+		}
+	}
+	if user == nil && token != "" {
+		user, err = s.repo.Login(ctx, token)
 		if err != nil { return nil, err }
 	}
-
-	user, err := s.repo.Login(ctx, username, encrypted, password, token)
-	if err != nil { return nil, err }
 	if user == nil {
 		return map[string]interface{}{
 			"status": "0",
@@ -118,9 +166,23 @@ func (s *AuthService) Login(ctx context.Context, app string, deviceID string, us
 		}
 	}
 
+	// Session token per user / device (the shared rights token is never handed out anymore)
+	var expiresAt interface{}
+	if sessionToken == "" {
+		var exp time.Time
+		sessionToken, exp, err = s.repo.CreateSession(ctx, user.UserID, deviceID, app)
+		if err != nil { return nil, err }
+		expiresAt = exp
+	}
+
 	// MULTI-MERCHANT
 	merchants, _ := s.repo.GetMerchants(ctx, user.UserID)
 
+	return loginPayload(user, sessionToken, expiresAt, merchants), nil
+}
+
+// loginPayload : login response, also returned when the session switches merchant
+func loginPayload(user *models.UserLoginRow, sessionToken string, expiresAt interface{}, merchants []models.MerchantRow) map[string]interface{} {
 	// JSON EXACT
 	return map[string]interface{}{
 		"status": "1",
@@ -174,11 +236,225 @@ func (s *AuthService) Login(ctx context.Context, app string, deviceID string, us
 
 		"currency": user.Currency,
 		"is_open": user.IsOpen,
-		"pin_code": user.PinCode.String,
 		"web_site": user.WebSite.String,
-		"token": user.RightsToken,
+		"token": sessionToken,
+		"token_expires_at": expiresAt,
 		"profile_picture": user.ProfilePicture.String,
 
 		"merchants": merchants,
+	}
+}
+
+// SwitchMerchant selects the merchant the session token works on, among the user's
+// merchants (GetMerchants); "" goes back to the home merchant. Legacy shared tokens can't
+// be switched, those clients send X-Merchant-Id on each request instead.
+func (s *AuthService) SwitchMerchant(ctx context.Context, token, merchantID string) (map[string]interface{}, error) {
+	user, err := s.repo.GetUserByToken(ctx, token)
+	if err != nil || user == nil {
+		return nil, errors.New("invalid token")
+	}
+	if _, err := s.repo.GetSessionMerchant(ctx, token); err != nil {
+		return nil, errors.New("not a session token, use the X-Merchant-Id header")
+	}
+
+	var selected *models.UserLoginRow
+	if merchantID == "" {
+		selected, err = s.repo.GetUserByID(ctx, user.UserID)
+	} else {
+		selected, err = s.repo.GetUserForMerchant(ctx, user.UserID, merchantID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if selected == nil || !selected.Enabled {
+		return nil, ErrNotAllowed
+	}
+
+	if err := s.repo.SetSessionMerchant(ctx, token, merchantID); err != nil {
+		return nil, err
+	}
+
+	merchants, _ := s.repo.GetMerchants(ctx, user.UserID)
+	return loginPayload(selected, token, nil, merchants), nil
+}
+
+// ErrNotAllowed : the user lacks the right needed for the operation
+var ErrNotAllowed = errors.New("not_allowed")
+
+// Logout revokes the session token of the request
+func (s *AuthService) Logout(ctx context.Context, token string) error {
+	if token == "" {
+		return errors.New("invalid token")
+	}
+	revoked, err := s.repo.RevokeSession(ctx, token)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// ErrNotRefreshable : PIN sessions are short-lived on purpose, they are not turned into full sessions
+var ErrNotRefreshable = errors.New("session can't be refreshed")
+
+// Refresh swaps a valid session token for a new one (same device), the old one is revoked.
+// Only sliding sessions: a PIN session ends with its TTL (ErrNotRefreshable).
+func (s *AuthService) Refresh(ctx context.Context, token string) (string, time.Time, error) {
+	user, err := s.repo.GetUserBySessionToken(ctx, token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if user == nil {
+		return "", time.Time{}, errors.New("invalid token")
+	}
+
+	deviceID, app, sliding, err := s.repo.GetSessionDevice(ctx, token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if !sliding {
+		return "", time.Time{}, ErrNotRefreshable
+	}
+	merchantID, err := s.repo.GetSessionMerchant(ctx, token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	newToken, expiresAt, err := s.repo.CreateSession(ctx, user.UserID, deviceID, app)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	// le merchant sélectionné suit le nouveau token
+	if merchantID != "" {
+		if err := s.repo.SetSessionMerchant(ctx, newToken, merchantID); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	// sans device_id, CreateSession ne révoque rien : on le fait ici
+	if _, err := s.repo.RevokeSession(ctx, token); err != nil {
+		return "", time.Time{}, err
+	}
+	return newToken, expiresAt, nil
+}
+
+// RevokeUserSessions logs a user out of every device. Users can do it for themselves,
+// for someone else it takes the manage_users right on the same merchant.
+func (s *AuthService) RevokeUserSessions(ctx context.Context, token, userID string) (int64, error) {
+	user, err := s.repo.GetUserByToken(ctx, token)
+	if err != nil || user == nil {
+		return 0, errors.New("invalid token")
+	}
+
+	if userID != user.UserID {
+		if !user.ManageUsers {
+			return 0, ErrNotAllowed
+		}
+		same, err := s.repo.UserBelongsToMerchant(ctx, userID, user.MerchantID)
+		if err != nil {
+			return 0, err
+		}
+		if !same {
+			return 0, ErrNotAllowed
+		}
+	}
+
+	return s.repo.RevokeUserSessions(ctx, userID)
+}
+
+var (
+	// ErrInvalidPin : unknown PIN for this merchant (counts toward the lockout)
+	ErrInvalidPin = errors.New("invalid pin")
+	// ErrPinAmbiguous : several staff members share this PIN, it can't identify anyone
+	ErrPinAmbiguous = errors.New("pin shared by several users")
+	// ErrPinLocked : too many wrong PINs from this user's sessions, or on the merchant
+	ErrPinLocked = errors.New("too many attempts, pin login locked")
+)
+
+// PinLogin switches to another staff member of the same merchant on an already logged-in
+// device. The PIN is checked server side and the returned token is short-lived.
+func (s *AuthService) PinLogin(ctx context.Context, token, deviceID, pin string) (map[string]interface{}, error) {
+	device, err := s.repo.GetUserByToken(ctx, token)
+	if err != nil || device == nil {
+		return nil, errors.New("invalid token")
+	}
+	if deviceID == "" || pin == "" {
+		return nil, ErrInvalidPin
+	}
+
+	// une session liée à un device ne sert que depuis ce device (les tokens legacy n'en ont pas)
+	sessionDevice, _, _, err := s.repo.GetSessionDevice(ctx, token)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if sessionDevice != "" && sessionDevice != deviceID {
+		return nil, ErrNotAllowed
+	}
+
+	// compteurs sur ce que l'appelant ne choisit pas : l'utilisateur de la session et le merchant
+	userKey := device.MerchantID + "|" + device.UserID
+	merchantKey := device.MerchantID
+	now := time.Now()
+	for _, l := range []struct {
+		limiter *pinLimiter
+		key     string
+	}{{s.pinLimiter, userKey}, {s.pinMerchant, merchantKey}} {
+		if until := l.limiter.lockedUntil(l.key, now); !until.IsZero() {
+			return nil, fmt.Errorf("%w until %s", ErrPinLocked, until.UTC().Format(time.RFC3339))
+		}
+	}
+
+	ids, err := s.repo.FindStaffByPin(ctx, device.MerchantID, pin)
+	if err != nil {
+		return nil, err
+	}
+	switch len(ids) {
+	case 0:
+		until := s.pinLimiter.fail(userKey, now)
+		if merchantUntil := s.pinMerchant.fail(merchantKey, now); merchantUntil.After(until) {
+			until = merchantUntil
+		}
+		if !until.IsZero() {
+			return nil, fmt.Errorf("%w until %s", ErrPinLocked, until.UTC().Format(time.RFC3339))
+		}
+		return nil, ErrInvalidPin
+	case 1:
+	default:
+		return nil, ErrPinAmbiguous
+	}
+	// le compteur du merchant n'est pas remis à zéro : un bon PIN ne doit pas en couvrir d'autres
+	s.pinLimiter.reset(userKey)
+
+	staff, err := s.repo.GetUserByID(ctx, ids[0])
+	if err != nil {
+		return nil, err
+	}
+	if staff == nil {
+		return nil, ErrInvalidPin
+	}
+
+	staffToken, expiresAt, err := s.repo.CreatePinSession(ctx, staff.UserID, deviceID, s.pinSessionTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"status":           "1",
+		"token":            staffToken,
+		"token_expires_at": expiresAt,
+
+		"userId":          staff.UserID,
+		"name":            staff.Name,
+		"first_name":      staff.FirstName,
+		"last_name":       staff.LastName,
+		"profile_picture": staff.ProfilePicture.String,
+
+		"access_wrreception":         staff.AccessReception,
+		"access_wrdelivery":          staff.AccessDelivery,
+		"access_wrwaiter":            staff.AccessWaiter,
+		"print_merchant_cash_report": staff.PrintMerchantCashReport,
+		"open_cash_drawer":           staff.OpenCashDrawer,
+		"reopen_order":               staff.ReopenOrder,
 	}, nil
 }
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/repositories"
+
+	"go.uber.org/zap"
+)
+
+const (
+	availabilitySyncInterval = 15 * time.Second
+	availabilitySyncBatch    = 50
+	// an 86 lasts until the product comes back (which lifts the suspension), the platform
+	// needs an end date anyway
+	uberEatsSuspension = 30 * 24 * time.Hour
+)
+
+// AvailabilitySync pushes the 86 changes (integration_availability_outbox) to the delivery
+// platforms, Uber Eats only (Deliveroo is out of scope, see queueAvailabilitySync).
+// In-process like the events bus: a change queued while the API is down waits for the next run.
+type AvailabilitySync struct {
+	outbox      *repositories.AvailabilityOutboxRepository
+	uberEatsURL string
+	client      *http.Client
+	log         *zap.Logger
+}
+
+func NewAvailabilitySync(outbox *repositories.AvailabilityOutboxRepository, uberEatsURL string, log *zap.Logger) *AvailabilitySync {
+	return &AvailabilitySync{
+		outbox:      outbox,
+		uberEatsURL: uberEatsURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		log:         log,
+	}
+}
+
+// Run drains the outbox every availabilitySyncInterval until ctx is done
+func (s *AvailabilitySync) Run(ctx context.Context) {
+	ticker := time.NewTicker(availabilitySyncInterval)
+	defer ticker.Stop()
+	for {
+		s.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *AvailabilitySync) drain(ctx context.Context) {
+	pending, err := s.outbox.PendingAvailability(ctx, availabilitySyncBatch)
+	if err != nil {
+		s.log.Error("availability sync: outbox read failed", zap.Error(err))
+		return
+	}
+	for _, item := range pending {
+		if err := s.pushUberEats(ctx, item); err != nil {
+			s.log.Warn("availability sync: push failed",
+				zap.String("merchant_id", item.MerchantID), zap.String("item_id", item.ItemID), zap.Error(err))
+			if err := s.outbox.MarkAvailabilityFailed(ctx, item.ID, err.Error()); err != nil {
+				s.log.Error("availability sync: outbox update failed", zap.Int64("id", item.ID), zap.Error(err))
+			}
+			continue
+		}
+		if err := s.outbox.MarkAvailabilitySent(ctx, item); err != nil {
+			s.log.Error("availability sync: outbox update failed", zap.Int64("id", item.ID), zap.Error(err))
+		}
+	}
+}
+
+// pushUberEats : Uber Eats menu API, item suspension (suspend_until 0 lifts it)
+func (s *AvailabilitySync) pushUberEats(ctx context.Context, item models.AvailabilitySync) error {
+	suspendUntil := int64(0)
+	if !item.Available {
+		suspendUntil = time.Now().Add(uberEatsSuspension).Unix()
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"suspension_info": map[string]interface{}{
+			"suspension": map[string]interface{}{
+				"suspend_until": suspendUntil,
+				"reason":        "out of stock",
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/v2/eats/stores/%s/menus/items/%s",
+		s.uberEatsURL, url.PathEscape(item.StoreID), url.PathEscape(item.ExternalItemID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+item.BearerToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("uber eats: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
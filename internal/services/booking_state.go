@@ -0,0 +1,51 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BookingStatus is the lifecycle status stored in bookings.status
+type BookingStatus string
+
+const (
+	BookingPending  BookingStatus = "PENDING"
+	BookingAccepted BookingStatus = "ACCEPTED"
+	BookingRejected BookingStatus = "REJECTED"
+	BookingCanceled BookingStatus = "CANCELED"
+	BookingNoShow   BookingStatus = "NO_SHOW"
+)
+
+var (
+	ErrInvalidBookingStatus     = errors.New("invalid booking status")
+	ErrIllegalBookingTransition = errors.New("illegal booking status transition")
+)
+
+// bookingTransitions : a request is accepted or rejected, an accepted booking is canceled or a no-show
+var bookingTransitions = map[BookingStatus][]BookingStatus{
+	BookingPending:  {BookingAccepted, BookingRejected, BookingCanceled},
+	BookingAccepted: {BookingCanceled, BookingNoShow},
+	BookingRejected: {},
+	BookingCanceled: {},
+	BookingNoShow:   {},
+}
+
+// ParseBookingStatus normalizes a client value ("accepted", " NO_SHOW ") into a known status
+func ParseBookingStatus(s string) (BookingStatus, error) {
+	st := BookingStatus(strings.ToUpper(strings.TrimSpace(s)))
+	if _, ok := bookingTransitions[st]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidBookingStatus, s)
+	}
+	return st, nil
+}
+
+// CheckTransition returns nil when the booking can move from -> to
+func (from BookingStatus) CheckTransition(to BookingStatus) error {
+	for _, allowed := range bookingTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrIllegalBookingTransition, from, to)
+}
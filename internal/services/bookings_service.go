@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/repositories"
+)
+
+var (
+	// ErrInvalidBooking : missing customer, party size or dates, unknown table
+	ErrInvalidBooking = errors.New("invalid booking")
+	// ErrBookingConflict : table already held, not enough seats, status changed concurrently
+	ErrBookingConflict = errors.New("booking conflict")
+)
+
+// defaultBookingDuration : when neither booking_date_to nor booking_duration is given
+const defaultBookingDuration = 2 * time.Hour
+
+type BookingsService struct {
+	bookingsRepo *repositories.BookingsRepository
+	userRepo     *repositories.UserRepository // used to resolve token -> merchant id
+}
+
+func NewBookingsService(bookingsRepo *repositories.BookingsRepository, userRepo *repositories.UserRepository) *BookingsService {
+	return &BookingsService{
+		bookingsRepo: bookingsRepo,
+		userRepo:     userRepo,
+	}
+}
+
+func (s *BookingsService) bookingUser(ctx context.Context, token string) (*models.UserLoginRow, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+	return user, nil
+}
+
+// ListBookings : day is YYYY-MM-DD in the merchant time zone (today by default)
+func (s *BookingsService) ListBookings(ctx context.Context, token, day string, statuses []string) ([]models.Booking, error) {
+	user, err := s.bookingUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := merchantLocation(user)
+	if day == "" {
+		day = time.Now().In(loc).Format("2006-01-02")
+	}
+	start, err := time.ParseInLocation("2006-01-02", day, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid day", ErrInvalidBooking)
+	}
+
+	for i, st := range statuses {
+		parsed, err := ParseBookingStatus(st)
+		if err != nil {
+			return nil, err
+		}
+		statuses[i] = string(parsed)
+	}
+
+	return s.bookingsRepo.ListBookings(ctx, user.MerchantID, start.UTC(), start.AddDate(0, 0, 1).UTC(), statuses)
+}
+
+func (s *BookingsService) GetBooking(ctx context.Context, token, bookingID string) (*models.Booking, error) {
+	user, err := s.bookingUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bookingsRepo.GetBooking(ctx, user.MerchantID, bookingID)
+}
+
+// GetAvailability : free tables over [from, to) and the tables to give to the party
+func (s *BookingsService) GetAvailability(ctx context.Context, token string, from, to time.Time, partySize int) (*models.BookingAvailability, error) {
+	user, err := s.bookingUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if partySize <= 0 {
+		return nil, fmt.Errorf("%w: party_size must be positive", ErrInvalidBooking)
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidBooking)
+	}
+
+	free, err := s.bookingsRepo.GetFreeLocations(ctx, user.MerchantID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	availability := &models.BookingAvailability{
+		From:       from.UTC(),
+		To:         to.UTC(),
+		PartySize:  partySize,
+		Locations:  free,
+		Suggestion: suggestTables(free, partySize),
+	}
+	for _, l := range free {
+		availability.FreeSeats += l.Seats
+	}
+	availability.Available = len(availability.Suggestion) > 0
+	if availability.Suggestion == nil {
+		availability.Suggestion = []string{}
+	}
+	return availability, nil
+}
+
+func (s *BookingsService) CreateBooking(ctx context.Context, token string, req models.CreateBookingRequest) (*models.Booking, error) {
+	user, err := s.bookingUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.CustomerID <= 0 {
+		return nil, fmt.Errorf("%w: customer_id required", ErrInvalidBooking)
+	}
+	if req.PartySize <= 0 {
+		return nil, fmt.Errorf("%w: party_size must be positive", ErrInvalidBooking)
+	}
+	if req.DateFrom.IsZero() {
+		return nil, fmt.Errorf("%w: booking_date_from required", ErrInvalidBooking)
+	}
+	from := req.DateFrom.UTC()
+	var to time.Time
+	switch {
+	case req.DateTo != nil:
+		to = req.DateTo.UTC()
+	case req.Duration > 0:
+		to = from.Add(time.Duration(req.Duration) * time.Minute)
+	default:
+		to = from.Add(defaultBookingDuration)
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: booking_date_to must be after booking_date_from", ErrInvalidBooking)
+	}
+
+	status := BookingPending
+	if req.Status != "" {
+		if status, err = ParseBookingStatus(req.Status); err != nil {
+			return nil, err
+		}
+		if status != BookingPending && status != BookingAccepted {
+			return nil, fmt.Errorf("%w: a booking starts PENDING or ACCEPTED", ErrInvalidBooking)
+		}
+	}
+	req.Status = string(status)
+	req.LocationIDs = uniqueLocationIDs(req.LocationIDs)
+
+	bookingID, err := s.bookingsRepo.CreateBooking(ctx, user.MerchantID, req, from, to, merchantLocation(user))
+	if err != nil {
+		return nil, mapBookingError(err)
+	}
+	return s.bookingsRepo.GetBooking(ctx, user.MerchantID, bookingID)
+}
+
+// ChangeStatus validates the move (accept, reject, cancel, no-show) then applies it
+func (s *BookingsService) ChangeStatus(ctx context.Context, token, bookingID, newStatus string) (*models.Booking, error) {
+	user, err := s.bookingUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := ParseBookingStatus(newStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	booking, err := s.bookingsRepo.GetBooking(ctx, user.MerchantID, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	from, err := ParseBookingStatus(booking.Status)
+	if err != nil {
+		return nil, err
+	}
+	if err := from.CheckTransition(to); err != nil {
+		return nil, err
+	}
+
+	if err := s.bookingsRepo.UpdateBookingStatus(ctx, user.MerchantID, bookingID, string(from), string(to)); err != nil {
+		return nil, mapBookingError(err)
+	}
+	return s.bookingsRepo.GetBooking(ctx, user.MerchantID, bookingID)
+}
+
+// SetLocations replaces the tables of a pending / accepted booking
+func (s *BookingsService) SetLocations(ctx context.Context, token, bookingID string, locationIDs []string) (*models.Booking, error) {
+	user, err := s.bookingUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	locationIDs = uniqueLocationIDs(locationIDs)
+	if len(locationIDs) == 0 {
+		return nil, fmt.Errorf("%w: location_ids required", ErrInvalidBooking)
+	}
+
+	if err := s.bookingsRepo.SetBookingLocations(ctx, user.MerchantID, bookingID, locationIDs); err != nil {
+		return nil, mapBookingError(err)
+	}
+	return s.bookingsRepo.GetBooking(ctx, user.MerchantID, bookingID)
+}
+
+// uniqueLocationIDs : a table listed twice is held once (booked_location has one row per table), order kept
+func uniqueLocationIDs(ids []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// suggestTables : the single smallest table that seats the party, else the biggest tables
+// until the party is seated. nil when the free tables can't seat it.
+func suggestTables(free []models.BookingLocation, partySize int) []string {
+	sorted := append([]models.BookingLocation(nil), free...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Seats < sorted[j].Seats })
+	for _, l := range sorted {
+		if l.Seats >= partySize {
+			return []string{l.LocationID}
+		}
+	}
+
+	var ids []string
+	seats := 0
+	for i := len(sorted) - 1; i >= 0 && seats < partySize; i-- {
+		ids = append(ids, sorted[i].LocationID)
+		seats += sorted[i].Seats
+	}
+	if seats < partySize {
+		return nil
+	}
+	return ids
+}
+
+func mapBookingError(err error) error {
+	switch {
+	case errors.Is(err, repositories.ErrInvalidReference):
+		return fmt.Errorf("%w: %v", ErrInvalidBooking, err)
+	case errors.Is(err, repositories.ErrTableUnavailable),
+		errors.Is(err, repositories.ErrNotEnoughSeats),
+		errors.Is(err, repositories.ErrBookingStatusConflict):
+		return fmt.Errorf("%w: %v", ErrBookingConflict, err)
+	}
+	return err
+}
@@ -3,9 +3,21 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
+	"welloresto-api/internal/models"
 	"welloresto-api/internal/repositories"
 )
 
+var (
+	// ErrCashDrawerNotAllowed : the user lacks open_cash_drawer (or print_merchant_cash_report for the Z report)
+	ErrCashDrawerNotAllowed = errors.New("not_allowed")
+	// ErrInvalidCashDrawer : invalid amount / movement type / date
+	ErrInvalidCashDrawer = errors.New("invalid cash drawer request")
+	// ErrCashDrawerConflict : no open session, or a session is already open
+	ErrCashDrawerConflict = errors.New("cash drawer conflict")
+)
+
 type CashDrawerService struct {
 	cashDrawerRepo *repositories.CashDrawerRepository
 	userRepo       *repositories.UserRepository // used to resolve token -> merchant id
@@ -19,10 +31,126 @@ func NewCashDrawerService(cashDrawerRepo *repositories.CashDrawerRepository, use
 }
 
 func (s *CashDrawerService) OpenDrawer(ctx context.Context, token string, deviceID string) error {
+	user, err := s.drawerUser(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	return s.cashDrawerRepo.OpenCashDrawer(ctx, user.MerchantID, user.UserID, deviceID)
+}
+
+func (s *CashDrawerService) GetCurrentSession(ctx context.Context, token string) (*models.CashDrawerSession, error) {
+	user, err := s.drawerUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.cashDrawerRepo.GetCurrentSession(ctx, user.MerchantID)
+	return session, mapCashDrawerError(err)
+}
+
+// OpenSession starts the day (or the shift) with the float put in the drawer
+func (s *CashDrawerService) OpenSession(ctx context.Context, token string, req models.OpenCashDrawerSessionRequest) (*models.CashDrawerSession, error) {
+	user, err := s.drawerUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.OpeningFloat < 0 {
+		return nil, fmt.Errorf("%w: negative opening_float", ErrInvalidCashDrawer)
+	}
+
+	sessionID, err := s.cashDrawerRepo.OpenSession(ctx, user.MerchantID, user.UserID, req.DeviceID, req.OpeningFloat)
+	if err != nil {
+		return nil, mapCashDrawerError(err)
+	}
+	return s.cashDrawerRepo.GetSession(ctx, user.MerchantID, sessionID)
+}
+
+// AddMovement : manual CASH_IN / CASH_OUT (change brought in, supplier paid from the drawer...)
+func (s *CashDrawerService) AddMovement(ctx context.Context, token string, req models.CashDrawerMovementRequest) (*models.CashDrawerSession, error) {
+	user, err := s.drawerUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Type != repositories.MovementCashIn && req.Type != repositories.MovementCashOut {
+		return nil, fmt.Errorf("%w: unknown movement type %q", ErrInvalidCashDrawer, req.Type)
+	}
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidCashDrawer)
+	}
+
+	if err := s.cashDrawerRepo.AddMovement(ctx, user.MerchantID, user.UserID, req.DeviceID, req.Type, req.Amount, req.Reason); err != nil {
+		return nil, mapCashDrawerError(err)
+	}
+
+	session, err := s.cashDrawerRepo.GetCurrentSession(ctx, user.MerchantID)
+	return session, mapCashDrawerError(err)
+}
+
+// CloseSession : counted cash vs expected cash
+func (s *CashDrawerService) CloseSession(ctx context.Context, token string, req models.CloseCashDrawerSessionRequest) (*models.CashDrawerSession, error) {
+	user, err := s.drawerUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.CountedCash < 0 {
+		return nil, fmt.Errorf("%w: negative counted_cash", ErrInvalidCashDrawer)
+	}
+
+	sessionID, err := s.cashDrawerRepo.CloseSession(ctx, user.MerchantID, user.UserID, req.CountedCash, req.Notes)
+	if err != nil {
+		return nil, mapCashDrawerError(err)
+	}
+	return s.cashDrawerRepo.GetSession(ctx, user.MerchantID, sessionID)
+}
+
+// GetZReport : date is YYYY-MM-DD in the merchant time zone, today if empty
+func (s *CashDrawerService) GetZReport(ctx context.Context, token, date string) (*models.ZReport, error) {
 	user, err := s.userRepo.GetUserByToken(ctx, token)
 	if err != nil || user == nil {
-		return errors.New("invalid token")
+		return nil, errors.New("invalid token")
+	}
+	if !user.PrintMerchantCashReport {
+		return nil, ErrCashDrawerNotAllowed
 	}
 
-	return s.cashDrawerRepo.OpenCashDrawer(ctx, user.UserID, deviceID)
+	loc := merchantLocation(user)
+	day := time.Now().In(loc)
+	if date != "" {
+		day, err = time.ParseInLocation("2006-01-02", date, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid date", ErrInvalidCashDrawer)
+		}
+	}
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 0, 1)
+
+	report, err := s.cashDrawerRepo.GetZReport(ctx, user.MerchantID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	report.Date = from.Format("2006-01-02")
+	return report, nil
+}
+
+// drawerUser resolves the token and checks the open_cash_drawer right
+func (s *CashDrawerService) drawerUser(ctx context.Context, token string) (*models.UserLoginRow, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil || user == nil {
+		return nil, errors.New("invalid token")
+	}
+	if !user.OpenCashDrawer {
+		return nil, ErrCashDrawerNotAllowed
+	}
+	return user, nil
+}
+
+func mapCashDrawerError(err error) error {
+	if errors.Is(err, repositories.ErrNoOpenCashSession) || errors.Is(err, repositories.ErrCashSessionAlreadyOpen) {
+		return fmt.Errorf("%w: %v", ErrCashDrawerConflict, err)
+	}
+	return err
 }
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/units"
+)
+
+// defaultTargetMargin : gross margin (percent of the price excl. TVA) when the merchant set none,
+// i.e. a food cost of 30%
+const defaultTargetMargin = 70.0
+
+// GetProductCost : theoretical food cost and margins of one product.
+// target overrides the merchant's target margin.
+func (s *MenuService) GetProductCost(ctx context.Context, token, productID string, target *float64, lang string) (*models.ProductCost, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	targetMargin, err := s.targetMargin(ctx, merchantID, target)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.legacy.GetProductCosts(ctx, merchantID, productID, lang)
+	if err != nil {
+		return nil, err
+	}
+	costProduct(&list[0], targetMargin)
+	return &list[0], nil
+}
+
+// GetMarginReport : every product sold, underTargetOnly keeps the flagged ones
+func (s *MenuService) GetMarginReport(ctx context.Context, token string, target *float64, underTargetOnly bool, lang string) (*models.MarginReport, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	targetMargin, err := s.targetMargin(ctx, merchantID, target)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.legacy.GetProductCosts(ctx, merchantID, "", lang)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.MarginReport{TargetMargin: targetMargin, ProductsCount: len(list), Products: []models.ProductCost{}}
+	for i := range list {
+		costProduct(&list[i], targetMargin)
+		if list[i].UnderTarget {
+			report.UnderTargetCount++
+		}
+		if !list[i].Complete {
+			report.IncompleteCount++
+		}
+		if list[i].UnderTarget || !underTargetOnly {
+			report.Products = append(report.Products, list[i])
+		}
+	}
+	return report, nil
+}
+
+// SetComponentCost : purchase cost of a component, for cost_unit ("" : the unit of its recipes)
+func (s *MenuService) SetComponentCost(ctx context.Context, token, componentID string, req models.CostRequest) error {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return err
+	}
+	if req.CostPrice != nil && *req.CostPrice < 0 {
+		return fmt.Errorf("%w: negative cost_price", ErrInvalidMenu)
+	}
+	if req.CostUnit != nil && *req.CostUnit != "" {
+		unit, err := units.Lookup(*req.CostUnit)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidMenu, err)
+		}
+		req.CostUnit = &unit.Code
+	}
+	return s.legacy.SetComponentCost(ctx, merchantID, componentID, req)
+}
+
+// SetOptionCost : food cost one unit of a configurable option adds
+func (s *MenuService) SetOptionCost(ctx context.Context, token, optionID string, req models.CostRequest) error {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return err
+	}
+	if req.CostPrice != nil && *req.CostPrice < 0 {
+		return fmt.Errorf("%w: negative cost_price", ErrInvalidMenu)
+	}
+	return s.legacy.SetOptionCost(ctx, merchantID, optionID, req)
+}
+
+func (s *MenuService) targetMargin(ctx context.Context, merchantID string, override *float64) (float64, error) {
+	if override != nil {
+		if *override < 0 || *override >= 100 || math.IsNaN(*override) {
+			return 0, fmt.Errorf("%w: target_margin must be in [0, 100)", ErrInvalidMenu)
+		}
+		return *override, nil
+	}
+	target, err := s.legacy.GetTargetMargin(ctx, merchantID)
+	if err != nil {
+		return 0, err
+	}
+	if target == nil {
+		return defaultTargetMargin, nil
+	}
+	return *target, nil
+}
+
+// costProduct fills the costs and margins of a product loaded by GetProductCosts
+func costProduct(p *models.ProductCost, targetMargin float64) {
+	total := 0.0
+	// sans recette le coût 0 n'est pas un coût, juste une donnée manquante
+	p.Complete = len(p.Components) > 0
+	for i := range p.Components {
+		c := &p.Components[i]
+		cost, ok := componentCost(*c)
+		if !ok {
+			p.Complete = false
+			continue
+		}
+		c.Cost = &cost
+		total += cost
+	}
+	p.Cost = int64(math.Round(total))
+
+	p.UnderTarget = false
+	for i := range p.Channels {
+		ch := &p.Channels[i]
+		ch.PriceHT = priceExclTVA(ch.Price, ch.TVARate)
+		ch.Margin = ch.PriceHT - p.Cost
+		ch.MarginRate = marginRate(ch.Margin, ch.PriceHT)
+
+		extraHT, extraCost := worstOptions(p.Attributes, ch.TVARate)
+		ch.WorstMargin = ch.PriceHT + extraHT - p.Cost - extraCost
+		ch.WorstMarginRate = marginRate(ch.WorstMargin, ch.PriceHT+extraHT)
+
+		ch.UnderTarget = (ch.MarginRate != nil && *ch.MarginRate < targetMargin) ||
+			(ch.WorstMarginRate != nil && *ch.WorstMarginRate < targetMargin)
+		if ch.UnderTarget {
+			p.UnderTarget = true
+		}
+	}
+}
+
+// componentCost : quantity of the recipe converted to the cost unit, times the cost.
+// false when the component has no cost or the units don't convert.
+func componentCost(c models.ComponentCost) (float64, bool) {
+	if c.CostPrice == nil {
+		return 0, false
+	}
+	qty := c.Quantity
+	if c.CostUnit != nil {
+		if c.UnitCode == nil {
+			return 0, false
+		}
+		converted, err := units.Convert(qty, *c.UnitCode, *c.CostUnit)
+		if err != nil {
+			return 0, false
+		}
+		qty = converted
+	}
+	return qty * float64(*c.CostPrice), true
+}
+
+// worstOptions : extra price (excl. TVA) and cost of the options that bring the least margin.
+// Per attribute, the required options (min_options) are the least profitable ones, and the
+// options that lose money are added on top, at their max quantity, up to max_options.
+func worstOptions(attributes []models.AttributeCost, tvaRate float64) (extraHT, cost int64) {
+	type option struct {
+		extraHT, cost, units int64
+	}
+	for _, a := range attributes {
+		opts := make([]option, 0, len(a.Options))
+		for _, o := range a.Options {
+			opt := option{extraHT: priceExclTVA(o.ExtraPrice, tvaRate), units: int64(o.MaxQuantity)}
+			if o.Cost != nil {
+				opt.cost = *o.Cost
+			}
+			if opt.units <= 0 {
+				opt.units = 1
+			}
+			opts = append(opts, opt)
+		}
+		sort.SliceStable(opts, func(i, j int) bool {
+			return opts[i].extraHT-opts[i].cost < opts[j].extraHT-opts[j].cost
+		})
+
+		limit := a.MaxOptions
+		if limit <= 0 || limit > len(opts) {
+			limit = len(opts)
+		}
+		for i := 0; i < limit; i++ {
+			losing := opts[i].extraHT < opts[i].cost
+			if i >= a.MinOptions && !losing {
+				break
+			}
+			n := int64(1)
+			if losing {
+				n = opts[i].units
+			}
+			extraHT += n * opts[i].extraHT
+			cost += n * opts[i].cost
+		}
+	}
+	return extraHT, cost
+}
+
+// priceExclTVA : same rounding as the TVA of the orders (vatFromGross), rate in percent
+func priceExclTVA(price int64, rate float64) int64 {
+	if rate <= 0 {
+		return price
+	}
+	return price - int64(math.Round(float64(price)-float64(price)/(1+rate/100)))
+}
+
+// marginRate : percent of the price excl. TVA, one decimal. nil for a free product.
+func marginRate(margin, priceHT int64) *float64 {
+	if priceHT <= 0 {
+		return nil
+	}
+	rate := math.Round(float64(margin)*1000/float64(priceHT)) / 10
+	return &rate
+}
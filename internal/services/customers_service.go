@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/repositories"
+)
+
+// ErrInvalidCustomer : missing name / phone, empty address...
+var ErrInvalidCustomer = errors.New("invalid customer")
+
+const (
+	customerSearchLimit = 20
+	customerOrdersLimit = 20
+	// phoneMatchDigits : les derniers chiffres suffisent à reconnaître un numéro quel que soit le préfixe saisi
+	phoneMatchDigits = 9
+)
+
+type CustomersService struct {
+	customersRepo *repositories.CustomersRepository
+	ordersRepo    *repositories.OrdersRepository
+	userRepo      *repositories.UserRepository // used to resolve token -> merchant id
+}
+
+func NewCustomersService(customersRepo *repositories.CustomersRepository, ordersRepo *repositories.OrdersRepository, userRepo *repositories.UserRepository) *CustomersService {
+	return &CustomersService{
+		customersRepo: customersRepo,
+		ordersRepo:    ordersRepo,
+		userRepo:      userRepo,
+	}
+}
+
+func (s *CustomersService) merchantID(ctx context.Context, token string) (string, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", errors.New("invalid token")
+	}
+	return user.MerchantID, nil
+}
+
+// Search : by phone (caller ID at the reception) and / or by name
+func (s *CustomersService) Search(ctx context.Context, token, phone, name string) ([]models.CustomerProfile, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if phone != "" {
+		phone = normalizePhone(phone)
+		if phone == "" {
+			return nil, fmt.Errorf("%w: phone without digits", ErrInvalidCustomer)
+		}
+	}
+	return s.customersRepo.SearchCustomers(ctx, merchantID, phone, strings.TrimSpace(name), customerSearchLimit)
+}
+
+// GetCustomer : customer, address book and latest orders (any state)
+func (s *CustomersService) GetCustomer(ctx context.Context, token, customerID string) (*models.CustomerProfile, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	customer, err := s.customersRepo.GetCustomer(ctx, merchantID, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.ordersRepo.GetHistoryPage(ctx, merchantID, models.OrderHistoryQuery{
+		CustomerID: customerID,
+		Limit:      customerOrdersLimit,
+	}, "")
+	if err != nil {
+		return nil, err
+	}
+	customer.Orders = page.Orders
+	customer.OrdersNextCursor = page.NextCursor
+
+	return customer, nil
+}
+
+func (s *CustomersService) CreateCustomer(ctx context.Context, token string, req models.CustomerRequest) (*models.CustomerProfile, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if isBlank(req.Name) && isBlank(req.Tel) {
+		return nil, fmt.Errorf("%w: customer_name or customer_tel required", ErrInvalidCustomer)
+	}
+	if req.Address != nil && isBlank(req.Address.Address) {
+		return nil, fmt.Errorf("%w: empty address", ErrInvalidCustomer)
+	}
+
+	customerID, err := s.customersRepo.CreateCustomer(ctx, merchantID, req)
+	if err != nil {
+		return nil, err
+	}
+	return s.customersRepo.GetCustomer(ctx, merchantID, customerID)
+}
+
+func (s *CustomersService) UpdateCustomer(ctx context.Context, token, customerID string, req models.CustomerRequest) (*models.CustomerProfile, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Address != nil {
+		return nil, fmt.Errorf("%w: addresses are updated through /addresses", ErrInvalidCustomer)
+	}
+
+	if err := s.customersRepo.UpdateCustomer(ctx, merchantID, customerID, req); err != nil {
+		return nil, err
+	}
+	return s.customersRepo.GetCustomer(ctx, merchantID, customerID)
+}
+
+func (s *CustomersService) AddAddress(ctx context.Context, token, customerID string, req models.CustomerAddressRequest) (*models.CustomerProfile, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if isBlank(req.Address) {
+		return nil, fmt.Errorf("%w: empty address", ErrInvalidCustomer)
+	}
+
+	if _, err := s.customersRepo.AddAddress(ctx, merchantID, customerID, req); err != nil {
+		return nil, err
+	}
+	return s.customersRepo.GetCustomer(ctx, merchantID, customerID)
+}
+
+func (s *CustomersService) UpdateAddress(ctx context.Context, token, customerID, addressID string, req models.CustomerAddressRequest) (*models.CustomerProfile, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Address != nil && isBlank(req.Address) {
+		return nil, fmt.Errorf("%w: empty address", ErrInvalidCustomer)
+	}
+
+	if err := s.customersRepo.UpdateAddress(ctx, merchantID, customerID, addressID, req); err != nil {
+		return nil, err
+	}
+	return s.customersRepo.GetCustomer(ctx, merchantID, customerID)
+}
+
+func (s *CustomersService) DeleteAddress(ctx context.Context, token, customerID, addressID string) error {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	return s.customersRepo.DeleteAddress(ctx, merchantID, customerID, addressID)
+}
+
+// normalizePhone : digits only, last phoneMatchDigits of them
+func normalizePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) > phoneMatchDigits {
+		digits = digits[len(digits)-phoneMatchDigits:]
+	}
+	return digits
+}
+
+func isBlank(s *string) bool {
+	return s == nil || strings.TrimSpace(*s) == ""
+}
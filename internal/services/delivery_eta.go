@@ -0,0 +1,82 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+	"welloresto-api/internal/models"
+)
+
+// Straight-line ETA: no routing engine, so the haversine distance is inflated by a
+// detour factor and driven at an average urban speed, plus a fixed time per stop.
+const (
+	etaDetourFactor    = 1.3
+	etaAverageSpeedKmh = 25.0
+	etaStopDuration    = 3 * time.Minute
+	earthRadiusMeters  = 6371000.0
+)
+
+// haversineMeters returns the great-circle distance between two points
+func haversineMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+// computeStops fills session.Stops with the remaining stops (OPEN / DONE orders) in priority order.
+// ETAs need the driver position; a stop without coordinates gets no ETA and the next leg starts
+// from the last known point.
+func computeStops(session *models.DeliverySession, now time.Time) {
+	orders := make([]models.Order, 0, len(session.Orders))
+	for _, o := range session.Orders {
+		if o.State != nil && (*o.State == "OPEN" || *o.State == "DONE") {
+			orders = append(orders, o)
+		}
+	}
+	sort.SliceStable(orders, func(i, j int) bool { return priorityOf(orders[i]) < priorityOf(orders[j]) })
+
+	driver := session.DeliveryMan
+	hasPosition := driver.Lat != nil && driver.Lng != nil
+	var lat, lng float64
+	if hasPosition {
+		lat, lng = *driver.Lat, *driver.Lng
+	}
+
+	speed := etaAverageSpeedKmh * 1000 / 3600 // m/s
+	var elapsed time.Duration
+
+	session.Stops = make([]models.DeliveryStop, 0, len(orders))
+	for _, o := range orders {
+		stop := models.DeliveryStop{OrderID: o.OrderID}
+		if o.Priority != nil {
+			stop.Priority = *o.Priority
+		}
+
+		c := o.Customer
+		if hasPosition && c != nil && c.CustomerLat != nil && c.CustomerLng != nil {
+			distance := haversineMeters(lat, lng, *c.CustomerLat, *c.CustomerLng) * etaDetourFactor
+			elapsed += time.Duration(distance / speed * float64(time.Second))
+
+			meters := int64(distance)
+			seconds := int64(elapsed.Seconds())
+			arrival := now.Add(elapsed)
+			stop.DistanceMeters, stop.ETASeconds, stop.EstimatedArrival = &meters, &seconds, &arrival
+
+			lat, lng = *c.CustomerLat, *c.CustomerLng
+			elapsed += etaStopDuration
+		}
+
+		session.Stops = append(session.Stops, stop)
+	}
+}
+
+// priorityOf : orders without a rank go last
+func priorityOf(o models.Order) int64 {
+	if o.Priority == nil {
+		return math.MaxInt64
+	}
+	return *o.Priority
+}
@@ -3,26 +3,159 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
+	"welloresto-api/internal/events"
 	"welloresto-api/internal/models"
 	"welloresto-api/internal/repositories"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrInvalidDeliverySession is returned when a delivery session payload can't be applied
+	ErrInvalidDeliverySession = errors.New("invalid delivery session")
+	// ErrDeliverySessionConflict is returned when the session (or the order) is not in a state allowing the change
+	ErrDeliverySessionConflict = errors.New("delivery session conflict")
+	// ErrNotSessionDriver is returned when someone else than the driver pushes a position, or changes
+	// the session without the reception right (the repository error itself, re-exported for the handlers)
+	ErrNotSessionDriver = repositories.ErrNotSessionDriver
 )
 
 type DeliverySessionsService struct {
 	deliverySessionsRepo *repositories.DeliverySessionsRepository
+	stockRepo            *repositories.StockRepository
 	userRepo             *repositories.UserRepository // used to resolve token -> merchant id
+	bus                  *events.Bus
+	log                  *zap.Logger
 }
 
-func NewDeliverySessionsService(deliverySessionsRepo *repositories.DeliverySessionsRepository, userRepo *repositories.UserRepository) *DeliverySessionsService {
+func NewDeliverySessionsService(deliverySessionsRepo *repositories.DeliverySessionsRepository, stockRepo *repositories.StockRepository, userRepo *repositories.UserRepository, bus *events.Bus, log *zap.Logger) *DeliverySessionsService {
 	return &DeliverySessionsService{
 		deliverySessionsRepo: deliverySessionsRepo,
+		stockRepo:            stockRepo,
 		userRepo:             userRepo,
+		bus:                  bus,
+		log:                  log,
 	}
 }
 
 // /delivery_sessions/pending
 
 // GetPendingDeliverySessions returns delivery sessions (no orders)
-func (s *DeliverySessionsService) GetPendingDeliverySessions(ctx context.Context, token string) ([]models.DeliverySession, error) {
+func (s *DeliverySessionsService) GetPendingDeliverySessions(ctx context.Context, token, lang string) ([]models.DeliverySession, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+	sessions, err := s.deliverySessionsRepo.GetPendingDeliverySessions(ctx, user.MerchantID, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	for i := range sessions {
+		computeStops(&sessions[i], now)
+	}
+	return sessions, nil
+}
+
+func (s *DeliverySessionsService) GetDeliverySession(ctx context.Context, token, sessionID, lang string) (*models.DeliverySession, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+	session, err := s.deliverySessionsRepo.GetDeliverySession(ctx, user.MerchantID, sessionID, lang)
+	if err != nil {
+		return nil, err
+	}
+	computeStops(session, time.Now().UTC())
+	return session, nil
+}
+
+// CreateDeliverySession opens a session for a driver (WR_DELIVERY). A driver only opens their
+// own sessions, the reception opens them for any driver of the merchant.
+func (s *DeliverySessionsService) CreateDeliverySession(ctx context.Context, token string, req models.CreateDeliverySessionRequest) (*models.DeliverySession, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	if !user.AccessReception {
+		req.UserID = user.UserID
+	}
+	if req.UserID == "" {
+		return nil, fmt.Errorf("%w: missing user_id", ErrInvalidDeliverySession)
+	}
+
+	sessionID, err := s.deliverySessionsRepo.CreateDeliverySession(ctx, user.MerchantID, req.UserID, req.OrderIDs)
+	if err != nil {
+		return nil, mapDeliverySessionError(err)
+	}
+	return s.refreshAndPublish(ctx, user.MerchantID, sessionID)
+}
+
+func (s *DeliverySessionsService) AttachOrder(ctx context.Context, token, sessionID, orderID string) (*models.DeliverySession, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	if orderID == "" {
+		return nil, fmt.Errorf("%w: missing order_id", ErrInvalidDeliverySession)
+	}
+
+	if err := s.deliverySessionsRepo.AttachOrder(ctx, user.MerchantID, sessionID, sessionDriverScope(user), orderID); err != nil {
+		return nil, mapDeliverySessionError(err)
+	}
+	return s.refreshAndPublish(ctx, user.MerchantID, sessionID)
+}
+
+func (s *DeliverySessionsService) DetachOrder(ctx context.Context, token, sessionID, orderID string) (*models.DeliverySession, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	if err := s.deliverySessionsRepo.DetachOrder(ctx, user.MerchantID, sessionID, sessionDriverScope(user), orderID); err != nil {
+		return nil, mapDeliverySessionError(err)
+	}
+	return s.refreshAndPublish(ctx, user.MerchantID, sessionID)
+}
+
+func (s *DeliverySessionsService) ReorderOrders(ctx context.Context, token, sessionID string, orderIDs []string) (*models.DeliverySession, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	if err := s.deliverySessionsRepo.ReorderOrders(ctx, user.MerchantID, sessionID, sessionDriverScope(user), orderIDs); err != nil {
+		return nil, mapDeliverySessionError(err)
+	}
+	return s.refreshAndPublish(ctx, user.MerchantID, sessionID)
+}
+
+// UpdateStatus : DEPARTED or COMPLETED, the orders of the session follow (see repository)
+// and what they still hold comes out of the stock, as for a DONE / CLOSED order
+func (s *DeliverySessionsService) UpdateStatus(ctx context.Context, token, sessionID, status string) (*models.DeliverySession, error) {
 	user, err := s.userRepo.GetUserByToken(ctx, token)
 	if err != nil {
 		return nil, err
@@ -30,5 +163,80 @@ func (s *DeliverySessionsService) GetPendingDeliverySessions(ctx context.Context
 	if user == nil {
 		return nil, errors.New("invalid token")
 	}
-	return s.deliverySessionsRepo.GetPendingDeliverySessions(ctx, user.MerchantID)
+
+	if status != repositories.SessionDeparted && status != repositories.SessionCompleted {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidDeliverySession, status)
+	}
+
+	moved, err := s.deliverySessionsRepo.UpdateSessionStatus(ctx, user.MerchantID, sessionID, sessionDriverScope(user), status, user.UserID)
+	if err != nil {
+		return nil, mapDeliverySessionError(err)
+	}
+	for _, orderID := range moved {
+		consumeOrderStock(ctx, s.log, s.stockRepo, s.bus, user, orderID, true)
+	}
+	return s.refreshAndPublish(ctx, user.MerchantID, sessionID)
+}
+
+// RecordPosition : GPS fix pushed by the driver app (WR_DELIVERY), only by the driver of the session
+func (s *DeliverySessionsService) RecordPosition(ctx context.Context, token, sessionID string, req models.DriverPositionRequest) (*models.DeliverySession, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	if req.Lat < -90 || req.Lat > 90 || req.Lng < -180 || req.Lng > 180 || (req.Lat == 0 && req.Lng == 0) {
+		return nil, fmt.Errorf("%w: invalid coordinates", ErrInvalidDeliverySession)
+	}
+	now := time.Now().UTC()
+	recordedAt := now
+	if req.RecordedAt != nil {
+		recordedAt = req.RecordedAt.UTC()
+		// horloge device dans le futur : on garde celle du serveur
+		if recordedAt.After(now) {
+			recordedAt = now
+		}
+	}
+
+	if err := s.deliverySessionsRepo.RecordPosition(ctx, user.MerchantID, sessionID, user.UserID, req.Lat, req.Lng, recordedAt); err != nil {
+		return nil, mapDeliverySessionError(err)
+	}
+	return s.refreshAndPublish(ctx, user.MerchantID, sessionID)
+}
+
+// sessionDriverScope : the reception changes any session of the merchant, a driver only their own
+// ("" = no restriction, see lockDeliverySession)
+func sessionDriverScope(user *models.UserLoginRow) string {
+	if user.AccessReception {
+		return ""
+	}
+	return user.UserID
+}
+
+func (s *DeliverySessionsService) refreshAndPublish(ctx context.Context, merchantID, sessionID string) (*models.DeliverySession, error) {
+	session, err := s.deliverySessionsRepo.GetDeliverySession(ctx, merchantID, sessionID, publishedLang)
+	if err != nil {
+		return nil, err
+	}
+	computeStops(session, time.Now().UTC())
+	s.bus.Publish(events.Event{
+		Type:              events.DeliverySessionUpdated,
+		MerchantID:        merchantID,
+		DeliverySessionID: sessionID,
+		Data:              session,
+	})
+	return session, nil
+}
+
+func mapDeliverySessionError(err error) error {
+	switch {
+	case errors.Is(err, repositories.ErrInvalidReference):
+		return fmt.Errorf("%w: %v", ErrInvalidDeliverySession, err)
+	case errors.Is(err, repositories.ErrOrderAlreadyAssigned), errors.Is(err, repositories.ErrIllegalSessionChange):
+		return fmt.Errorf("%w: %v", ErrDeliverySessionConflict, err)
+	}
+	return err
 }
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/repositories"
+)
+
+var (
+	// ErrInvalidFloorPlan : blank name, bad polygon, seats or size out of range, unknown area / table
+	ErrInvalidFloorPlan = errors.New("invalid floor plan")
+	// ErrFloorPlanConflict : removing a table that has an open order or an upcoming booking
+	ErrFloorPlanConflict = errors.New("floor plan conflict")
+)
+
+// maxTableSeats : more than that is a typo, not a table
+const maxTableSeats = 50
+
+func (s *LocationsService) floorPlanUser(ctx context.Context, token string) (*models.UserLoginRow, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+	return user, nil
+}
+
+func (s *LocationsService) GetFloors(ctx context.Context, token string) ([]models.Floor, error) {
+	user, err := s.floorPlanUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.locationsRepo.GetFloors(ctx, user.MerchantID)
+}
+
+func (s *LocationsService) GetFloor(ctx context.Context, token, floorID string) (*models.Floor, error) {
+	user, err := s.floorPlanUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.locationsRepo.GetFloor(ctx, user.MerchantID, floorID)
+}
+
+func (s *LocationsService) CreateFloor(ctx context.Context, token string, req models.FloorRequest) (*models.Floor, error) {
+	user, err := s.floorPlanUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if isBlank(&req.Name) {
+		return nil, fmt.Errorf("%w: name required", ErrInvalidFloorPlan)
+	}
+
+	floorID, err := s.locationsRepo.CreateFloor(ctx, user.MerchantID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return s.locationsRepo.GetFloor(ctx, user.MerchantID, floorID)
+}
+
+func (s *LocationsService) RenameFloor(ctx context.Context, token, floorID string, req models.FloorRequest) (*models.Floor, error) {
+	user, err := s.floorPlanUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if isBlank(&req.Name) {
+		return nil, fmt.Errorf("%w: name required", ErrInvalidFloorPlan)
+	}
+
+	if err := s.locationsRepo.RenameFloor(ctx, user.MerchantID, floorID, req.Name); err != nil {
+		return nil, err
+	}
+	return s.locationsRepo.GetFloor(ctx, user.MerchantID, floorID)
+}
+
+func (s *LocationsService) DeleteFloor(ctx context.Context, token, floorID string) error {
+	user, err := s.floorPlanUser(ctx, token)
+	if err != nil {
+		return err
+	}
+	return mapFloorPlanError(s.locationsRepo.DeleteFloor(ctx, user.MerchantID, floorID))
+}
+
+// SaveArea creates (areaID "") or replaces an area of the floor, returns the floor
+func (s *LocationsService) SaveArea(ctx context.Context, token, floorID, areaID string, area models.Area) (*models.Floor, error) {
+	user, err := s.floorPlanUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	area.AreaID = areaID
+	area.FloorID = floorID
+	if err := validateArea(area); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.locationsRepo.SaveArea(ctx, user.MerchantID, area); err != nil {
+		return nil, mapFloorPlanError(err)
+	}
+	return s.locationsRepo.GetFloor(ctx, user.MerchantID, floorID)
+}
+
+func (s *LocationsService) DeleteArea(ctx context.Context, token, floorID, areaID string) error {
+	user, err := s.floorPlanUser(ctx, token)
+	if err != nil {
+		return err
+	}
+	return s.locationsRepo.DeleteArea(ctx, user.MerchantID, floorID, areaID)
+}
+
+// SaveTable creates (locationID "") or replaces a table of the floor, returns the floor
+func (s *LocationsService) SaveTable(ctx context.Context, token, floorID, locationID string, table models.FloorTable) (*models.Floor, error) {
+	user, err := s.floorPlanUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	table.LocationID = locationID
+	table.FloorID = floorID
+	if err := validateTable(table); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.locationsRepo.SaveTable(ctx, user.MerchantID, table); err != nil {
+		return nil, mapFloorPlanError(err)
+	}
+	return s.locationsRepo.GetFloor(ctx, user.MerchantID, floorID)
+}
+
+func (s *LocationsService) DeleteTable(ctx context.Context, token, floorID, locationID string) error {
+	user, err := s.floorPlanUser(ctx, token)
+	if err != nil {
+		return err
+	}
+	return mapFloorPlanError(s.locationsRepo.DeleteTable(ctx, user.MerchantID, floorID, locationID))
+}
+
+// SaveFloorLayout validates the whole layout first, then saves it in one transaction
+func (s *LocationsService) SaveFloorLayout(ctx context.Context, token, floorID string, layout models.FloorLayoutRequest) (*models.Floor, error) {
+	user, err := s.floorPlanUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if layout.Name != nil && isBlank(layout.Name) {
+		return nil, fmt.Errorf("%w: name required", ErrInvalidFloorPlan)
+	}
+	areaIDs := map[string]bool{}
+	for _, a := range layout.Areas {
+		if a.AreaID != "" {
+			if areaIDs[a.AreaID] {
+				return nil, fmt.Errorf("%w: area %s listed twice", ErrInvalidFloorPlan, a.AreaID)
+			}
+			areaIDs[a.AreaID] = true
+		}
+		if err := validateArea(a); err != nil {
+			return nil, err
+		}
+	}
+	tableIDs := map[string]bool{}
+	for _, t := range layout.Tables {
+		if t.LocationID != "" {
+			if tableIDs[t.LocationID] {
+				return nil, fmt.Errorf("%w: table %s listed twice", ErrInvalidFloorPlan, t.LocationID)
+			}
+			tableIDs[t.LocationID] = true
+		}
+		if err := validateTable(t); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.locationsRepo.SaveFloorLayout(ctx, user.MerchantID, floorID, layout); err != nil {
+		return nil, mapFloorPlanError(err)
+	}
+	return s.locationsRepo.GetFloor(ctx, user.MerchantID, floorID)
+}
+
+// validateArea : the polygon has at least 3 vertices, finite coordinates and a non-zero surface
+func validateArea(a models.Area) error {
+	if len(a.Points) < 6 || len(a.Points)%2 != 0 {
+		return fmt.Errorf("%w: area %q needs at least 3 points as x, y pairs", ErrInvalidFloorPlan, a.Name)
+	}
+	if !finite(a.X, a.Y, a.Angle) || !finite(a.Points...) {
+		return fmt.Errorf("%w: area %q has a non finite coordinate", ErrInvalidFloorPlan, a.Name)
+	}
+
+	// shoelace : des points alignés ou confondus ne dessinent rien
+	surface := 0.0
+	n := len(a.Points) / 2
+	for i := 0; i < n; i++ {
+		j := (i + 1) % n
+		surface += a.Points[2*i]*a.Points[2*j+1] - a.Points[2*j]*a.Points[2*i+1]
+	}
+	if surface == 0 {
+		return fmt.Errorf("%w: area %q has no surface", ErrInvalidFloorPlan, a.Name)
+	}
+	return nil
+}
+
+func validateTable(t models.FloorTable) error {
+	if isBlank(&t.LocationName) {
+		return fmt.Errorf("%w: table name required", ErrInvalidFloorPlan)
+	}
+	if t.Seats < 1 || t.Seats > maxTableSeats {
+		return fmt.Errorf("%w: table %q seats must be between 1 and %d", ErrInvalidFloorPlan, t.LocationName, maxTableSeats)
+	}
+	if isBlank(&t.Shape) {
+		return fmt.Errorf("%w: table %q shape required", ErrInvalidFloorPlan, t.LocationName)
+	}
+	if !finite(t.X, t.Y, t.Width, t.Height, t.Angle) {
+		return fmt.Errorf("%w: table %q has a non finite coordinate", ErrInvalidFloorPlan, t.LocationName)
+	}
+	if t.Width <= 0 || t.Height <= 0 {
+		return fmt.Errorf("%w: table %q needs a positive size", ErrInvalidFloorPlan, t.LocationName)
+	}
+	if t.Order < 0 {
+		return fmt.Errorf("%w: table %q has a negative order", ErrInvalidFloorPlan, t.LocationName)
+	}
+	return nil
+}
+
+func finite(values ...float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func mapFloorPlanError(err error) error {
+	switch {
+	case errors.Is(err, repositories.ErrInvalidReference):
+		return fmt.Errorf("%w: %v", ErrInvalidFloorPlan, err)
+	case errors.Is(err, repositories.ErrTableInUse):
+		return fmt.Errorf("%w: %v", ErrFloorPlanConflict, err)
+	}
+	return err
+}
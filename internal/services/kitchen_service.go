@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"welloresto-api/internal/events"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/repositories"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidKitchenUpdate is returned when a production status bump can't be applied
+var ErrInvalidKitchenUpdate = errors.New("invalid kitchen update")
+
+// ErrKitchenConflict : the item is already past the requested step, or its order is no longer OPEN
+var ErrKitchenConflict = errors.New("kitchen status conflict")
+
+type KitchenService struct {
+	kitchenRepo *repositories.KitchenRepository
+	ordersRepo  *repositories.OrdersRepository
+	stockRepo   *repositories.StockRepository
+	userRepo    *repositories.UserRepository
+	bus         *events.Bus
+	log         *zap.Logger
+}
+
+func NewKitchenService(kitchenRepo *repositories.KitchenRepository, ordersRepo *repositories.OrdersRepository, stockRepo *repositories.StockRepository, userRepo *repositories.UserRepository, bus *events.Bus, log *zap.Logger) *KitchenService {
+	return &KitchenService{
+		kitchenRepo: kitchenRepo,
+		ordersRepo:  ordersRepo,
+		stockRepo:   stockRepo,
+		userRepo:    userRepo,
+		bus:         bus,
+		log:         log,
+	}
+}
+
+// GetItems lists the items still to be produced / distributed, grouped by
+// "station" (products.production_color, one color per station on the screens) or "category"
+func (s *KitchenService) GetItems(ctx context.Context, token, groupBy string) (*models.KitchenResponse, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	if groupBy == "" {
+		groupBy = "station"
+	}
+	if groupBy != "station" && groupBy != "category" {
+		return nil, fmt.Errorf("%w: unknown group_by %q", ErrInvalidKitchenUpdate, groupBy)
+	}
+
+	items, err := s.kitchenRepo.GetOpenItems(ctx, user.MerchantID, user.KitchenShowOnlyPaid)
+	if err != nil {
+		return nil, err
+	}
+
+	// items are sorted oldest first, groups keep the order of their oldest item
+	resp := &models.KitchenResponse{GroupBy: groupBy, ServerTime: time.Now().UTC(), Groups: []models.KitchenGroup{}}
+	index := map[string]int{}
+	for _, it := range items {
+		key := it.ProductionColor
+		if groupBy == "category" {
+			key = it.Category
+		}
+		k := ""
+		if key != nil {
+			k = *key
+		}
+
+		i, ok := index[k]
+		if !ok {
+			label := k
+			if label == "" {
+				label = "Autres"
+			}
+			i = len(resp.Groups)
+			index[k] = i
+			resp.Groups = append(resp.Groups, models.KitchenGroup{Key: k, Label: label})
+		}
+		resp.Groups[i].Items = append(resp.Groups[i].Items, it)
+	}
+
+	return resp, nil
+}
+
+// UpdateItemStatus bumps an order item to IN_PROGRESS, READY or DISTRIBUTED (per quantity)
+// and returns the refreshed order. READY units are taken out of the stock.
+func (s *KitchenService) UpdateItemStatus(ctx context.Context, token, orderItemID string, req models.KitchenItemStatusRequest) (*models.Order, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	switch req.Status {
+	case repositories.ProductionInProgress, repositories.ProductionReady, repositories.ProductionDistributed:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidKitchenUpdate, req.Status)
+	}
+	if req.Quantity < 0 {
+		return nil, fmt.Errorf("%w: negative quantity", ErrInvalidKitchenUpdate)
+	}
+
+	orderID, err := s.kitchenRepo.UpdateItemStatus(ctx, user.MerchantID, orderItemID, req.Status, req.Quantity)
+	if err != nil {
+		if errors.Is(err, repositories.ErrQuantityUnavailable) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKitchenUpdate, err)
+		}
+		if errors.Is(err, repositories.ErrProductionBackwards) || errors.Is(err, repositories.ErrStateConflict) {
+			return nil, fmt.Errorf("%w: %v", ErrKitchenConflict, err)
+		}
+		return nil, err
+	}
+	if req.Status == repositories.ProductionReady {
+		consumeOrderStock(ctx, s.log, s.stockRepo, s.bus, user, orderID, false)
+	}
+
+	order, err := s.ordersRepo.GetOrder(ctx, user.MerchantID, orderID, publishedLang)
+	if err != nil {
+		return nil, err
+	}
+	publishOrder(s.bus, events.OrderUpdated, user.MerchantID, order)
+	return order, nil
+}
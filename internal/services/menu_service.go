@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log"
 	"time"
+	"welloresto-api/internal/events"
 	"welloresto-api/internal/models"
 	"welloresto-api/internal/repositories"
 )
@@ -15,18 +16,20 @@ type MenuService struct {
 	opt      *repositories.OptimizedMenuRepository
 	// choose repo via config; for now use both
 	useOptimized bool
+	bus          *events.Bus
 }
 
-func NewMenuService(userRepo *repositories.UserRepository, legacy *repositories.MenuRepository, opt *repositories.OptimizedMenuRepository, useOptimized bool) *MenuService {
+func NewMenuService(userRepo *repositories.UserRepository, legacy *repositories.MenuRepository, opt *repositories.OptimizedMenuRepository, useOptimized bool, bus *events.Bus) *MenuService {
 	return &MenuService{
 		userRepo:     userRepo,
 		legacy:       legacy,
 		opt:          opt,
 		useOptimized: useOptimized,
+		bus:          bus,
 	}
 }
 
-func (s *MenuService) GetMenu(ctx context.Context, token string, lastMenu *time.Time) (*models.MenuResponse, error) {
+func (s *MenuService) GetMenu(ctx context.Context, token string, lastMenu *time.Time, lang string) (*models.MenuResponse, error) {
 	user, err := s.userRepo.GetUserByToken(ctx, token)
 	if err != nil {
 		return nil, err
@@ -38,8 +41,8 @@ func (s *MenuService) GetMenu(ctx context.Context, token string, lastMenu *time.
 	// Branch: check last_menu_update early (both repos implement check)
 	if s.useOptimized {
 		log.Printf("MenuRepository: using OPTIMIZED mode")
-		return s.opt.GetMenu(ctx, user.MerchantID, lastMenu)
+		return s.opt.GetMenu(ctx, user.MerchantID, lastMenu, lang)
 	}
 	log.Printf("MenuRepository: using LEGACY mode")
-	return s.legacy.GetMenu(ctx, user.MerchantID, lastMenu)
+	return s.legacy.GetMenu(ctx, user.MerchantID, lastMenu, lang)
 }
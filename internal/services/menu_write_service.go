@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"welloresto-api/internal/events"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/repositories"
+)
+
+var (
+	// ErrInvalidMenu : missing name / price / TVA, negative price, unknown category, TVA or product group
+	ErrInvalidMenu = errors.New("invalid menu")
+	// ErrMenuConflict : deleting a category that still has products, ungrouping a group with sub-products,
+	// bringing back a product while a component of its recipe is out
+	ErrMenuConflict = errors.New("menu conflict")
+)
+
+func (s *MenuService) merchantID(ctx context.Context, token string) (string, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", errors.New("invalid token")
+	}
+	return user.MerchantID, nil
+}
+
+func (s *MenuService) ListCategories(ctx context.Context, token string) ([]models.MenuCategory, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.legacy.ListCategories(ctx, merchantID)
+}
+
+func (s *MenuService) CreateCategory(ctx context.Context, token string, req models.CategoryRequest) (*models.MenuCategory, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if isBlank(req.Name) {
+		return nil, fmt.Errorf("%w: category name required", ErrInvalidMenu)
+	}
+
+	categoryID, err := s.legacy.CreateCategory(ctx, merchantID, req)
+	if err != nil {
+		return nil, err
+	}
+	return s.legacy.GetCategory(ctx, merchantID, categoryID)
+}
+
+func (s *MenuService) UpdateCategory(ctx context.Context, token, categoryID string, req models.CategoryRequest) (*models.MenuCategory, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil && isBlank(req.Name) {
+		return nil, fmt.Errorf("%w: category name required", ErrInvalidMenu)
+	}
+
+	if err := s.legacy.UpdateCategory(ctx, merchantID, categoryID, req); err != nil {
+		return nil, err
+	}
+	return s.legacy.GetCategory(ctx, merchantID, categoryID)
+}
+
+func (s *MenuService) DeleteCategory(ctx context.Context, token, categoryID string) error {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return err
+	}
+	return mapMenuError(s.legacy.DeleteCategory(ctx, merchantID, categoryID))
+}
+
+func (s *MenuService) GetProduct(ctx context.Context, token, productID string) (*models.ProductEntry, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.legacy.GetProduct(ctx, merchantID, productID)
+}
+
+// ListUnits : labels in lang
+func (s *MenuService) ListUnits(ctx context.Context, token, lang string) ([]models.UnitOfMeasure, error) {
+	if _, err := s.merchantID(ctx, token); err != nil {
+		return nil, err
+	}
+	return s.legacy.ListUnits(ctx, lang)
+}
+
+// CreateProduct : take away / delivery prices default to the on site one, every channel is open by default
+func (s *MenuService) CreateProduct(ctx context.Context, token string, req models.ProductRequest) (*models.ProductEntry, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if isBlank(req.Name) {
+		return nil, fmt.Errorf("%w: name required", ErrInvalidMenu)
+	}
+	if isBlank(req.CategoryID) && isBlank(req.ByProductOf) {
+		return nil, fmt.Errorf("%w: category_id required", ErrInvalidMenu)
+	}
+	if req.Price == nil {
+		return nil, fmt.Errorf("%w: price required", ErrInvalidMenu)
+	}
+	if req.TVAInID == nil || req.TVATakeAwayID == nil || req.TVADeliveryID == nil {
+		return nil, fmt.Errorf("%w: tva_in_id, tva_take_away_id and tva_delivery_id required", ErrInvalidMenu)
+	}
+	if req.PriceTakeAway == nil {
+		req.PriceTakeAway = req.Price
+	}
+	if req.PriceDelivery == nil {
+		req.PriceDelivery = req.Price
+	}
+	open := true
+	for _, flag := range []**bool{&req.AvailableIn, &req.AvailableTakeAway, &req.AvailableDelivery} {
+		if *flag == nil {
+			*flag = &open
+		}
+	}
+	if err := validateProduct(req); err != nil {
+		return nil, err
+	}
+
+	productID, err := s.legacy.CreateProduct(ctx, merchantID, req)
+	if err != nil {
+		return nil, mapMenuError(err)
+	}
+	return s.legacy.GetProduct(ctx, merchantID, productID)
+}
+
+func (s *MenuService) UpdateProduct(ctx context.Context, token, productID string, req models.ProductRequest) (*models.ProductEntry, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil && isBlank(req.Name) {
+		return nil, fmt.Errorf("%w: name required", ErrInvalidMenu)
+	}
+	if req.CategoryID != nil && isBlank(req.CategoryID) {
+		return nil, fmt.Errorf("%w: category_id required", ErrInvalidMenu)
+	}
+	if err := validateProduct(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.legacy.UpdateProduct(ctx, merchantID, productID, req); err != nil {
+		return nil, mapMenuError(err)
+	}
+	return s.legacy.GetProduct(ctx, merchantID, productID)
+}
+
+// DeleteProduct : deleting a product group deletes its sub-products
+func (s *MenuService) DeleteProduct(ctx context.Context, token, productID string) error {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return err
+	}
+	return s.legacy.DeleteProduct(ctx, merchantID, productID)
+}
+
+func validateProduct(req models.ProductRequest) error {
+	for _, price := range []*int64{req.Price, req.PriceTakeAway, req.PriceDelivery} {
+		if price != nil && *price < 0 {
+			return fmt.Errorf("%w: negative price", ErrInvalidMenu)
+		}
+	}
+	if req.ByProductOf != nil && *req.ByProductOf != "" && req.IsProductGroup != nil && *req.IsProductGroup {
+		return fmt.Errorf("%w: a product group can't be in another group", ErrInvalidMenu)
+	}
+	return nil
+}
+
+func mapMenuError(err error) error {
+	switch {
+	case errors.Is(err, repositories.ErrInvalidReference):
+		return fmt.Errorf("%w: %v", ErrInvalidMenu, err)
+	case errors.Is(err, repositories.ErrMenuItemInUse), errors.Is(err, repositories.ErrComponentOutOfStock):
+		return fmt.Errorf("%w: %v", ErrMenuConflict, err)
+	}
+	return err
+}
+
+// SetProductAvailability 86s a product from the floor (or brings it back)
+func (s *MenuService) SetProductAvailability(ctx context.Context, token, productID string, req models.AvailabilityRequest) (*models.AvailabilityChange, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if req.Available == nil {
+		return nil, fmt.Errorf("%w: available required", ErrInvalidMenu)
+	}
+
+	change, err := s.legacy.SetProductAvailability(ctx, merchantID, productID, *req.Available)
+	if err != nil {
+		return nil, mapMenuError(err)
+	}
+	s.publishAvailability(merchantID, change)
+	return change, nil
+}
+
+// SetComponentAvailability 86s a component, and every product whose recipe requires it
+func (s *MenuService) SetComponentAvailability(ctx context.Context, token, componentID string, req models.AvailabilityRequest) (*models.AvailabilityChange, error) {
+	merchantID, err := s.merchantID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if req.Available == nil {
+		return nil, fmt.Errorf("%w: available required", ErrInvalidMenu)
+	}
+
+	change, err := s.legacy.SetComponentAvailability(ctx, merchantID, componentID, *req.Available)
+	if err != nil {
+		return nil, mapMenuError(err)
+	}
+	s.publishAvailability(merchantID, change)
+	return change, nil
+}
+
+// publishAvailability : every app of the merchant gets it, nothing to publish when nothing changed
+func (s *MenuService) publishAvailability(merchantID string, change *models.AvailabilityChange) {
+	if len(change.ProductIDs) == 0 && len(change.ComponentIDs) == 0 {
+		return
+	}
+	s.bus.Publish(events.Event{
+		Type:       events.MenuAvailability,
+		MerchantID: merchantID,
+		Data:       change,
+	})
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OrderState is the lifecycle state stored in orders.state
+type OrderState string
+
+const (
+	OrderStateOpen     OrderState = "OPEN"
+	OrderStateDone     OrderState = "DONE"
+	OrderStateClosed   OrderState = "CLOSED"
+	OrderStateCanceled OrderState = "CANCELED"
+	OrderStateDeleted  OrderState = "DELETED"
+)
+
+var (
+	ErrInvalidOrderState = errors.New("invalid order state")
+	ErrIllegalTransition = errors.New("illegal order state transition")
+	ErrReopenNotAllowed  = errors.New("user is not allowed to reopen orders")
+)
+
+// orderTransitions lists the moves anybody can do.
+// Going back to OPEN from a finished state is a "reopen" and needs the reopen_order right.
+var orderTransitions = map[OrderState][]OrderState{
+	OrderStateOpen:     {OrderStateDone, OrderStateClosed, OrderStateCanceled, OrderStateDeleted},
+	OrderStateDone:     {OrderStateClosed, OrderStateCanceled},
+	OrderStateClosed:   {},
+	OrderStateCanceled: {OrderStateDeleted},
+	OrderStateDeleted:  {},
+}
+
+var reopenableStates = map[OrderState]bool{
+	OrderStateDone:     true,
+	OrderStateClosed:   true,
+	OrderStateCanceled: true,
+}
+
+// ParseOrderState normalizes a client value ("closed", " DONE ") into a known state
+func ParseOrderState(s string) (OrderState, error) {
+	st := OrderState(strings.ToUpper(strings.TrimSpace(s)))
+	if _, ok := orderTransitions[st]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidOrderState, s)
+	}
+	return st, nil
+}
+
+// CheckTransition returns nil when the order can move from -> to
+func (from OrderState) CheckTransition(to OrderState, canReopen bool) error {
+	if to == OrderStateOpen && reopenableStates[from] {
+		if !canReopen {
+			return ErrReopenNotAllowed
+		}
+		return nil
+	}
+	for _, allowed := range orderTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+}
@@ -3,26 +3,45 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
+	"welloresto-api/internal/events"
 	"welloresto-api/internal/models"
 	"welloresto-api/internal/repositories"
+
+	"go.uber.org/zap"
 )
 
+// ErrInvalidOrder is returned when an order payload can't be persisted as is
+var ErrInvalidOrder = errors.New("invalid order")
+
+// publishedLang : an order (or session) reloaded after a change is published to every app of
+// the merchant, whatever their language, so its labels stay in French ("" for the repositories)
+const publishedLang = ""
+
 type OrdersService struct {
 	ordersRepo           *repositories.OrdersRepository
 	deliverySessionsRepo *repositories.DeliverySessionsRepository
+	stockRepo            *repositories.StockRepository
 	userRepo             *repositories.UserRepository // used to resolve token -> merchant id
+	bus                  *events.Bus
+	log                  *zap.Logger
 }
 
-func NewOrdersService(ordersRepo *repositories.OrdersRepository, deliverySessionsRepo *repositories.DeliverySessionsRepository, userRepo *repositories.UserRepository) *OrdersService {
+func NewOrdersService(ordersRepo *repositories.OrdersRepository, deliverySessionsRepo *repositories.DeliverySessionsRepository, stockRepo *repositories.StockRepository, userRepo *repositories.UserRepository, bus *events.Bus, log *zap.Logger) *OrdersService {
 	return &OrdersService{
 		ordersRepo:           ordersRepo,
 		deliverySessionsRepo: deliverySessionsRepo,
+		stockRepo:            stockRepo,
 		userRepo:             userRepo,
+		bus:                  bus,
+		log:                  log,
 	}
 }
 
 // GetPendingOrders resolves token -> merchant, then fetch pending orders (legacy)
-func (s *OrdersService) GetPendingOrders(ctx context.Context, token string, app string) (*models.PendingOrdersResponse, error) {
+// since != nil switches to delta sync (only orders updated since, plus removed IDs)
+func (s *OrdersService) GetPendingOrders(ctx context.Context, token string, app string, since *time.Time, lang string) (*models.PendingOrdersResponse, error) {
 	// Resolve user by token to get merchant id
 	user, err := s.userRepo.GetUserByToken(ctx, token)
 	if err != nil {
@@ -32,10 +51,10 @@ func (s *OrdersService) GetPendingOrders(ctx context.Context, token string, app
 		return nil, errors.New("invalid token")
 	}
 
-	return s.ordersRepo.GetPendingOrders(ctx, user.MerchantID, app)
+	return s.ordersRepo.GetPendingOrders(ctx, user.MerchantID, app, since, lang)
 }
 
-func (s *OrdersService) GetOrder(ctx context.Context, token, orderID string) (*models.Order, error) {
+func (s *OrdersService) GetOrder(ctx context.Context, token, orderID, lang string) (*models.Order, error) {
 	// Resolve user by token to get merchant id
 	user, err := s.userRepo.GetUserByToken(ctx, token)
 	if err != nil {
@@ -45,10 +64,10 @@ func (s *OrdersService) GetOrder(ctx context.Context, token, orderID string) (*m
 		return nil, errors.New("invalid token")
 	}
 
-	return s.ordersRepo.GetOrder(ctx, user.MerchantID, orderID)
+	return s.ordersRepo.GetOrder(ctx, user.MerchantID, orderID, lang)
 }
 
-func (s *OrdersService) GetHistory(ctx context.Context, token string, req models.OrderHistoryRequest) ([]models.Order, error) {
+func (s *OrdersService) GetHistory(ctx context.Context, token string, from, to time.Time, lang string) ([]models.Order, error) {
 	// Resolve user by token to get merchant id
 	user, err := s.userRepo.GetUserByToken(ctx, token)
 	if err != nil {
@@ -58,7 +77,48 @@ func (s *OrdersService) GetHistory(ctx context.Context, token string, req models
 		return nil, errors.New("invalid token")
 	}
 
-	return s.ordersRepo.GetHistory(ctx, user.MerchantID, req)
+	return s.ordersRepo.GetHistory(ctx, user.MerchantID, from, to, lang)
+}
+
+// ErrInvalidHistoryQuery is returned for a history page that can't be served as asked
+var ErrInvalidHistoryQuery = errors.New("invalid history query")
+
+const (
+	historyDefaultLimit = 50
+	historyMaxLimit     = 200
+)
+
+// GetHistoryPage : one page of history, CLOSED orders unless states are given
+func (s *OrdersService) GetHistoryPage(ctx context.Context, token string, q models.OrderHistoryQuery, lang string) (*models.OrderHistoryPage, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = historyDefaultLimit
+	}
+	if q.Limit > historyMaxLimit {
+		q.Limit = historyMaxLimit
+	}
+	if len(q.States) == 0 {
+		q.States = []string{"CLOSED"}
+	}
+	if q.From != nil && q.To != nil && q.To.Before(*q.From) {
+		return nil, fmt.Errorf("%w: to before from", ErrInvalidHistoryQuery)
+	}
+	if q.MinTTC != nil && q.MaxTTC != nil && *q.MaxTTC < *q.MinTTC {
+		return nil, fmt.Errorf("%w: max_ttc below min_ttc", ErrInvalidHistoryQuery)
+	}
+
+	page, err := s.ordersRepo.GetHistoryPage(ctx, user.MerchantID, q, lang)
+	if errors.Is(err, repositories.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHistoryQuery, err)
+	}
+	return page, err
 }
 
 func (s *OrdersService) GetPayments(ctx context.Context, token string, orderID string) ([]models.Payment, error) {
@@ -70,10 +130,11 @@ func (s *OrdersService) GetPayments(ctx context.Context, token string, orderID s
 	if user == nil {
 		return nil, errors.New("invalid token")
 	}
-	return s.ordersRepo.GetPaymentsForOrder(ctx, orderID)
+	return s.ordersRepo.GetPaymentsForOrder(ctx, user.MerchantID, orderID)
 }
 
-func (s *OrdersService) DisablePayment(ctx context.Context, token string, paymentID string) error {
+// DisablePayment : sql.ErrNoRows when the payment is not one of this order of the merchant
+func (s *OrdersService) DisablePayment(ctx context.Context, token, orderID, paymentID string) error {
 	// Resolve user by token to get merchant id
 	user, err := s.userRepo.GetUserByToken(ctx, token)
 	if err != nil {
@@ -83,5 +144,182 @@ func (s *OrdersService) DisablePayment(ctx context.Context, token string, paymen
 		return errors.New("invalid token")
 	}
 
-	return s.ordersRepo.DisablePayment(ctx, paymentID)
+	if err := s.ordersRepo.DisablePayment(ctx, user.MerchantID, orderID, paymentID); err != nil {
+		return err
+	}
+
+	if order, err := s.ordersRepo.GetOrder(ctx, user.MerchantID, orderID, publishedLang); err == nil {
+		s.publishOrder(events.PaymentDisabled, user.MerchantID, order)
+	}
+	return nil
+}
+
+// CreateOrder validates the payload, persists the whole order tree then returns it fully built
+func (s *OrdersService) CreateOrder(ctx context.Context, token string, order models.Order) (*models.Order, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	if len(order.Products) == 0 {
+		return nil, fmt.Errorf("%w: no products", ErrInvalidOrder)
+	}
+	for _, p := range order.Products {
+		if p.ProductID == "" || p.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: product %q has an invalid quantity", ErrInvalidOrder, p.ProductID)
+		}
+	}
+
+	orderID, err := s.ordersRepo.CreateOrder(ctx, user.MerchantID, order, merchantLocation(user))
+	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidReference) || errors.Is(err, repositories.ErrInvalidDiscount) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidOrder, err)
+		}
+		return nil, err
+	}
+
+	created, err := s.ordersRepo.GetOrder(ctx, user.MerchantID, orderID, publishedLang)
+	if err != nil {
+		return nil, err
+	}
+	s.publishOrder(events.OrderCreated, user.MerchantID, created)
+	return created, nil
+}
+
+// ChangeOrderState validates the move against the state machine then applies it.
+// A DONE / CLOSED order has all of its items taken out of the stock.
+func (s *OrdersService) ChangeOrderState(ctx context.Context, token, orderID, newState string) (*models.Order, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	to, err := ParseOrderState(newState)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.ordersRepo.GetOrderState(ctx, user.MerchantID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	from, err := ParseOrderState(current)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := from.CheckTransition(to, user.ReopenOrder); err != nil {
+		return nil, err
+	}
+
+	if err := s.ordersRepo.UpdateOrderState(ctx, user.MerchantID, orderID, string(from), string(to), user.UserID); err != nil {
+		if errors.Is(err, repositories.ErrStateConflict) {
+			return nil, fmt.Errorf("%w: %v", ErrIllegalTransition, err)
+		}
+		return nil, err
+	}
+	// terminée sans passer (entièrement) par la cuisine : le reste sort du stock
+	if to == OrderStateDone || to == OrderStateClosed {
+		consumeOrderStock(ctx, s.log, s.stockRepo, s.bus, user, orderID, true)
+	}
+
+	order, err := s.ordersRepo.GetOrder(ctx, user.MerchantID, orderID, publishedLang)
+	if err != nil {
+		return nil, err
+	}
+	s.publishOrder(events.OrderUpdated, user.MerchantID, order)
+	return order, nil
+}
+
+// ErrInvalidPayment is returned when a payment can't be applied to the order
+var ErrInvalidPayment = errors.New("invalid payment")
+
+// ErrOrderNotPayable : payment on a CLOSED / CANCELED / DELETED order
+// (the repository error itself, re-exported for the handlers)
+var ErrOrderNotPayable = repositories.ErrOrderNotPayable
+
+// AddPayment records a payment (full amount or split by items) and returns the refreshed order.
+// Amounts are in cents; with items, an amount sent along must be the value of these items.
+func (s *OrdersService) AddPayment(ctx context.Context, token, orderID string, req models.AddPaymentRequest) (*models.Order, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	if req.MOP == "" {
+		return nil, fmt.Errorf("%w: missing mop", ErrInvalidPayment)
+	}
+	if req.Amount < 0 {
+		return nil, fmt.Errorf("%w: negative amount", ErrInvalidPayment)
+	}
+	if req.Amount == 0 && len(req.Items) == 0 {
+		return nil, fmt.Errorf("%w: amount or items required", ErrInvalidPayment)
+	}
+	for _, it := range req.Items {
+		if it.OrderItemID == "" || it.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: invalid item %q", ErrInvalidPayment, it.OrderItemID)
+		}
+	}
+
+	if _, err := s.ordersRepo.AddPayment(ctx, user.MerchantID, orderID, req); err != nil {
+		if errors.Is(err, repositories.ErrInvalidReference) || errors.Is(err, repositories.ErrPaymentExceedsDue) ||
+			errors.Is(err, repositories.ErrPaymentAmountMismatch) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPayment, err)
+		}
+		return nil, err
+	}
+
+	order, err := s.ordersRepo.GetOrder(ctx, user.MerchantID, orderID, publishedLang)
+	if err != nil {
+		return nil, err
+	}
+	s.publishOrder(events.PaymentAdded, user.MerchantID, order)
+	return order, nil
+}
+
+// SubscribeOrders opens an event stream for the merchant of the token, filtered for the app
+func (s *OrdersService) SubscribeOrders(ctx context.Context, token, app string) (*events.Subscription, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+	return s.bus.Subscribe(user.MerchantID, app), nil
+}
+
+func (s *OrdersService) publishOrder(eventType, merchantID string, order *models.Order) {
+	publishOrder(s.bus, eventType, merchantID, order)
+}
+
+// publishOrder : the order itself is the payload, type/fulfillment/session are kept for the per-app filter
+func publishOrder(bus *events.Bus, eventType, merchantID string, order *models.Order) {
+	e := events.Event{
+		Type:       eventType,
+		MerchantID: merchantID,
+		OrderID:    order.OrderID,
+		Data:       order,
+	}
+	if order.OrderType != nil {
+		e.OrderType = *order.OrderType
+	}
+	if order.FulfillmentType != nil {
+		e.FulfillmentType = *order.FulfillmentType
+	}
+	// le constructeur pose toujours le pointeur : "" hors session active
+	if order.DeliverySessionID != nil && *order.DeliverySessionID != "" {
+		e.DeliverySessionID = *order.DeliverySessionID
+		e.InDeliverySession = true
+	}
+	bus.Publish(e)
 }
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+	"time"
+	"welloresto-api/internal/events"
+	"welloresto-api/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// publishOrder must give the stream the same app predicate as GET /orders/pending: the driver
+// app doesn't get a delivery the platform makes, unless it is in an active delivery session
+func TestPublishOrderDriverAppFilter(t *testing.T) {
+	str := func(s string) *string { return &s }
+	cases := []struct {
+		name    string
+		order   models.Order
+		matches bool
+	}{
+		{"platform delivery, no session", models.Order{OrderID: "1", OrderType: str("DELIVERY"), FulfillmentType: str("DELIVERY_BY_PLATFORM"), DeliverySessionID: str("")}, false},
+		{"platform delivery, in a session", models.Order{OrderID: "2", OrderType: str("DELIVERY"), FulfillmentType: str("DELIVERY_BY_PLATFORM"), DeliverySessionID: str("7")}, true},
+		{"restaurant delivery, no session", models.Order{OrderID: "3", OrderType: str("DELIVERY"), FulfillmentType: str("DELIVERY_BY_RESTAURANT"), DeliverySessionID: str("")}, true},
+		{"on site", models.Order{OrderID: "4", OrderType: str("IN"), DeliverySessionID: str("")}, false},
+	}
+
+	bus := events.NewBus(zap.NewNop())
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sub := bus.Subscribe("42", "WR_DELIVERY")
+			defer sub.Close()
+
+			publishOrder(bus, events.OrderUpdated, "42", &c.order)
+
+			select {
+			case e := <-sub.C:
+				if !c.matches {
+					t.Fatalf("order %s sent to WR_DELIVERY", e.OrderID)
+				}
+			case <-time.After(50 * time.Millisecond):
+				if c.matches {
+					t.Fatalf("order %s not sent to WR_DELIVERY", c.order.OrderID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"welloresto-api/internal/models"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms stored in users.password_algo. Legacy passwords (users.password) have none.
+const (
+	PasswordAlgoArgon2id = "argon2id"
+	PasswordAlgoBcrypt   = "bcrypt"
+)
+
+// argon2id parameters (OWASP minimum: 19 MiB, 2 iterations, 1 thread).
+// Changing them makes every existing hash be re-hashed at the next login.
+const (
+	argon2Memory  = 19 * 1024
+	argon2Time    = 2
+	argon2Threads = 1
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var errMalformedHash = errors.New("malformed password hash")
+
+// hashPassword always produces an argon2id hash in the PHC format:
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword checks a password against the stored credentials.
+// rehash is true when the password matched but is not stored as an up to date argon2id hash.
+// The hash is the reference when there is one. The legacy password is tried when there is no
+// hash yet, and, while legacyFallback is on (the PHP backend can still change it), when the hash
+// doesn't match: the hash then follows it.
+func verifyPassword(password string, c models.UserCredentials, legacyFallback bool) (ok bool, rehash bool, err error) {
+	ok, rehash, err = verifyHash(password, c)
+	if ok {
+		return true, rehash, nil
+	}
+	if !c.LegacyPassword.Valid || c.LegacyPassword.String == "" {
+		return false, false, err
+	}
+	if c.PasswordHash.Valid && c.PasswordHash.String != "" && !legacyFallback {
+		return false, false, err
+	}
+	legacyOK, legacyErr := verifyLegacyPassword(password, c.LegacyPassword.String)
+	if legacyErr != nil || !legacyOK {
+		return false, false, legacyErr
+	}
+	return true, true, nil
+}
+
+func verifyHash(password string, c models.UserCredentials) (ok bool, rehash bool, err error) {
+	if !c.PasswordHash.Valid || c.PasswordHash.String == "" {
+		return false, false, nil
+	}
+	algo := c.PasswordAlgo.String
+	if algo == "" {
+		algo = detectPasswordAlgo(c.PasswordHash.String)
+	}
+
+	switch algo {
+	case PasswordAlgoArgon2id:
+		ok, current, err := verifyArgon2id(password, c.PasswordHash.String)
+		return ok, ok && !current, err
+	case PasswordAlgoBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(c.PasswordHash.String), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		return err == nil, err == nil, err
+	default:
+		return false, false, fmt.Errorf("unknown password algo %q", algo)
+	}
+}
+
+// verifyLegacyPassword : AES-ECB du PHP, ou texte en clair. Le texte en clair n'est comparé
+// que si la valeur stockée n'est pas un chiffré PHP : sinon le chiffré lui-même servirait de mot de passe.
+func verifyLegacyPassword(password, stored string) (bool, error) {
+	encrypted, err := encryptPHP(password)
+	if err != nil {
+		return false, err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(encrypted)) == 1 {
+		return true, nil
+	}
+	if isPHPCiphertext(stored) {
+		return false, nil
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1, nil
+}
+
+// isPHPCiphertext : stored is raw binary, as the PHP side writes its AES-ECB output, and decrypts
+// with the PHP key to a correctly PKCS#7 padded value. A printable value is a plain text password,
+// even when its decryption happens to end like a valid padding.
+func isPHPCiphertext(stored string) bool {
+	if isPrintable(stored) {
+		return false
+	}
+	block, err := aes.NewCipher(phpPasswordKey)
+	if err != nil {
+		return false
+	}
+	size := block.BlockSize()
+	if len(stored) == 0 || len(stored)%size != 0 {
+		return false
+	}
+	data := make([]byte, len(stored))
+	for bs := 0; bs < len(stored); bs += size {
+		block.Decrypt(data[bs:bs+size], []byte(stored[bs:bs+size]))
+	}
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > size {
+		return false
+	}
+	for _, b := range data[len(data)-padding:] {
+		if int(b) != padding {
+			return false
+		}
+	}
+	return true
+}
+
+// isPrintable : valid UTF-8 without control characters, what a typed password looks like
+func isPrintable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func detectPasswordAlgo(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return PasswordAlgoArgon2id
+	case strings.HasPrefix(hash, "$2"): // $2a$ / $2b$ / $2y$ (PHP password_hash)
+		return PasswordAlgoBcrypt
+	}
+	return ""
+}
+
+// verifyArgon2id : current is false when the hash was made with other parameters than ours
+func verifyArgon2id(password, hash string) (ok bool, current bool, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, errMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, errMalformedHash
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false, errMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, errMalformedHash
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	ok = subtle.ConstantTimeCompare(computed, key) == 1
+	current = memory == argon2Memory && time == argon2Time && threads == argon2Threads && len(key) == argon2KeyLen
+	return ok, current, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// PIN brute force protection: after maxFailures wrong PINs on a key, the key is locked for
+// pinLockout. Failures older than pinFailureWindow are forgotten. Keys are never taken from
+// the request body: the logged-in user of the session (pinMaxFailures), and the merchant as
+// a whole (pinMerchantMaxFailures), whatever sessions the attempts come from.
+const (
+	pinMaxFailures         = 5
+	pinMerchantMaxFailures = 20
+	pinFailureWindow       = 15 * time.Minute
+	pinLockout             = 15 * time.Minute
+)
+
+// pinLimiter is in-process (like the events bus): a restart resets the counters
+type pinLimiter struct {
+	mu          sync.Mutex
+	maxFailures int
+	entries     map[string]*pinAttempts
+}
+
+type pinAttempts struct {
+	failures    int
+	firstFail   time.Time
+	lockedUntil time.Time
+}
+
+func newPinLimiter(maxFailures int) *pinLimiter {
+	return &pinLimiter{maxFailures: maxFailures, entries: map[string]*pinAttempts{}}
+}
+
+// lockedUntil returns a non zero time while the key is locked out
+func (l *pinLimiter) lockedUntil(key string, now time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok || now.After(e.lockedUntil) {
+		return time.Time{}
+	}
+	return e.lockedUntil
+}
+
+// fail records a wrong PIN, returns the lockout end when this failure triggers it
+func (l *pinLimiter) fail(key string, now time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok || now.Sub(e.firstFail) > pinFailureWindow {
+		e = &pinAttempts{firstFail: now}
+		l.entries[key] = e
+	}
+	e.failures++
+	if e.failures >= l.maxFailures {
+		e.lockedUntil = now.Add(pinLockout)
+		e.failures = 0
+		e.firstFail = now
+		return e.lockedUntil
+	}
+
+	// ménage : on ne garde pas les clés inactives
+	for k, v := range l.entries {
+		if now.Sub(v.firstFail) > pinFailureWindow && now.After(v.lockedUntil) {
+			delete(l.entries, k)
+		}
+	}
+	return time.Time{}
+}
+
+func (l *pinLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/repositories"
+)
+
+var (
+	// ErrInvalidReportRange : from / to can't be parsed or to is before from
+	ErrInvalidReportRange = errors.New("invalid report range")
+	// ErrReportNotAllowed : the user lacks print_merchant_cash_report
+	ErrReportNotAllowed = errors.New("not_allowed")
+)
+
+type ReportsService struct {
+	reportsRepo *repositories.ReportsRepository
+	userRepo    *repositories.UserRepository // used to resolve token -> merchant id
+}
+
+func NewReportsService(reportsRepo *repositories.ReportsRepository, userRepo *repositories.UserRepository) *ReportsService {
+	return &ReportsService{
+		reportsRepo: reportsRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// GetCashReport : from / to are YYYY-MM-DD days (both included) in the merchant time zone, today by default
+func (s *ReportsService) GetCashReport(ctx context.Context, token, from, to string) (*models.CashReport, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil || user == nil {
+		return nil, errors.New("invalid token")
+	}
+	if !user.PrintMerchantCashReport {
+		return nil, ErrReportNotAllowed
+	}
+
+	loc := merchantLocation(user)
+	today := time.Now().In(loc).Format("2006-01-02")
+	if from == "" {
+		from = today
+	}
+	if to == "" {
+		to = from
+	}
+
+	start, err := time.ParseInLocation("2006-01-02", from, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid from", ErrInvalidReportRange)
+	}
+	end, err := time.ParseInLocation("2006-01-02", to, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid to", ErrInvalidReportRange)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: to is before from", ErrInvalidReportRange)
+	}
+	end = end.AddDate(0, 0, 1)
+
+	report, err := s.reportsRepo.GetCashReport(ctx, user.MerchantID, start.UTC(), end.UTC())
+	if err != nil {
+		return nil, err
+	}
+	report.From, report.To, report.TimeZone = start, end, loc.String()
+	return report, nil
+}
+
+// merchantLocation : merchant time zone, UTC when missing or unknown
+func merchantLocation(user *models.UserLoginRow) *time.Location {
+	if user.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(user.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"welloresto-api/internal/events"
+	"welloresto-api/internal/models"
+	"welloresto-api/internal/repositories"
+	"welloresto-api/internal/units"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrStockDisabled : the merchant's package has no stock management
+	ErrStockDisabled = errors.New("stock management not enabled")
+	// ErrInvalidStock : no items, negative / not finite quantity, unknown component, unit or movement type
+	ErrInvalidStock = errors.New("invalid stock")
+)
+
+const (
+	defaultStockMovements  = 100
+	maxStockMovements      = 1000
+	maxPendingConsumptions = 200
+)
+
+type StockService struct {
+	stockRepo *repositories.StockRepository
+	userRepo  *repositories.UserRepository
+	bus       *events.Bus
+}
+
+func NewStockService(stockRepo *repositories.StockRepository, userRepo *repositories.UserRepository, bus *events.Bus) *StockService {
+	return &StockService{
+		stockRepo: stockRepo,
+		userRepo:  userRepo,
+		bus:       bus,
+	}
+}
+
+func (s *StockService) stockUser(ctx context.Context, token string) (*models.UserLoginRow, error) {
+	user, err := s.userRepo.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+	if user.StockManagement == 0 {
+		return nil, ErrStockDisabled
+	}
+	return user, nil
+}
+
+func (s *StockService) ListComponents(ctx context.Context, token string) ([]models.StockComponent, error) {
+	user, err := s.stockUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.stockRepo.ListComponents(ctx, user.MerchantID)
+}
+
+func (s *StockService) ListMovements(ctx context.Context, token string, filter models.StockMovementFilter) ([]models.StockMovement, error) {
+	user, err := s.stockUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch filter.Type {
+	case "", repositories.StockConsumption, repositories.StockReception, repositories.StockInventory:
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidStock, filter.Type)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultStockMovements
+	}
+	if filter.Limit > maxStockMovements {
+		filter.Limit = maxStockMovements
+	}
+	return s.stockRepo.ListMovements(ctx, user.MerchantID, filter)
+}
+
+// UpdateComponent : stock unit / safety stock / extra portion, a component can go out (or come back) right away
+func (s *StockService) UpdateComponent(ctx context.Context, token, componentID string, req models.StockComponentRequest) (*models.StockUpdate, error) {
+	user, err := s.stockUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	for _, qty := range []*float64{req.SafetyStock, req.ExtraQuantity} {
+		if qty != nil && !validStockQuantity(*qty) {
+			return nil, fmt.Errorf("%w: quantities must be positive", ErrInvalidStock)
+		}
+	}
+	if req.StockUnit != nil {
+		unit, err := units.Lookup(*req.StockUnit)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidStock, err)
+		}
+		req.StockUnit = &unit.Code
+	}
+
+	update, err := s.stockRepo.UpdateComponent(ctx, user.MerchantID, user.UserID, componentID, req, user.DisableSafetyStock)
+	if err != nil {
+		return nil, mapStockError(err)
+	}
+	publishStockAvailability(s.bus, user.MerchantID, update)
+	return update, nil
+}
+
+// Receive : a delivery, quantities are added to the stock
+func (s *StockService) Receive(ctx context.Context, token string, req models.StockCountRequest) (*models.StockUpdate, error) {
+	user, err := s.stockUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateStockCount(req, false); err != nil {
+		return nil, err
+	}
+
+	update, err := s.stockRepo.Receive(ctx, user.MerchantID, user.UserID, req, user.DisableSafetyStock)
+	if err != nil {
+		return nil, mapStockError(err)
+	}
+	publishStockAvailability(s.bus, user.MerchantID, update)
+	return update, nil
+}
+
+// Inventory : counted quantities replace the stock
+func (s *StockService) Inventory(ctx context.Context, token string, req models.StockCountRequest) (*models.StockUpdate, error) {
+	user, err := s.stockUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateStockCount(req, true); err != nil {
+		return nil, err
+	}
+
+	update, err := s.stockRepo.Inventory(ctx, user.MerchantID, user.UserID, req, user.DisableSafetyStock)
+	if err != nil {
+		return nil, mapStockError(err)
+	}
+	publishStockAvailability(s.bus, user.MerchantID, update)
+	return update, nil
+}
+
+// ListPendingConsumptions : orders a consumption failed for, oldest first
+func (s *StockService) ListPendingConsumptions(ctx context.Context, token string) ([]models.PendingStockConsumption, error) {
+	user, err := s.stockUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.stockRepo.PendingConsumptions(ctx, user.MerchantID, maxPendingConsumptions)
+}
+
+// ReplayConsumption takes out of the stock what the order still holds (see ConsumeOrder),
+// the error is returned this time
+func (s *StockService) ReplayConsumption(ctx context.Context, token, orderID string) (*models.StockUpdate, error) {
+	user, err := s.stockUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	update, err := s.stockRepo.ConsumeOrder(ctx, user.MerchantID, orderID, user.UserID, false, user.DisableSafetyStock)
+	if err != nil {
+		return nil, mapStockError(err)
+	}
+	publishStockAvailability(s.bus, user.MerchantID, update)
+	return update, nil
+}
+
+// validateStockCount : a reception adds something to each line, an inventory can count 0
+func validateStockCount(req models.StockCountRequest, allowZero bool) error {
+	if len(req.Items) == 0 {
+		return fmt.Errorf("%w: items required", ErrInvalidStock)
+	}
+	for _, it := range req.Items {
+		if it.ComponentID == "" {
+			return fmt.Errorf("%w: component_id required", ErrInvalidStock)
+		}
+		if !validStockQuantity(it.Quantity) || (it.Quantity == 0 && !allowZero) {
+			return fmt.Errorf("%w: invalid quantity for component %s", ErrInvalidStock, it.ComponentID)
+		}
+	}
+	return nil
+}
+
+func validStockQuantity(qty float64) bool {
+	return qty >= 0 && !math.IsInf(qty, 0) && !math.IsNaN(qty)
+}
+
+func mapStockError(err error) error {
+	if errors.Is(err, repositories.ErrInvalidReference) || errors.Is(err, units.ErrIncompatibleUnits) {
+		return fmt.Errorf("%w: %v", ErrInvalidStock, err)
+	}
+	return err
+}
+
+// consumeOrderStock takes what was produced for an order out of the stock, when the merchant
+// manages stock. The production / state change is already committed, so a failure doesn't undo
+// it: stock_consumed_quantity stays behind, the order is listed by GET /stock/pending_consumptions
+// until a replay (or the next consumption of the order) catches it up.
+func consumeOrderStock(ctx context.Context, log *zap.Logger, stockRepo *repositories.StockRepository, bus *events.Bus, user *models.UserLoginRow, orderID string, wholeOrder bool) {
+	if stockRepo == nil || user.StockManagement == 0 {
+		return
+	}
+	update, err := stockRepo.ConsumeOrder(ctx, user.MerchantID, orderID, user.UserID, wholeOrder, user.DisableSafetyStock)
+	if err != nil {
+		log.Error("order stock not consumed, pending until replayed",
+			zap.String("merchant_id", user.MerchantID), zap.String("order_id", orderID), zap.Error(err))
+		return
+	}
+	publishStockAvailability(bus, user.MerchantID, update)
+}
+
+// publishStockAvailability : what the safety stock took out / brought back, same event as a manual 86
+func publishStockAvailability(bus *events.Bus, merchantID string, update *models.StockUpdate) {
+	for _, change := range update.Availability {
+		bus.Publish(events.Event{
+			Type:       events.MenuAvailability,
+			MerchantID: merchantID,
+			Data:       change,
+		})
+	}
+}
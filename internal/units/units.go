@@ -0,0 +1,81 @@
+package units
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Units of measure used by the recipes (requires.unit_of_measure, mapped through
+// unit_of_measure_code) and by the stock (components.stock_unit).
+// Quantities only convert within a dimension: g <-> kg, ml <-> cl <-> l, pieces on their own.
+
+type Dimension string
+
+const (
+	Mass   Dimension = "MASS"
+	Volume Dimension = "VOLUME"
+	Count  Dimension = "COUNT"
+)
+
+var (
+	ErrUnknownUnit       = errors.New("unknown unit")
+	ErrIncompatibleUnits = errors.New("incompatible units")
+)
+
+// Unit : Factor converts to the base unit of the dimension (g, ml, piece)
+type Unit struct {
+	Code      string    `json:"code"`
+	Dimension Dimension `json:"dimension"`
+	Factor    float64   `json:"factor"`
+}
+
+var all = []Unit{
+	{Code: "g", Dimension: Mass, Factor: 1},
+	{Code: "kg", Dimension: Mass, Factor: 1000},
+	{Code: "ml", Dimension: Volume, Factor: 1},
+	{Code: "cl", Dimension: Volume, Factor: 10},
+	{Code: "l", Dimension: Volume, Factor: 1000},
+	{Code: "piece", Dimension: Count, Factor: 1},
+}
+
+var byCode = func() map[string]Unit {
+	m := make(map[string]Unit, len(all))
+	for _, u := range all {
+		m[u.Code] = u
+	}
+	return m
+}()
+
+// List : every known unit, grouped by dimension
+func List() []Unit {
+	return append([]Unit(nil), all...)
+}
+
+// Lookup : case insensitive, ErrUnknownUnit otherwise
+func Lookup(code string) (Unit, error) {
+	u, ok := byCode[strings.ToLower(strings.TrimSpace(code))]
+	if !ok {
+		return Unit{}, fmt.Errorf("%w: %q", ErrUnknownUnit, code)
+	}
+	return u, nil
+}
+
+// Convert expresses qty (in from) in to
+func Convert(qty float64, from, to string) (float64, error) {
+	f, err := Lookup(from)
+	if err != nil {
+		return 0, err
+	}
+	t, err := Lookup(to)
+	if err != nil {
+		return 0, err
+	}
+	if f.Dimension != t.Dimension {
+		return 0, fmt.Errorf("%w: %s to %s", ErrIncompatibleUnits, f.Code, t.Code)
+	}
+	if f.Code == t.Code {
+		return qty, nil
+	}
+	return qty * f.Factor / t.Factor, nil
+}
@@ -0,0 +1,14 @@
+-- MySQL (legacy schema)
+
+ALTER TABLE users_rights
+    ADD COLUMN reopen_order BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE order_state_history (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    order_id BIGINT NOT NULL,
+    from_state VARCHAR(20),
+    to_state VARCHAR(20) NOT NULL,
+    user_id BIGINT,
+    changed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_order_state_history_order_id (order_id)
+);
@@ -0,0 +1,11 @@
+-- MySQL (legacy schema)
+
+-- Quantities of order items covered by a split payment.
+-- orderitems.paid_quantity moves by these quantities when the payment is added / disabled.
+CREATE TABLE payment_orderitems (
+    payment_id BIGINT NOT NULL,
+    order_item_id BIGINT NOT NULL,
+    quantity INT NOT NULL,
+    PRIMARY KEY (payment_id, order_item_id),
+    INDEX idx_payment_orderitems_order_item_id (order_item_id)
+);
@@ -0,0 +1,12 @@
+-- MySQL (legacy schema)
+
+-- GPS trail of the delivery man, only the last fixes of each session are kept
+CREATE TABLE delivery_session_position (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    delivery_session_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    lat DOUBLE NOT NULL,
+    lng DOUBLE NOT NULL,
+    recorded_at DATETIME NOT NULL,
+    INDEX idx_delivery_session_position_session (delivery_session_id, recorded_at)
+);
@@ -0,0 +1,34 @@
+-- MySQL (legacy schema)
+
+-- One session per merchant from the opening float to the count at closing. Amounts in cents.
+CREATE TABLE cash_drawer_session (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    merchant_id BIGINT NOT NULL,
+    device_id VARCHAR(255),
+    status VARCHAR(10) NOT NULL DEFAULT 'OPEN',
+    opened_by BIGINT NOT NULL,
+    opened_at DATETIME NOT NULL,
+    opening_float BIGINT NOT NULL DEFAULT 0,
+    closed_by BIGINT,
+    closed_at DATETIME,
+    expected_cash BIGINT,
+    counted_cash BIGINT,
+    notes TEXT,
+    INDEX idx_cash_drawer_session_merchant (merchant_id, status),
+    INDEX idx_cash_drawer_session_opened_at (merchant_id, opened_at)
+);
+
+-- Drawer openings (amount 0) and manual cash in / cash out
+CREATE TABLE cash_drawer_movement (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    session_id BIGINT,
+    merchant_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    device_id VARCHAR(255),
+    type VARCHAR(20) NOT NULL,
+    amount BIGINT NOT NULL DEFAULT 0,
+    reason VARCHAR(255),
+    created_at DATETIME NOT NULL,
+    INDEX idx_cash_drawer_movement_session (session_id),
+    INDEX idx_cash_drawer_movement_merchant (merchant_id, created_at)
+);
@@ -0,0 +1,7 @@
+-- MySQL (legacy schema)
+
+-- users.password (AES-ECB / plain) is kept for the PHP backend. password_hash is checked first,
+-- users.password only when the hash is missing or doesn't match (then the hash follows it)
+ALTER TABLE users
+    ADD COLUMN password_hash VARCHAR(255) NULL,
+    ADD COLUMN password_algo VARCHAR(20) NULL;
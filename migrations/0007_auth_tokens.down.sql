@@ -0,0 +1,16 @@
+-- MySQL (legacy schema)
+
+-- Back to the users.token / users_rights.token sessions: every issued session is lost
+ALTER TABLE users_rights
+    DROP COLUMN manage_users;
+
+DROP TABLE IF EXISTS auth_tokens;
+
+-- the 0001_init table, token as VARCHAR since MySQL can't key a TEXT column
+CREATE TABLE auth_tokens (
+    token VARCHAR(255) PRIMARY KEY,
+    user_id INT,
+    device_id VARCHAR(50),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NULL
+);
@@ -0,0 +1,21 @@
+-- MySQL (legacy schema)
+
+-- 0001_init created an auth_tokens table (clear token as primary key) that nothing ever wrote to:
+-- the tokens lived in users.token / users_rights.token. It is replaced, not altered.
+DROP TABLE IF EXISTS auth_tokens;
+
+-- One row per issued session token (per user, per device). Only the SHA-256 of the token is stored.
+CREATE TABLE auth_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    device_id VARCHAR(255),
+    app VARCHAR(20),
+    created_at DATETIME NOT NULL,
+    last_used_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME,
+    INDEX idx_auth_tokens_user_device (user_id, device_id)
+);
+
+ALTER TABLE users_rights
+    ADD COLUMN manage_users BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+-- MySQL (legacy schema)
+
+-- PIN quick-switch tokens are short-lived and never extended
+ALTER TABLE auth_tokens
+    ADD COLUMN sliding BOOLEAN NOT NULL DEFAULT TRUE;
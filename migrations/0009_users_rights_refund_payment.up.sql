@@ -0,0 +1,5 @@
+-- MySQL (legacy schema)
+
+-- Disabling a payment (DELETE /orders/{order_id}/payments/{payment_id}) is a refund
+ALTER TABLE users_rights
+    ADD COLUMN refund_payment BOOLEAN NOT NULL DEFAULT FALSE;
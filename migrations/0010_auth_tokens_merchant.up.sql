@@ -0,0 +1,5 @@
+-- MySQL (legacy schema)
+
+-- Merchant selected on the session (POST /auth/merchant), NULL = the user's home merchant (users.access_id)
+ALTER TABLE auth_tokens
+    ADD COLUMN merchant_id INT NULL AFTER user_id;
@@ -0,0 +1,22 @@
+-- MySQL (legacy schema)
+
+-- Address book of a customer. The default address is mirrored into customer.customer_address & co,
+-- which is what orders read.
+CREATE TABLE customer_address (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    customer_id BIGINT NOT NULL,
+    merchant_id BIGINT NOT NULL,
+    label VARCHAR(100),
+    address VARCHAR(255) NOT NULL,
+    lat DOUBLE,
+    lng DOUBLE,
+    floor_number VARCHAR(20),
+    door_number VARCHAR(20),
+    additional_address VARCHAR(255),
+    zone_code VARCHAR(20),
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    INDEX idx_customer_address_customer (customer_id, enabled)
+);
@@ -0,0 +1,8 @@
+-- MySQL (legacy schema)
+
+-- Day listings and availability checks look bookings up by merchant and time range
+ALTER TABLE bookings
+    ADD INDEX idx_bookings_merchant_dates (merchant_id, booking_date_from, booking_date_to);
+
+ALTER TABLE booked_location
+    ADD INDEX idx_booked_location_location (location_id, booking_id);
@@ -0,0 +1,5 @@
+-- MySQL (legacy schema)
+
+-- Rearranging the room (floors, areas, tables) from the reception tablet is a manager's job
+ALTER TABLE users_rights
+    ADD COLUMN edit_floor_plan BOOLEAN NOT NULL DEFAULT FALSE;
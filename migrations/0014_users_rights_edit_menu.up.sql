@@ -0,0 +1,5 @@
+-- MySQL (legacy schema)
+
+-- Writing the menu (/menu/categories, /menu/products) is a manager's job
+ALTER TABLE users_rights
+    ADD COLUMN edit_menu BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,27 @@
+-- MySQL (legacy schema)
+
+-- products.status / components.status: 1 available, 0 out of stock ("86").
+-- Why a product is out: MANUAL (86'd from the floor) or COMPONENT (a required component is out);
+-- only COMPONENT ones come back on their own when the component is back.
+ALTER TABLE products
+    ADD COLUMN unavailable_reason VARCHAR(20) NULL;
+
+
+-- Product availability changes waiting to be pushed to the delivery platforms, drained by
+-- services.AvailabilitySync (Uber Eats menu API). A row is given up after a few failed
+-- attempts (attempts, last_error).
+-- Out of scope for now: Deliveroo. integration_deliveroo only holds the location_id, while its
+-- menu API also needs the brand id and API credentials, which are stored nowhere. No DELIVEROO
+-- row is queued: a Deliveroo merchant has to 86 the item in the Deliveroo back office.
+CREATE TABLE integration_availability_outbox (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    merchant_id BIGINT NOT NULL,
+    integration VARCHAR(20) NOT NULL, -- UBER_EATS
+    item_id VARCHAR(50) NOT NULL,     -- products.product_id
+    available BOOLEAN NOT NULL,
+    created_at DATETIME NOT NULL,
+    sent_at DATETIME NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(255) NULL,
+    INDEX idx_availability_outbox_pending (integration, sent_at, id)
+);
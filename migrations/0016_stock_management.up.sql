@@ -0,0 +1,31 @@
+-- MySQL (legacy schema)
+
+-- Stock is kept per component, in the unit the recipes (requires.quantity) use.
+-- extra_quantity: what one "extra" of the component consumes, defaults to its quantity in the recipe.
+-- unavailable_reason: MANUAL (86'd from the floor) or SAFETY_STOCK (fell under safety_stock);
+-- only SAFETY_STOCK ones come back on their own with a reception / inventory.
+ALTER TABLE components
+    ADD COLUMN stock_quantity DECIMAL(12,3) NOT NULL DEFAULT 0,
+    ADD COLUMN safety_stock DECIMAL(12,3) NULL,
+    ADD COLUMN extra_quantity DECIMAL(12,3) NULL,
+    ADD COLUMN unavailable_reason VARCHAR(20) NULL;
+
+-- Units already taken out of stock, so a consumption can be replayed without counting twice
+ALTER TABLE orderitems
+    ADD COLUMN stock_consumed_quantity INT NOT NULL DEFAULT 0;
+
+CREATE TABLE stock_movements (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    merchant_id BIGINT NOT NULL,
+    component_id BIGINT NOT NULL,
+    movement_type VARCHAR(20) NOT NULL, -- CONSUMPTION, RECEPTION, INVENTORY
+    quantity DECIMAL(12,3) NOT NULL,    -- signed delta
+    stock_after DECIMAL(12,3) NOT NULL,
+    order_id BIGINT NULL,
+    order_item_id BIGINT NULL,
+    user_id BIGINT NULL,
+    comment VARCHAR(255) NULL,
+    created_at DATETIME NOT NULL,
+    INDEX idx_stock_movements_component (merchant_id, component_id, created_at),
+    INDEX idx_stock_movements_date (merchant_id, created_at)
+);
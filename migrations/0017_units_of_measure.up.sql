@@ -0,0 +1,30 @@
+-- MySQL (legacy schema)
+
+-- Conversion code of each unit of measure (internal/units): g, kg, ml, cl, l, piece.
+-- Units without a code keep working, their quantities just can't be converted.
+CREATE TABLE unit_of_measure_code (
+    id INT PRIMARY KEY, -- unit_of_measure_desc.id, requires.unit_of_measure
+    code VARCHAR(10) NOT NULL
+);
+
+-- seeded from the French labels
+INSERT INTO unit_of_measure_code (id, code)
+SELECT id, code FROM (
+    SELECT id,
+        CASE LOWER(TRIM(uom_desc))
+            WHEN 'g' THEN 'g' WHEN 'gr' THEN 'g' WHEN 'gramme' THEN 'g' WHEN 'grammes' THEN 'g'
+            WHEN 'kg' THEN 'kg' WHEN 'kilo' THEN 'kg' WHEN 'kilogramme' THEN 'kg' WHEN 'kilogrammes' THEN 'kg'
+            WHEN 'ml' THEN 'ml' WHEN 'millilitre' THEN 'ml' WHEN 'millilitres' THEN 'ml'
+            WHEN 'cl' THEN 'cl' WHEN 'centilitre' THEN 'cl' WHEN 'centilitres' THEN 'cl'
+            WHEN 'l' THEN 'l' WHEN 'litre' THEN 'l' WHEN 'litres' THEN 'l'
+            WHEN 'pièce' THEN 'piece' WHEN 'pièces' THEN 'piece' WHEN 'piece' THEN 'piece' WHEN 'pieces' THEN 'piece'
+            WHEN 'pc' THEN 'piece' WHEN 'pcs' THEN 'piece' WHEN 'unité' THEN 'piece' WHEN 'unités' THEN 'piece'
+        END AS code
+    FROM unit_of_measure_desc
+    WHERE lang = 'FR'
+) uc
+WHERE uc.code IS NOT NULL;
+
+-- Unit the stock of a component is kept in. NULL: the unit of its recipes, quantities taken as is.
+ALTER TABLE components
+    ADD COLUMN stock_unit VARCHAR(10) NULL;
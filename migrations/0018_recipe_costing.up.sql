@@ -0,0 +1,15 @@
+-- MySQL (legacy schema)
+
+-- Purchase cost of a component, in cents for one cost_unit (internal/units code,
+-- NULL: the unit of its recipes). Not component_price: that one is what an extra is charged.
+ALTER TABLE components
+    ADD COLUMN cost_price INT NULL,
+    ADD COLUMN cost_unit VARCHAR(10) NULL;
+
+-- Food cost one unit of an option adds to the product, in cents
+ALTER TABLE configurable_attribute_options
+    ADD COLUMN cost_price INT NULL;
+
+-- Gross margin (percent of the price excl. TVA) under which a product is flagged, 70 when NULL
+ALTER TABLE merchant_parameters
+    ADD COLUMN target_food_margin DECIMAL(5,2) NULL;
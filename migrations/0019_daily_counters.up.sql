@@ -0,0 +1,11 @@
+-- MySQL (legacy schema)
+
+-- Last number given per merchant, counter (ORDER, BOOKING) and day. The row is locked
+-- (FOR UPDATE) until the order / booking is committed, so concurrent creates get their own number.
+CREATE TABLE daily_counters (
+    merchant_id  BIGINT NOT NULL,
+    counter_name VARCHAR(20) NOT NULL,
+    counter_date DATE NOT NULL,
+    last_value   INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (merchant_id, counter_name, counter_date)
+);
@@ -0,0 +1,12 @@
+-- MySQL (legacy schema)
+
+-- Item id of a product on a delivery platform, when its menu there was not published with
+-- products.product_id as item id. Read by the availability outbox (services.AvailabilitySync),
+-- a product without a row is pushed under its product_id.
+CREATE TABLE integration_item_mapping (
+    merchant_id BIGINT NOT NULL,
+    integration VARCHAR(20) NOT NULL, -- UBER_EATS
+    product_id VARCHAR(50) NOT NULL,
+    external_id VARCHAR(100) NOT NULL,
+    PRIMARY KEY (merchant_id, integration, product_id)
+);
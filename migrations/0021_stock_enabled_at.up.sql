@@ -0,0 +1,6 @@
+-- MySQL (legacy schema)
+
+-- When the merchant started managing stock: set by the first stock operation (component update,
+-- reception, inventory, consumption). Orders created before it are never taken out of the stock.
+ALTER TABLE merchant
+    ADD COLUMN stock_enabled_at DATETIME NULL;